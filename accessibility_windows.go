@@ -0,0 +1,119 @@
+//go:build windows && !systray_fake
+
+package systray
+
+import (
+	"runtime"
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+var (
+	clsidAccPropServices = windows.GUID{Data1: 0xb5f8350b, Data2: 0x0548, Data3: 0x48b1, Data4: [8]byte{0xa6, 0xee, 0x88, 0xbd, 0x00, 0xb4, 0xa5, 0xe7}}
+	iidIAccPropServices  = windows.GUID{Data1: 0x6e26e776, Data2: 0x04f0, Data3: 0x495d, Data4: [8]byte{0x80, 0xe4, 0x33, 0x30, 0x35, 0x2e, 0x31, 0x69}}
+	propIDAccDescription = windows.GUID{Data1: 0x4d48dfe4, Data2: 0xbd3f, Data3: 0x491f, Data4: [8]byte{0xa6, 0x48, 0x49, 0x2d, 0x6f, 0x20, 0xc5, 0x88}}
+)
+
+// Indexes of the methods of IAccPropServices in its vtable, after those of
+// IUnknown.
+// https://docs.microsoft.com/en-us/windows/win32/api/oleacc/nn-oleacc-iaccpropservices
+const (
+	accPropServicesRelease         = 2
+	accPropServicesSetHmenuPropStr = 13
+	accPropServicesClearHmenuProps = 15
+)
+
+// accPropServices is an IAccPropServices COM object, seen by its vtable.
+type accPropServices struct {
+	vtable *[accPropServicesClearHmenuProps + 1]uintptr
+}
+
+func (s *accPropServices) call(method int, args ...uintptr) uintptr {
+	ret, _, _ := syscall.SyscallN(s.vtable[method], append([]uintptr{uintptr(unsafe.Pointer(s))}, args...)...)
+	return ret
+}
+
+// guidByValue splits g into the arguments a GUID passed by value takes: it's
+// passed by reference on amd64, in two registers on arm64 and on the stack on
+// 32-bit architectures.
+func guidByValue(g *windows.GUID) []uintptr {
+	switch runtime.GOARCH {
+	case "amd64":
+		return []uintptr{uintptr(unsafe.Pointer(g))}
+	case "arm64":
+		words := (*[2]uint64)(unsafe.Pointer(g))
+		return []uintptr{uintptr(words[0]), uintptr(words[1])}
+	default:
+		words := (*[4]uint32)(unsafe.Pointer(g))
+		return []uintptr{uintptr(words[0]), uintptr(words[1]), uintptr(words[2]), uintptr(words[3])}
+	}
+}
+
+// describeMenuItems annotates the items of menu with their descriptions,
+// which MSAA reports as their accDescription. Items are identified by their
+// position in the menu, so it's done each time the menu is about to show.
+func (t *winTray) describeMenuItems(menu windows.Handle) {
+	var parent uint32
+	if !t.isMainMenu(menu) {
+		var ok bool
+		if parent, ok = t.menuItemOf(menu); !ok {
+			return
+		}
+	}
+	t.muVisibleItems.RLock()
+	visibleItems := append([]uint32(nil), t.visibleItems[parent]...)
+	t.muVisibleItems.RUnlock()
+	descriptions := make([]string, len(visibleItems))
+	described := false
+	for i, menuItemId := range visibleItems {
+		if item, ok := GetMenuItemByID(menuItemId); ok {
+			descriptions[i] = item.loadDescription()
+			described = described || descriptions[i] != ""
+		}
+	}
+	// stale annotations are cleared once the last description is
+	if !described && !t.describedMenus[menu] {
+		return
+	}
+
+	const (
+		COINIT_APARTMENTTHREADED = 0x2
+		CLSCTX_INPROC_SERVER     = 0x1
+	)
+	if err := windows.CoInitializeEx(0, COINIT_APARTMENTTHREADED); err == nil {
+		defer windows.CoUninitialize()
+	}
+	var s *accPropServices
+	hr, _, _ := pCoCreateInstance.Call(
+		uintptr(unsafe.Pointer(&clsidAccPropServices)),
+		0,
+		CLSCTX_INPROC_SERVER,
+		uintptr(unsafe.Pointer(&iidIAccPropServices)),
+		uintptr(unsafe.Pointer(&s)),
+	)
+	if int32(hr) < 0 {
+		// log.Errorf("Unable to create IAccPropServices: %v", syscall.Errno(hr))
+		return
+	}
+	defer s.call(accPropServicesRelease)
+	for i, description := range descriptions {
+		// MSAA child IDs of menu items are their 1-based positions
+		childID := uintptr(i + 1)
+		if description == "" {
+			s.call(accPropServicesClearHmenuProps, uintptr(menu), childID, uintptr(unsafe.Pointer(&propIDAccDescription)), 1)
+			continue
+		}
+		descriptionPtr, err := windows.UTF16PtrFromString(description)
+		if err != nil {
+			continue
+		}
+		args := []uintptr{uintptr(menu), childID}
+		args = append(args, guidByValue(&propIDAccDescription)...)
+		args = append(args, uintptr(unsafe.Pointer(descriptionPtr)))
+		s.call(accPropServicesSetHmenuPropStr, args...)
+		runtime.KeepAlive(descriptionPtr)
+	}
+	t.describedMenus[menu] = described
+}
@@ -0,0 +1,134 @@
+// Loads libappindicator3 at runtime, or libayatana-appindicator3 if it's not
+// installed, or falls back to a GtkStatusIcon if neither is, for builds with
+// the dynamic_appindicator build tag. Each
+// function of the library used by systray_linux.c is replaced by a pointer of
+// the same name, set by load_app_indicator.
+
+#include <dlfcn.h>
+#include <gtk/gtk.h>
+
+typedef struct _AppIndicator AppIndicator;
+
+typedef enum {
+    APP_INDICATOR_CATEGORY_APPLICATION_STATUS,
+    APP_INDICATOR_CATEGORY_COMMUNICATIONS,
+    APP_INDICATOR_CATEGORY_SYSTEM_SERVICES,
+    APP_INDICATOR_CATEGORY_HARDWARE,
+    APP_INDICATOR_CATEGORY_OTHER
+} AppIndicatorCategory;
+
+typedef enum {
+    APP_INDICATOR_STATUS_PASSIVE,
+    APP_INDICATOR_STATUS_ACTIVE,
+    APP_INDICATOR_STATUS_ATTENTION
+} AppIndicatorStatus;
+
+static AppIndicator *(*app_indicator_new)(const gchar *id,
+                                          const gchar *icon_name,
+                                          AppIndicatorCategory category);
+static void (*app_indicator_set_status)(AppIndicator *self,
+                                        AppIndicatorStatus status);
+static void (*app_indicator_set_title)(AppIndicator *self, const gchar *title);
+static void (*app_indicator_set_menu)(AppIndicator *self, GtkMenu *menu);
+static void (*app_indicator_set_icon_full)(AppIndicator *self,
+                                           const gchar *icon_name,
+                                           const gchar *icon_desc);
+static void (*app_indicator_set_attention_icon_full)(AppIndicator *self,
+                                                     const gchar *icon_name,
+                                                     const gchar *icon_desc);
+
+// The fallback used when neither library is installed, a GtkStatusIcon shown
+// in the XEmbed system trays of X11 desktops, standing for the AppIndicator.
+// It shows its menu when clicked.
+
+static GtkMenu *fallback_menu = NULL;
+
+static void _fallback_popup_menu(GtkStatusIcon *icon, gpointer unused) {
+    if (fallback_menu != NULL) {
+        gtk_menu_popup_at_pointer(fallback_menu, NULL);
+    }
+}
+
+static void _fallback_popup_menu_button(GtkStatusIcon *icon, guint button,
+                                        guint activate_time, gpointer unused) {
+    _fallback_popup_menu(icon, unused);
+}
+
+G_GNUC_BEGIN_IGNORE_DEPRECATIONS
+static AppIndicator *fallback_new(const gchar *id, const gchar *icon_name,
+                                  AppIndicatorCategory category) {
+    GtkStatusIcon *icon = gtk_status_icon_new();
+    gtk_status_icon_set_name(icon, id);
+    g_signal_connect(G_OBJECT(icon), "activate",
+                     G_CALLBACK(_fallback_popup_menu), NULL);
+    g_signal_connect(G_OBJECT(icon), "popup-menu",
+                     G_CALLBACK(_fallback_popup_menu_button), NULL);
+    return (AppIndicator *)icon;
+}
+
+static void fallback_set_status(AppIndicator *self, AppIndicatorStatus status) {
+    gtk_status_icon_set_visible((GtkStatusIcon *)self,
+                                status != APP_INDICATOR_STATUS_PASSIVE);
+}
+
+static void fallback_set_title(AppIndicator *self, const gchar *title) {
+    gtk_status_icon_set_title((GtkStatusIcon *)self, title);
+    gtk_status_icon_set_tooltip_text((GtkStatusIcon *)self, title);
+}
+
+static void fallback_set_icon_full(AppIndicator *self, const gchar *icon_name,
+                                   const gchar *icon_desc) {
+    // the icon is always set from a file, see _show_icon
+    gtk_status_icon_set_from_file((GtkStatusIcon *)self, icon_name);
+}
+G_GNUC_END_IGNORE_DEPRECATIONS
+
+static void fallback_set_menu(AppIndicator *self, GtkMenu *menu) {
+    fallback_menu = menu;
+}
+
+static void fallback_set_attention_icon_full(AppIndicator *self,
+                                             const gchar *icon_name,
+                                             const gchar *icon_desc) {}
+
+// makes the functions of the library use the GtkStatusIcon fallback
+static void load_fallback(void) {
+    app_indicator_new = fallback_new;
+    app_indicator_set_status = fallback_set_status;
+    app_indicator_set_title = fallback_set_title;
+    app_indicator_set_menu = fallback_set_menu;
+    app_indicator_set_icon_full = fallback_set_icon_full;
+    app_indicator_set_attention_icon_full = fallback_set_attention_icon_full;
+}
+
+// the libraries to try, in order
+static const char *app_indicator_libraries[] = {
+    "libappindicator3.so.1",
+    "libayatana-appindicator3.so.1",
+};
+
+// returns the name of the loaded library, or of the fallback if none could be
+// loaded
+static const char *load_app_indicator(void) {
+    for (size_t i = 0; i < G_N_ELEMENTS(app_indicator_libraries); i++) {
+        void *handle = dlopen(app_indicator_libraries[i], RTLD_NOW);
+        if (handle == NULL) {
+            continue;
+        }
+#define LOAD(name)                                                             \
+    if ((*(void **)&name = dlsym(handle, #name)) == NULL) {                    \
+        dlclose(handle);                                                       \
+        continue;                                                              \
+    }
+        LOAD(app_indicator_new)
+        LOAD(app_indicator_set_status)
+        LOAD(app_indicator_set_title)
+        LOAD(app_indicator_set_menu)
+        LOAD(app_indicator_set_icon_full)
+        LOAD(app_indicator_set_attention_icon_full)
+#undef LOAD
+        return app_indicator_libraries[i];
+    }
+    load_fallback();
+    return "GtkStatusIcon";
+}
@@ -0,0 +1,113 @@
+package systray
+
+import (
+	"sync"
+	"time"
+)
+
+// attentionBlinkInterval is how long the icon stays faded, then normal, for
+// each blink of the attention mode.
+const attentionBlinkInterval = 500 * time.Millisecond
+
+var (
+	// attentionStop is closed to end the attention mode, nil when it's off
+	attentionStop chan struct{}
+	// attentionDone is closed once the icon stopped blinking and was
+	// restored, nil before the attention mode is first on
+	attentionDone chan struct{}
+	muAttention   sync.Mutex
+)
+
+// AttentionOption configures the attention mode, see SetAttentionMode.
+type AttentionOption func(*attentionOptions)
+
+type attentionOptions struct {
+	repeat int
+}
+
+// WithAttentionRepeat ends the attention mode on its own after the icon
+// blinked n times. By default, it blinks until the attention mode is ended.
+func WithAttentionRepeat(n int) AttentionOption {
+	return func(o *attentionOptions) {
+		o.repeat = n
+	}
+}
+
+// SetAttentionMode makes the tray icon blink to urgently signal the user if
+// enabled is true, until SetAttentionMode(false) is called, the user clicks
+// the icon or a menu item, or the systray quits. It fades the icon on macOS
+// and Linux, where the Dock icon also bounces if the app has one, and blanks
+// it on Windows.
+func SetAttentionMode(enabled bool, opts ...AttentionOption) {
+	var o attentionOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	muAttention.Lock()
+	defer muAttention.Unlock()
+	endAttentionModeLocked()
+	if !enabled {
+		return
+	}
+	stop, done := make(chan struct{}), make(chan struct{})
+	go blinkIcon(stop, done, attentionDone, o.repeat)
+	attentionStop, attentionDone = stop, done
+}
+
+// endAttentionMode ends the attention mode if it's on.
+func endAttentionMode() {
+	muAttention.Lock()
+	defer muAttention.Unlock()
+	endAttentionModeLocked()
+}
+
+// endAttentionModeLocked is endAttentionMode for callers holding
+// muAttention.
+func endAttentionModeLocked() {
+	if attentionStop != nil {
+		close(attentionStop)
+		attentionStop = nil
+	}
+}
+
+// blinkIcon waits for the blinking of the previous attention mode to be
+// done, so that restoring the icon can't undo the new one, then blinks the
+// icon repeat times, or until stop is closed if repeat is not positive, and
+// closes done once the icon is restored.
+func blinkIcon(stop, done, previous chan struct{}, repeat int) {
+	defer close(done)
+	if previous != nil {
+		<-previous
+	}
+	select {
+	case <-stop:
+		return
+	default:
+	}
+	requestUserAttention(true)
+	ticker := time.NewTicker(attentionBlinkInterval)
+	defer ticker.Stop()
+	defer func() {
+		muAttention.Lock()
+		if attentionStop == stop {
+			// the icon blinked repeat times
+			attentionStop = nil
+		}
+		muAttention.Unlock()
+		setIconDimmed(false)
+		requestUserAttention(false)
+	}()
+	dimmed := false
+	for blinks := 0; repeat <= 0 || blinks < repeat; {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+		dimmed = !dimmed
+		setIconDimmed(dimmed)
+		if !dimmed {
+			blinks++
+		}
+	}
+}
@@ -0,0 +1,31 @@
+package systray
+
+import (
+	"strconv"
+)
+
+// SetIconBadge shows count in a small red circle over the top right corner of
+// the systray icon, the way mail or chat applications show the number of
+// pending items. Counts above 9 are shown as "9+", and a count of 0 or less
+// removes the badge. The badge is kept when the icon changes.
+//
+// The badge is drawn onto the icon on all platforms, as neither the
+// notification area of Windows nor the status bar of macOS overlay badges,
+// and libappindicator doesn't expose the overlay icon of StatusNotifierItem.
+// On Linux, it's only drawn on icons in a format GdkPixbuf can load, and on
+// macOS, template icons don't adapt to the menu bar appearance while the
+// badge is shown.
+func SetIconBadge(count int) {
+	setIconBadge(badgeText(count))
+}
+
+// badgeText returns the text of the badge for count, empty for no badge.
+func badgeText(count int) string {
+	switch {
+	case count <= 0:
+		return ""
+	case count > 9:
+		return "9+"
+	}
+	return strconv.Itoa(count)
+}
@@ -0,0 +1,73 @@
+package systray
+
+import (
+	"sync"
+)
+
+var (
+	muBatch    sync.Mutex
+	batchDepth int
+	// batchQueue holds the menu items updated during a batch, in the order
+	// of their first update
+	batchQueue  []*MenuItem
+	batchQueued map[*MenuItem]bool
+)
+
+// BatchUpdate runs fn, holding back the changes it makes to menu items until
+// it returns, then propagates them to the native menu at once. It avoids the
+// flicker caused by refreshing the menu for each change, and each menu item
+// is only updated once however many times it's changed. Hiding and showing
+// menu items are not held back. Calls may be nested, in which case changes
+// are propagated when the outermost call returns. The menu change hooks
+// learn about the menu items added by fn once they're propagated.
+//
+// While propagating, the native menu stops redrawing on Windows, with
+// WM_SETREDRAW on the menus showing, and batches its change notifications on
+// macOS. On Linux, GTK coalesces the redraws of the menu by itself.
+//
+// Note that changes made by other goroutines while fn runs are held back
+// too.
+func BatchUpdate(fn func()) {
+	muBatch.Lock()
+	batchDepth++
+	muBatch.Unlock()
+
+	defer func() {
+		muBatch.Lock()
+		batchDepth--
+		var queue []*MenuItem
+		if batchDepth == 0 {
+			queue = batchQueue
+			batchQueue = nil
+			batchQueued = nil
+		}
+		muBatch.Unlock()
+		if len(queue) == 0 {
+			return
+		}
+		beginBatchUpdate()
+		defer endBatchUpdate()
+		for _, item := range queue {
+			item.update()
+		}
+	}()
+	fn()
+}
+
+// queueUpdate holds back the update of item if a batch is in progress, and
+// reports whether it did.
+func queueUpdate(item *MenuItem) bool {
+	muBatch.Lock()
+	defer muBatch.Unlock()
+	if batchDepth == 0 {
+		return false
+	}
+	if !batchQueued[item] {
+		if batchQueued == nil {
+			batchQueued = make(map[*MenuItem]bool)
+		}
+		batchQueued[item] = true
+		batchQueue = append(batchQueue, item)
+	}
+	return true
+}
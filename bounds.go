@@ -0,0 +1,25 @@
+package systray
+
+import (
+	"errors"
+)
+
+// ErrBoundsUnavailable is returned by GetTrayIconBounds when the platform
+// doesn't tell where the tray icon is.
+var ErrBoundsUnavailable = errors.New("systray: tray icon bounds unavailable")
+
+// GetTrayIconBounds returns the position of the top left corner of the tray
+// icon on screen and its size, e.g. to show a popup window next to it. On
+// Windows, they are in physical pixels if the process is DPI aware. On macOS,
+// they are in points, from the top left corner of the primary display, y
+// growing downwards, unlike AppKit coordinates. ErrBoundsUnavailable is
+// returned while the systray isn't running, when the icon is hidden, e.g. in
+// the overflow area of the notification area on Windows, and always on Linux,
+// as neither libappindicator nor the StatusNotifierItem protocol tell where
+// the host shows the icon.
+func GetTrayIconBounds() (x, y, width, height int, err error) {
+	if !IsRunning() {
+		return 0, 0, 0, 0, ErrBoundsUnavailable
+	}
+	return trayIconBounds()
+}
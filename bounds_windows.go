@@ -0,0 +1,38 @@
+//go:build windows && !systray_fake
+
+package systray
+
+import (
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+var pShellNotifyIconGetRect = s32.NewProc("Shell_NotifyIconGetRect")
+
+// https://docs.microsoft.com/en-us/windows/win32/api/shellapi/ns-shellapi-notifyiconidentifier
+type notifyIconIdentifier struct {
+	Size     uint32
+	Wnd      windows.Handle
+	ID       uint32
+	GuidItem windows.GUID
+}
+
+func trayIconBounds() (x, y, width, height int, err error) {
+	wt.muNID.RLock()
+	if wt.nid == nil {
+		wt.muNID.RUnlock()
+		return 0, 0, 0, 0, ErrBoundsUnavailable
+	}
+	nii := notifyIconIdentifier{Wnd: wt.nid.Wnd, ID: wt.nid.ID}
+	wt.muNID.RUnlock()
+	nii.Size = uint32(unsafe.Sizeof(nii))
+	var r rect
+	// it returns an HRESULT, failing e.g. when the icon is in the overflow
+	// area and the area is closed
+	hr, _, _ := pShellNotifyIconGetRect.Call(uintptr(unsafe.Pointer(&nii)), uintptr(unsafe.Pointer(&r)))
+	if hr != 0 {
+		return 0, 0, 0, 0, ErrBoundsUnavailable
+	}
+	return int(r.Left), int(r.Top), int(r.Right - r.Left), int(r.Bottom - r.Top), nil
+}
@@ -0,0 +1,84 @@
+package systray
+
+// MenuItemBuilder builds a menu item with chained calls, as an alternative to
+// passing options to NewMenuItem, e.g.
+//
+//	systray.NewMenuItemBuilder("Quit").Tooltip("Quit the app").OnClicked(systray.Quit).Build()
+type MenuItemBuilder struct {
+	title  string
+	opts   []MenuItemOption
+	parent *MenuItem
+	icon   []byte
+}
+
+// NewMenuItemBuilder starts building a menu item with the designated title.
+func NewMenuItemBuilder(title string) *MenuItemBuilder {
+	return &MenuItemBuilder{title: title}
+}
+
+// Tooltip sets the tooltip of the menu item, see WithTooltip.
+func (b *MenuItemBuilder) Tooltip(tooltip string) *MenuItemBuilder {
+	b.opts = append(b.opts, WithTooltip(tooltip))
+	return b
+}
+
+// Disabled disables the menu item, see WithDisabled.
+func (b *MenuItemBuilder) Disabled() *MenuItemBuilder {
+	b.opts = append(b.opts, WithDisabled())
+	return b
+}
+
+// Checked makes the menu item checkable and checked, see WithCheckable.
+func (b *MenuItemBuilder) Checked() *MenuItemBuilder {
+	b.opts = append(b.opts, WithCheckable(true))
+	return b
+}
+
+// Icon sets the icon of the menu item, see WithItemIcon.
+func (b *MenuItemBuilder) Icon(iconBytes []byte) *MenuItemBuilder {
+	b.icon = iconBytes
+	return b
+}
+
+// Parent adds the menu item to the sub menu of parent, see WithParent.
+func (b *MenuItemBuilder) Parent(parent *MenuItem) *MenuItemBuilder {
+	b.parent = parent
+	return b
+}
+
+// OnClicked sets the function to call when the menu item is clicked, see
+// WithOnClickedFunc.
+func (b *MenuItemBuilder) OnClicked(fn func()) *MenuItemBuilder {
+	b.opts = append(b.opts, WithOnClickedFunc(fn))
+	return b
+}
+
+// Build adds the menu item to the menu. It panics if the parent has been
+// removed or the icon is invalid, see BuildE to handle the error.
+func (b *MenuItemBuilder) Build() *MenuItem {
+	item, err := b.BuildE()
+	if err != nil {
+		panic(err)
+	}
+	return item
+}
+
+// BuildE is like Build but returns ErrMenuItemRemoved if the parent has been
+// removed, or the error of SetIcon if the icon is invalid, without adding any
+// menu item.
+func (b *MenuItemBuilder) BuildE() (*MenuItem, error) {
+	opts := append([]MenuItemOption(nil), b.opts...)
+	if b.parent != nil {
+		if parent, ok := GetMenuItemByID(b.parent.id); !ok || parent != b.parent {
+			return nil, ErrMenuItemRemoved
+		}
+		opts = append(opts, WithParent(b.parent))
+	}
+	if b.icon != nil {
+		if err := validateIcon(b.icon); err != nil {
+			return nil, err
+		}
+		opts = append(opts, WithItemIcon(b.icon))
+	}
+	return NewMenuItem(b.title, opts...), nil
+}
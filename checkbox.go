@@ -0,0 +1,30 @@
+package systray
+
+// NewMenuItemCheckbox adds a checkable menu item, initially checked if
+// checked is true, which toggles when clicked. onChange, if not nil, is
+// called with whether the menu item is now checked; the toggle is atomic, see
+// MenuItem.Toggle, so concurrent clicks and programmatic changes can't get the
+// state out of sync. opts apply to the menu item, e.g. WithParent to add it to
+// a sub menu, but the callback they set with WithOnClickedFunc is replaced.
+func NewMenuItemCheckbox(title string, checked bool, onChange func(checked bool), opts ...MenuItemOption) *MenuItem {
+	if onChange == nil {
+		onChange = func(bool) {}
+	}
+	itemOpts := append([]MenuItemOption(nil), opts...)
+	itemOpts = append(itemOpts,
+		WithCheckable(checked),
+		withCheckboxCallback(onChange),
+	)
+	return NewMenuItem(title, itemOpts...)
+}
+
+// withCheckboxCallback makes clicks toggle the menu item, and then call
+// onChange.
+func withCheckboxCallback(onChange func(checked bool)) MenuItemOption {
+	return func(item *MenuItem) {
+		item.onChange = onChange
+		item.onClicked = func() {
+			onChange(item.Toggle())
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package systray
+
+import (
+	"sync"
+)
+
+var (
+	muTrayClick      sync.RWMutex
+	onTrayLeftClick  func()
+	onTrayRightClick func()
+	onTrayDblClick   func()
+)
+
+// SetOnLeftClickFunc sets the callback function to call when the tray icon is
+// left clicked, instead of showing the menu. A nil callback restores the
+// default behavior. Only available on Windows, as macOS and Linux always
+// show the menu on click.
+func SetOnLeftClickFunc(fn func()) {
+	muTrayClick.Lock()
+	onTrayLeftClick = fn
+	muTrayClick.Unlock()
+}
+
+// SetOnRightClickFunc sets the callback function to call when the tray icon is
+// right clicked, instead of showing the menu. A nil callback restores the
+// default behavior. Only available on Windows, as macOS and Linux always
+// show the menu on click.
+func SetOnRightClickFunc(fn func()) {
+	muTrayClick.Lock()
+	onTrayRightClick = fn
+	muTrayClick.Unlock()
+}
+
+// SetOnDoubleClickFunc sets the callback function to call when the tray icon
+// is double clicked. A nil callback restores the default behavior. Only
+// available on Windows.
+//
+// When set, a left click waits for the system double click time (as
+// configured in the Control Panel, 500ms by default) before being handled as
+// a single click, to find out if it's actually the first half of a double
+// click. A double click then invokes fn only, not the single click behavior.
+func SetOnDoubleClickFunc(fn func()) {
+	muTrayClick.Lock()
+	onTrayDblClick = fn
+	muTrayClick.Unlock()
+}
+
+// hasTrayDoubleClick reports whether a double click callback is set.
+func hasTrayDoubleClick() bool {
+	muTrayClick.RLock()
+	defer muTrayClick.RUnlock()
+	return onTrayDblClick != nil
+}
+
+// trayDoubleClicked invokes the double click callback and reports whether
+// there was one.
+func trayDoubleClicked() bool {
+	endAttentionMode()
+	muTrayClick.RLock()
+	fn := onTrayDblClick
+	muTrayClick.RUnlock()
+	if fn == nil {
+		return false
+	}
+	fn()
+	return true
+}
+
+// trayLeftClicked invokes the left click callback and reports whether there
+// was one.
+func trayLeftClicked() bool {
+	endAttentionMode()
+	muTrayClick.RLock()
+	fn := onTrayLeftClick
+	muTrayClick.RUnlock()
+	if fn == nil {
+		return false
+	}
+	fn()
+	return true
+}
+
+// trayRightClicked invokes the right click callback and reports whether there
+// was one.
+func trayRightClicked() bool {
+	endAttentionMode()
+	muTrayClick.RLock()
+	fn := onTrayRightClick
+	muTrayClick.RUnlock()
+	if fn == nil {
+		return false
+	}
+	fn()
+	return true
+}
@@ -0,0 +1,76 @@
+package systray
+
+import "sync"
+
+var (
+	// maxClickWorkers is the number of goroutines handling the clicks on menu
+	// items, 0 to handle them in the event loop
+	maxClickWorkers int
+	clickWorkers    int
+	// clickQueue holds the clicks waiting for a worker
+	clickQueue   []func()
+	muClickQueue sync.Mutex
+)
+
+// SetClickWorkerPool makes up to maxWorkers goroutines handle the clicks on
+// menu items, rather than the event loop, so that slow click handlers neither
+// freeze the menu nor pile up goroutines. Clicks are queued, without limit,
+// until a worker is free, see ClickQueueLen. Workers are only started when
+// there are clicks to handle. A maxWorkers of 0 or less handles the following
+// clicks in the event loop again, the default, the running workers finishing
+// the queued ones.
+func SetClickWorkerPool(maxWorkers int) {
+	if maxWorkers < 0 {
+		maxWorkers = 0
+	}
+	muClickQueue.Lock()
+	defer muClickQueue.Unlock()
+	maxClickWorkers = maxWorkers
+	for clickWorkers < maxClickWorkers && clickWorkers < len(clickQueue) {
+		clickWorkers++
+		go clickWorker()
+	}
+}
+
+// ClickQueueLen returns the number of clicks waiting for a worker, see
+// SetClickWorkerPool.
+func ClickQueueLen() int {
+	muClickQueue.Lock()
+	defer muClickQueue.Unlock()
+	return len(clickQueue)
+}
+
+// dispatchClick runs fn in the event loop, or queues it for a worker if
+// SetClickWorkerPool set up any.
+func dispatchClick(fn func()) {
+	muClickQueue.Lock()
+	if maxClickWorkers == 0 {
+		muClickQueue.Unlock()
+		fn()
+		return
+	}
+	defer muClickQueue.Unlock()
+	clickQueue = append(clickQueue, fn)
+	if clickWorkers < maxClickWorkers {
+		clickWorkers++
+		go clickWorker()
+	}
+}
+
+// clickWorker handles the queued clicks until there are none left, or there
+// are more workers than allowed.
+func clickWorker() {
+	for {
+		muClickQueue.Lock()
+		if len(clickQueue) == 0 || (maxClickWorkers > 0 && clickWorkers > maxClickWorkers) {
+			clickWorkers--
+			muClickQueue.Unlock()
+			return
+		}
+		fn := clickQueue[0]
+		clickQueue[0] = nil
+		clickQueue = clickQueue[1:]
+		muClickQueue.Unlock()
+		fn()
+	}
+}
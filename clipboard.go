@@ -0,0 +1,56 @@
+package systray
+
+import (
+	"errors"
+	"strings"
+	"time"
+)
+
+// ErrClipboard is returned when the platform fails to set the clipboard.
+var ErrClipboard = errors.New("systray: unable to set the clipboard")
+
+const (
+	// copiedMark is prepended to the title of a clipboard menu item for
+	// copiedFlashDuration after copying its text
+	copiedMark          = "✓ "
+	copiedFlashDuration = time.Second
+)
+
+// CopyToClipboard sets the text content of the system clipboard.
+func CopyToClipboard(text string) error {
+	return setClipboardText(text)
+}
+
+// NewClipboardMenuItem adds a menu item which copies textToCopy to the system
+// clipboard when clicked, e.g. to copy an IP address. Once copied, a check mark
+// is prepended to its title for a second, visible if the menu is opened again
+// meanwhile.
+func NewClipboardMenuItem(title, tooltip, textToCopy string) *MenuItem {
+	return NewMenuItem(title, WithTooltip(tooltip), withCopyOnClick(textToCopy))
+}
+
+// withCopyOnClick makes the menu item copy textToCopy when clicked, the click
+// callback being bound to the menu item the option is applied to, before the
+// menu item shows and can be clicked.
+func withCopyOnClick(textToCopy string) MenuItemOption {
+	return func(item *MenuItem) {
+		item.onClicked = func() {
+			if setClipboardText(textToCopy) != nil {
+				return
+			}
+			original := item.loadTitle()
+			if strings.HasPrefix(original, copiedMark) {
+				// still flashing from a previous click
+				return
+			}
+			flashed := copiedMark + original
+			item.SetTitle(flashed)
+			time.AfterFunc(copiedFlashDuration, func() {
+				// leave the title alone if it changed meanwhile
+				if item.loadTitle() == flashed {
+					item.SetTitle(original)
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package systray
+
+import (
+	"sync/atomic"
+)
+
+// CloneMenuItem appends a menu item with the title, tooltip, description,
+// icon, accelerator, style, enabled and checked states and click callback of
+// src to the menu of src, e.g. to build one sub menu per device from a
+// template. opts are applied on top, e.g. WithParent to add it to another
+// menu. The clone of a section header is a section header too.
+// The clone is independent from src: changing either afterwards doesn't
+// affect the other, and clicking a clone of a checkbox, see
+// NewMenuItemCheckbox, toggles the clone. The clone of a RadioGroup member
+// is not part of the group: clicking it checks the clone only, as a group of
+// its own. The sub menu, hotkey, click channel and debounce or throttle
+// settings of src are not cloned. src may have been removed.
+func CloneMenuItem(src *MenuItem, opts ...MenuItemOption) *MenuItem {
+	src.mu.RLock()
+	tooltip, description := src.tooltip, src.description
+	tooltipDelay := src.tooltipDelay
+	onClicked := src.onClicked
+	icon := src.icon
+	src.mu.RUnlock()
+	disabled := atomic.LoadInt32(&src.disabled)
+	isCheckable := atomic.LoadInt32(&src.isCheckable)
+	checked := atomic.LoadInt32(&src.checked)
+
+	cloneOpts := []MenuItemOption{func(item *MenuItem) {
+		item.tooltip = tooltip
+		item.description = description
+		item.tooltipDelay = tooltipDelay
+		item.icon = icon
+		// the fields below are never changed once src is created
+		item.disabled, item.softDisabled = disabled, src.softDisabled
+		item.isCheckable = isCheckable
+		item.checked = checked
+		item.isRadio, item.isHeader = src.isRadio, src.isHeader
+		item.accelerator = src.accelerator
+		item.iconWidth, item.iconHeight = src.iconWidth, src.iconHeight
+		item.style = src.style
+		item.parent = src.parent
+		if src.isRadio {
+			// the click callback of src selects src in its group
+			item.onClicked = item.Check
+		} else {
+			item.onClicked = onClicked
+		}
+	}}
+	if src.onChange != nil {
+		// the click callback of src toggles src
+		cloneOpts = append(cloneOpts, withCheckboxCallback(src.onChange))
+	}
+	cloneOpts = append(cloneOpts, opts...)
+	return newMenuItem(src.loadTitle(), cloneOpts, nil, false)
+}
@@ -0,0 +1,78 @@
+package systray
+
+import (
+	"sync"
+	"time"
+)
+
+// clickLimiter limits how often the click callbacks of a menu item are
+// invoked, see WithDebounce and WithThrottle.
+type clickLimiter struct {
+	mu sync.Mutex
+	// timer invokes the callbacks at the end of the debounce window
+	timer *time.Timer
+	// last is the time the callbacks were last invoked when throttling
+	last time.Time
+}
+
+// WithDebounce delays the click callbacks of the MenuItem to be created until
+// no click happened for d, so that clicking repeatedly, e.g. on a "Sync now"
+// menu item, invokes them only once, after the last click. The callbacks are
+// then invoked from their own goroutine. It overrides WithThrottle.
+func WithDebounce(d time.Duration) MenuItemOption {
+	return func(item *MenuItem) {
+		item.debounce = d
+		item.throttle = 0
+	}
+}
+
+// WithThrottle invokes the click callbacks of the MenuItem to be created at
+// most once every d: the first click invokes them right away, and the
+// following clicks within d are dropped. It overrides WithDebounce.
+func WithThrottle(d time.Duration) MenuItemOption {
+	return func(item *MenuItem) {
+		item.throttle = d
+		item.debounce = 0
+	}
+}
+
+// debounce invokes fn once d has elapsed without any other call.
+func (l *clickLimiter) debounce(d time.Duration, fn func()) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.timer != nil {
+		l.timer.Stop()
+	}
+	l.timer = time.AfterFunc(d, fn)
+}
+
+// stop drops the pending debounced call, if any.
+func (l *clickLimiter) stop() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.timer != nil {
+		l.timer.Stop()
+		l.timer = nil
+	}
+}
+
+// stopDebouncedClicks drops the pending debounced calls of all the menu items,
+// so that no callback runs once the systray quits.
+func stopDebouncedClicks() {
+	menuItems.Range(func(_, v interface{}) bool {
+		v.(*MenuItem).limiter.stop()
+		return true
+	})
+}
+
+// allow reports whether d has elapsed since the last allowed call.
+func (l *clickLimiter) allow(d time.Duration) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	if !l.last.IsZero() && now.Sub(l.last) < d {
+		return false
+	}
+	l.last = now
+	return true
+}
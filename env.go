@@ -0,0 +1,85 @@
+package systray
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+)
+
+// errHeadlessUnsupported is the cause of the InitError returned when
+// SYSTRAY_HEADLESS is set in a native build, as the backend is chosen at
+// build time.
+var errHeadlessUnsupported = errors.New("SYSTRAY_HEADLESS=1 requires building with the systray_fake tag")
+
+// headless reports whether SYSTRAY_HEADLESS=1 is set, for CI jobs running
+// apps without a display. The fake backend then logs its calls to stderr as
+// JSON Lines, and native backends fail to initialize rather than trying to
+// reach a display: RunE and RegisterE return an InitError, while Run and
+// Register log it and return without invoking onReady or onExit.
+func headless() bool {
+	return os.Getenv("SYSTRAY_HEADLESS") == "1"
+}
+
+// init sets the Logger from SYSTRAY_LOG_LEVEL: "debug" logs every operation
+// and error, "error" only the errors, to the standard logger, or to stderr in
+// JSON Lines format when headless. Loggers set by SetLogger replace it.
+func init() {
+	level := os.Getenv("SYSTRAY_LOG_LEVEL")
+	if level != "debug" && level != "error" {
+		return
+	}
+	debug := level == "debug"
+	switch {
+	case headless():
+		SetLogger(jsonLogger{debug})
+	case debug:
+		SetLogger(StdLogger())
+	default:
+		SetLogger(errorLogger{StdLogger()})
+	}
+}
+
+// errorLogger drops debug messages.
+type errorLogger struct {
+	Logger
+}
+
+func (errorLogger) Debugf(format string, args ...interface{}) {}
+
+// jsonLogger writes messages to stderr in JSON Lines format, debug messages
+// only if debug is set.
+type jsonLogger struct {
+	debug bool
+}
+
+func (l jsonLogger) Debugf(format string, args ...interface{}) {
+	if l.debug {
+		writeJSONLine(jsonMessage{Level: "debug", Msg: fmt.Sprintf(format, args...)})
+	}
+}
+
+func (jsonLogger) Errorf(format string, args ...interface{}) {
+	writeJSONLine(jsonMessage{Level: "error", Msg: fmt.Sprintf(format, args...)})
+}
+
+type jsonMessage struct {
+	Level string `json:"level"`
+	Msg   string `json:"msg"`
+}
+
+var muJSONLines sync.Mutex
+
+// writeJSONLine writes v to stderr as a line of JSON.
+func writeJSONLine(v interface{}) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		log.Printf("systray: unable to log %+v: %v", v, err)
+		return
+	}
+	muJSONLines.Lock()
+	defer muJSONLines.Unlock()
+	os.Stderr.Write(append(b, '\n'))
+}
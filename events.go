@@ -0,0 +1,86 @@
+package systray
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// EventType tells what an Event is about.
+type EventType int
+
+const (
+	// MenuOpenedEvent is published when the menu of the tray icon opens,
+	// before it shows, so that subscribers can still update it. On Linux, it
+	// relies on the menu being mapped, which some indicator hosts never do.
+	MenuOpenedEvent EventType = iota
+	// MenuClosedEvent is published when the menu of the tray icon closes.
+	MenuClosedEvent
+)
+
+// Event is something that happened to the systray, see EventBus.
+type Event struct {
+	Type EventType
+	// Timestamp is when the event was published.
+	Timestamp time.Time
+}
+
+// EventBus delivers events to the functions subscribed to them.
+type EventBus struct {
+	mu            sync.RWMutex
+	subscriptions map[int]subscription
+	nextID        int
+}
+
+type subscription struct {
+	eventType EventType
+	fn        func(Event)
+}
+
+var events = &EventBus{subscriptions: make(map[int]subscription)}
+
+// Events returns the EventBus to which the systray publishes its events.
+func Events() *EventBus {
+	return events
+}
+
+// Subscribe calls fn with each event of the given type, from the thread the
+// event happens in, so fn should return quickly. It returns the subscription
+// to pass to Unsubscribe.
+func (b *EventBus) Subscribe(eventType EventType, fn func(Event)) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.nextID++
+	b.subscriptions[b.nextID] = subscription{eventType, fn}
+	return b.nextID
+}
+
+// Unsubscribe stops the given subscription. Unknown subscriptions are
+// ignored.
+func (b *EventBus) Unsubscribe(subscription int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.subscriptions, subscription)
+}
+
+// publish calls the functions subscribed to events of type t, in the order
+// they subscribed.
+func (b *EventBus) publish(t EventType) {
+	e := Event{Type: t, Timestamp: time.Now()}
+	b.mu.RLock()
+	var ids []int
+	for id, s := range b.subscriptions {
+		if s.eventType == t {
+			ids = append(ids, id)
+		}
+	}
+	sort.Ints(ids)
+	fns := make([]func(Event), len(ids))
+	for i, id := range ids {
+		fns[i] = b.subscriptions[id].fn
+	}
+	b.mu.RUnlock()
+	for _, fn := range fns {
+		fn(e)
+	}
+}
@@ -0,0 +1,54 @@
+package systray_test
+
+import (
+	"embed"
+	"image/color"
+	"image/png"
+	"log"
+
+	"github.com/bingliu221/systray"
+)
+
+//go:embed testdata/icon.png
+var assets embed.FS
+
+func ExampleSetIconFromFS() {
+	systray.Run(func() {
+		if err := systray.SetIconFromFS(assets, "testdata/icon.png"); err != nil {
+			log.Println(err)
+		}
+		systray.NewMenuItem("Quit", systray.WithOnClickedFunc(systray.Quit))
+	}, nil)
+}
+
+func ExampleNewIconFromTemplate() {
+	systray.Run(func() {
+		// a green status light
+		icon, err := systray.NewIconFromTemplate(systray.IconShapeDot, color.RGBA{G: 0xc0, A: 0xff}, 32)
+		if err != nil {
+			log.Fatal(err)
+		}
+		systray.SetIcon(icon)
+		systray.NewMenuItem("Quit", systray.WithOnClickedFunc(systray.Quit))
+	}, nil)
+}
+
+func ExampleIcon() {
+	systray.Run(func() {
+		f, err := assets.Open("testdata/icon.png")
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer f.Close()
+		img, err := png.Decode(f)
+		if err != nil {
+			log.Fatal(err)
+		}
+		// 3 unread messages, and a sync 40% done
+		icon := systray.NewIcon(img).
+			DrawBadge(3, color.RGBA{R: 0xe0, A: 0xff}).
+			DrawProgressArc(0.4, color.RGBA{B: 0xe0, A: 0xff})
+		systray.SetIconImage(icon.Image())
+		systray.NewMenuItem("Quit", systray.WithOnClickedFunc(systray.Quit))
+	}, nil)
+}
@@ -0,0 +1,75 @@
+package systray
+
+import (
+	"log"
+	"os/exec"
+)
+
+// ExecOption configures the command run by an exec menu item, see
+// NewExecMenuItemWithOptions.
+type ExecOption func(*execOptions)
+
+type execOptions struct {
+	onError func(error)
+	dir     string
+	env     []string
+}
+
+// WithErrorHandler sets the function to call when the command fails to
+// launch, instead of logging the error. It's called from the goroutine
+// launching the command.
+func WithErrorHandler(fn func(error)) ExecOption {
+	return func(o *execOptions) {
+		o.onError = fn
+	}
+}
+
+// WithWorkingDir sets the working directory of the command, the one of the
+// process by default.
+func WithWorkingDir(dir string) ExecOption {
+	return func(o *execOptions) {
+		o.dir = dir
+	}
+}
+
+// WithEnv sets the environment of the command, in the form "key=value", the
+// one of the process by default.
+func WithEnv(env []string) ExecOption {
+	return func(o *execOptions) {
+		o.env = env
+	}
+}
+
+// NewExecMenuItem adds a menu item which runs cmd with args when clicked,
+// without waiting for it to finish. See NewExecMenuItemWithOptions to
+// configure the command.
+func NewExecMenuItem(title, tooltip string, cmd string, args ...string) *MenuItem {
+	return NewExecMenuItemWithOptions(title, tooltip, cmd, args)
+}
+
+// NewExecMenuItemWithOptions is like NewExecMenuItem with options for the
+// command. The command is launched in its own goroutine, with its standard
+// input and outputs detached. Launch errors are logged unless
+// WithErrorHandler is set, while the exit status of the command is ignored.
+func NewExecMenuItemWithOptions(title, tooltip string, cmd string, args []string, opts ...ExecOption) *MenuItem {
+	o := execOptions{
+		onError: func(err error) {
+			log.Printf("systray: unable to run %v: %v", cmd, err)
+		},
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return NewMenuItem(title, WithTooltip(tooltip), WithOnClickedFunc(func() {
+		go func() {
+			c := exec.Command(cmd, args...)
+			c.Dir = o.dir
+			c.Env = o.env
+			if err := c.Start(); err != nil {
+				o.onError(err)
+				return
+			}
+			c.Wait()
+		}()
+	}))
+}
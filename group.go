@@ -0,0 +1,80 @@
+package systray
+
+import (
+	"sync"
+)
+
+// MenuItemGroup is a set of menu items to enable, disable, show or hide
+// together, e.g. all the items of a "File" sub menu while a file is being
+// saved. A menu item may belong to several groups.
+type MenuItemGroup struct {
+	mu    sync.Mutex
+	items []*MenuItem
+}
+
+// NewMenuItemGroup creates a group of the given menu items.
+func NewMenuItemGroup(items ...*MenuItem) *MenuItemGroup {
+	g := &MenuItemGroup{}
+	g.Add(items...)
+	return g
+}
+
+// Add adds menu items to the group, ignoring those already in it.
+func (g *MenuItemGroup) Add(items ...*MenuItem) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for _, item := range items {
+		if !g.contains(item) {
+			g.items = append(g.items, item)
+		}
+	}
+}
+
+// Items returns the menu items of the group, in the order they were added.
+func (g *MenuItemGroup) Items() []*MenuItem {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return append([]*MenuItem(nil), g.items...)
+}
+
+// Enable enables all the menu items of the group, updating the native menu
+// at once, see BatchUpdate.
+func (g *MenuItemGroup) Enable() {
+	g.apply((*MenuItem).Enable)
+}
+
+// Disable disables all the menu items of the group, updating the native menu
+// at once, see BatchUpdate.
+func (g *MenuItemGroup) Disable() {
+	g.apply((*MenuItem).Disable)
+}
+
+// Show shows all the menu items of the group.
+func (g *MenuItemGroup) Show() {
+	g.apply((*MenuItem).Show)
+}
+
+// Hide hides all the menu items of the group.
+func (g *MenuItemGroup) Hide() {
+	g.apply((*MenuItem).Hide)
+}
+
+func (g *MenuItemGroup) contains(item *MenuItem) bool {
+	for _, v := range g.items {
+		if v == item {
+			return true
+		}
+	}
+	return false
+}
+
+// apply calls fn on each menu item of the group within a BatchUpdate. The
+// lock isn't held while calling fn, so that fn may update other groups.
+func (g *MenuItemGroup) apply(fn func(item *MenuItem)) {
+	items := g.Items()
+	BatchUpdate(func() {
+		for _, item := range items {
+			fn(item)
+		}
+	})
+}
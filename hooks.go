@@ -0,0 +1,75 @@
+package systray
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// MenuChangeHook is notified of the menu items added to and removed from the
+// menu, e.g. by plugin hosts keeping track of the menu. Its methods are
+// called synchronously, from the goroutine changing the menu.
+type MenuChangeHook interface {
+	// OnItemAdded is called once the menu item was added to the menu,
+	// separators included.
+	OnItemAdded(item *MenuItem)
+	// OnItemRemoved is called once the menu item was removed from the menu,
+	// after its children.
+	OnItemRemoved(item *MenuItem)
+}
+
+// HookHandle is a registered MenuChangeHook.
+type HookHandle struct {
+	hook MenuChangeHook
+}
+
+var (
+	menuChangeHooks   []*HookHandle
+	muMenuChangeHooks sync.RWMutex
+)
+
+// RegisterMenuChangeHook registers h to be notified of the menu changes from
+// now on. Hooks are called in the order they were registered.
+func RegisterMenuChangeHook(h MenuChangeHook) *HookHandle {
+	handle := &HookHandle{hook: h}
+	muMenuChangeHooks.Lock()
+	defer muMenuChangeHooks.Unlock()
+	// copying on write, as notifications iterate over the slice unlocked
+	menuChangeHooks = append(menuChangeHooks[:len(menuChangeHooks):len(menuChangeHooks)], handle)
+	return handle
+}
+
+// Unregister stops notifying the hook. It can be called more than once.
+func (h *HookHandle) Unregister() {
+	muMenuChangeHooks.Lock()
+	defer muMenuChangeHooks.Unlock()
+	for i, handle := range menuChangeHooks {
+		if handle == h {
+			hooks := make([]*HookHandle, 0, len(menuChangeHooks)-1)
+			hooks = append(hooks, menuChangeHooks[:i]...)
+			menuChangeHooks = append(hooks, menuChangeHooks[i+1:]...)
+			return
+		}
+	}
+}
+
+func currentMenuChangeHooks() []*HookHandle {
+	muMenuChangeHooks.RLock()
+	defer muMenuChangeHooks.RUnlock()
+	return menuChangeHooks
+}
+
+// notifyItemAdded calls the hooks the first time it's called for item.
+func notifyItemAdded(item *MenuItem) {
+	if !atomic.CompareAndSwapInt32(&item.announced, 0, 1) {
+		return
+	}
+	for _, h := range currentMenuChangeHooks() {
+		h.hook.OnItemAdded(item)
+	}
+}
+
+func notifyItemRemoved(item *MenuItem) {
+	for _, h := range currentMenuChangeHooks() {
+		h.hook.OnItemRemoved(item)
+	}
+}
@@ -0,0 +1,210 @@
+package systray
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/bingliu221/systray/internal/keys"
+)
+
+// Modifier is a set of modifier keys to hold for a hotkey.
+type Modifier = keys.Modifier
+
+const (
+	ModCtrl  = keys.ModCtrl
+	ModShift = keys.ModShift
+	// ModAlt is the Option key on macOS.
+	ModAlt = keys.ModAlt
+	// ModSuper is the Windows key on Windows and the Command key on macOS.
+	ModSuper = keys.ModSuper
+)
+
+// Key is the non-modifier key of a hotkey.
+type Key = keys.Key
+
+const (
+	KeyA      = keys.KeyA
+	KeyB      = keys.KeyB
+	KeyC      = keys.KeyC
+	KeyD      = keys.KeyD
+	KeyE      = keys.KeyE
+	KeyF      = keys.KeyF
+	KeyG      = keys.KeyG
+	KeyH      = keys.KeyH
+	KeyI      = keys.KeyI
+	KeyJ      = keys.KeyJ
+	KeyK      = keys.KeyK
+	KeyL      = keys.KeyL
+	KeyM      = keys.KeyM
+	KeyN      = keys.KeyN
+	KeyO      = keys.KeyO
+	KeyP      = keys.KeyP
+	KeyQ      = keys.KeyQ
+	KeyR      = keys.KeyR
+	KeyS      = keys.KeyS
+	KeyT      = keys.KeyT
+	KeyU      = keys.KeyU
+	KeyV      = keys.KeyV
+	KeyW      = keys.KeyW
+	KeyX      = keys.KeyX
+	KeyY      = keys.KeyY
+	KeyZ      = keys.KeyZ
+	Key0      = keys.Key0
+	Key1      = keys.Key1
+	Key2      = keys.Key2
+	Key3      = keys.Key3
+	Key4      = keys.Key4
+	Key5      = keys.Key5
+	Key6      = keys.Key6
+	Key7      = keys.Key7
+	Key8      = keys.Key8
+	Key9      = keys.Key9
+	KeyF1     = keys.KeyF1
+	KeyF2     = keys.KeyF2
+	KeyF3     = keys.KeyF3
+	KeyF4     = keys.KeyF4
+	KeyF5     = keys.KeyF5
+	KeyF6     = keys.KeyF6
+	KeyF7     = keys.KeyF7
+	KeyF8     = keys.KeyF8
+	KeyF9     = keys.KeyF9
+	KeyF10    = keys.KeyF10
+	KeyF11    = keys.KeyF11
+	KeyF12    = keys.KeyF12
+	KeySpace  = keys.KeySpace
+	KeyReturn = keys.KeyReturn
+	KeyEscape = keys.KeyEscape
+	KeyTab    = keys.KeyTab
+	KeyDelete = keys.KeyDelete
+	KeyLeft   = keys.KeyLeft
+	KeyRight  = keys.KeyRight
+	KeyUp     = keys.KeyUp
+	KeyDown   = keys.KeyDown
+)
+
+// ErrHotkeyUnavailable is returned when the platform refuses to register a
+// hotkey, typically because another application already registered it, or
+// when the systray is not running.
+var ErrHotkeyUnavailable = errors.New("systray: hotkey unavailable")
+
+// maxHotkeyID is the largest hotkey ID, as RegisterHotKey only accepts IDs
+// from 0x0000 to 0xBFFF on Windows.
+const maxHotkeyID = 0xBFFF
+
+var (
+	// hotkeys maps the IDs of the menu items with a registered hotkey to the
+	// ID of their hotkey, which is what the platforms are given, and
+	// hotkeyItems maps them back. Menu item IDs can't be used as is, as
+	// WithID allows any.
+	hotkeys     = make(map[uint32]uint32)
+	hotkeyItems = make(map[uint32]uint32)
+	muHotkeys   sync.Mutex
+)
+
+// RegisterHotkey registers a system wide hotkey which invokes the same
+// callback as clicking the menu item, even when the application is not
+// focused, unless the menu item is hidden or disabled, see WithSoftDisable.
+// It replaces the previous hotkey of the menu item, if any. The hotkey is
+// released by UnregisterHotkey, Remove or Quit. It fails unless the systray
+// is running, e.g. in onReady, as registering needs the event loop.
+//
+// It uses RegisterHotKey on Windows, the Carbon hotkey API on macOS and
+// XGrabKey on Linux, where it's therefore unavailable on Wayland.
+func (item *MenuItem) RegisterHotkey(mod Modifier, key Key) error {
+	if item.isRemoved() {
+		return ErrMenuItemRemoved
+	}
+	if !keys.Valid(key) {
+		return fmt.Errorf("systray: unsupported hotkey key %d", key)
+	}
+	if !IsRunning() {
+		// rather than waiting for an event loop which may never run
+		return fmt.Errorf("%w: the systray is not running", ErrHotkeyUnavailable)
+	}
+	muHotkeys.Lock()
+	id, ok := hotkeys[item.id]
+	if !ok {
+		if id, ok = freeHotkeyID(); !ok {
+			muHotkeys.Unlock()
+			return fmt.Errorf("%w: too many hotkeys", ErrHotkeyUnavailable)
+		}
+		// reserved until registered
+		hotkeyItems[id] = item.id
+	}
+	muHotkeys.Unlock()
+	// native calls may wait for the event loop, so don't hold the lock
+	err := registerHotkey(id, mod, key)
+	muHotkeys.Lock()
+	if err != nil {
+		// the platforms release the previous hotkey first
+		delete(hotkeys, item.id)
+		delete(hotkeyItems, id)
+	} else {
+		hotkeys[item.id] = id
+	}
+	muHotkeys.Unlock()
+	if err != nil {
+		return err
+	}
+	if item.isRemoved() {
+		// Remove ran concurrently, before the hotkey was recorded
+		item.UnregisterHotkey()
+		return ErrMenuItemRemoved
+	}
+	return nil
+}
+
+// freeHotkeyID returns the lowest hotkey ID not in use, with muHotkeys held.
+func freeHotkeyID() (uint32, bool) {
+	for id := uint32(1); id <= maxHotkeyID; id++ {
+		if _, used := hotkeyItems[id]; !used {
+			return id, true
+		}
+	}
+	return 0, false
+}
+
+// UnregisterHotkey releases the hotkey of the menu item, if any.
+func (item *MenuItem) UnregisterHotkey() {
+	muHotkeys.Lock()
+	id, registered := hotkeys[item.id]
+	delete(hotkeys, item.id)
+	delete(hotkeyItems, id)
+	muHotkeys.Unlock()
+	if registered {
+		unregisterHotkey(id)
+	}
+}
+
+// unregisterHotkeys releases all the registered hotkeys.
+func unregisterHotkeys() {
+	muHotkeys.Lock()
+	ids := make([]uint32, 0, len(hotkeys))
+	for _, id := range hotkeys {
+		ids = append(ids, id)
+	}
+	hotkeys = make(map[uint32]uint32)
+	hotkeyItems = make(map[uint32]uint32)
+	muHotkeys.Unlock()
+	for _, id := range ids {
+		unregisterHotkey(id)
+	}
+}
+
+// systrayHotkeyPressed is called by the platforms when the hotkey with the
+// given ID is pressed. Unlike clicks, hotkeys may fire while the menu item
+// is hidden or disabled, which invokes nothing.
+func systrayHotkeyPressed(id uint32) {
+	muHotkeys.Lock()
+	itemID, ok := hotkeyItems[id]
+	muHotkeys.Unlock()
+	if !ok {
+		return
+	}
+	item, ok := GetMenuItemByID(itemID)
+	if !ok || !item.IsVisible() || (item.IsDisabled() && !item.softDisabled) {
+		return
+	}
+	systrayMenuItemSelected(itemID)
+}
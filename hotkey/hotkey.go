@@ -0,0 +1,167 @@
+// Package hotkey registers system wide hotkeys, which fire even when the
+// application is not focused. Unlike MenuItem.RegisterHotkey in the systray
+// package, hotkeys aren't tied to menu items and don't need the systray event
+// loop: each platform runs its own in the background.
+//
+// It uses RegisterHotKey on Windows, a Quartz event tap on macOS, which needs
+// the application to be granted Input Monitoring, and XGrabKey on Linux, where
+// it's therefore unavailable on Wayland. Register returns ErrUnavailable on
+// Linux and macOS when built without cgo.
+package hotkey
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/bingliu221/systray/internal/keys"
+)
+
+// Modifiers is a set of modifier keys to hold for a hotkey.
+type Modifiers = keys.Modifier
+
+const (
+	ModCtrl  = keys.ModCtrl
+	ModShift = keys.ModShift
+	// ModAlt is the Option key on macOS.
+	ModAlt = keys.ModAlt
+	// ModSuper is the Windows key on Windows and the Command key on macOS.
+	ModSuper = keys.ModSuper
+)
+
+// Key is the non-modifier key of a hotkey.
+type Key = keys.Key
+
+const (
+	KeyA      = keys.KeyA
+	KeyB      = keys.KeyB
+	KeyC      = keys.KeyC
+	KeyD      = keys.KeyD
+	KeyE      = keys.KeyE
+	KeyF      = keys.KeyF
+	KeyG      = keys.KeyG
+	KeyH      = keys.KeyH
+	KeyI      = keys.KeyI
+	KeyJ      = keys.KeyJ
+	KeyK      = keys.KeyK
+	KeyL      = keys.KeyL
+	KeyM      = keys.KeyM
+	KeyN      = keys.KeyN
+	KeyO      = keys.KeyO
+	KeyP      = keys.KeyP
+	KeyQ      = keys.KeyQ
+	KeyR      = keys.KeyR
+	KeyS      = keys.KeyS
+	KeyT      = keys.KeyT
+	KeyU      = keys.KeyU
+	KeyV      = keys.KeyV
+	KeyW      = keys.KeyW
+	KeyX      = keys.KeyX
+	KeyY      = keys.KeyY
+	KeyZ      = keys.KeyZ
+	Key0      = keys.Key0
+	Key1      = keys.Key1
+	Key2      = keys.Key2
+	Key3      = keys.Key3
+	Key4      = keys.Key4
+	Key5      = keys.Key5
+	Key6      = keys.Key6
+	Key7      = keys.Key7
+	Key8      = keys.Key8
+	Key9      = keys.Key9
+	KeyF1     = keys.KeyF1
+	KeyF2     = keys.KeyF2
+	KeyF3     = keys.KeyF3
+	KeyF4     = keys.KeyF4
+	KeyF5     = keys.KeyF5
+	KeyF6     = keys.KeyF6
+	KeyF7     = keys.KeyF7
+	KeyF8     = keys.KeyF8
+	KeyF9     = keys.KeyF9
+	KeyF10    = keys.KeyF10
+	KeyF11    = keys.KeyF11
+	KeyF12    = keys.KeyF12
+	KeySpace  = keys.KeySpace
+	KeyReturn = keys.KeyReturn
+	KeyEscape = keys.KeyEscape
+	KeyTab    = keys.KeyTab
+	KeyDelete = keys.KeyDelete
+	KeyLeft   = keys.KeyLeft
+	KeyRight  = keys.KeyRight
+	KeyUp     = keys.KeyUp
+	KeyDown   = keys.KeyDown
+)
+
+var (
+	// ErrUnavailable is returned when the platform refuses to register a
+	// hotkey, typically because another application already registered it.
+	ErrUnavailable = errors.New("hotkey: hotkey unavailable")
+	// ErrUnregistered is returned when unregistering a hotkey twice.
+	ErrUnregistered = errors.New("hotkey: hotkey not registered")
+)
+
+// Hotkey is a registered hotkey.
+type Hotkey struct {
+	id  int
+	mod Modifiers
+	key Key
+	c   chan struct{}
+}
+
+var (
+	hotkeys   = make(map[int]*Hotkey)
+	nextID    = 1
+	muHotkeys sync.Mutex
+)
+
+// Register registers the system wide hotkey made of key and the modifiers
+// mod, see C to get notified of the presses.
+func Register(mod Modifiers, key Key) (*Hotkey, error) {
+	if !keys.Valid(key) {
+		return nil, fmt.Errorf("hotkey: unsupported key %d", key)
+	}
+	muHotkeys.Lock()
+	h := &Hotkey{id: nextID, mod: mod, key: key, c: make(chan struct{}, 1)}
+	nextID++
+	hotkeys[h.id] = h
+	muHotkeys.Unlock()
+	if err := register(h); err != nil {
+		muHotkeys.Lock()
+		delete(hotkeys, h.id)
+		muHotkeys.Unlock()
+		return nil, err
+	}
+	return h, nil
+}
+
+// C returns the channel receiving a value each time the hotkey is pressed.
+// Presses are dropped while a previous one is still pending in the channel.
+func (h *Hotkey) C() <-chan struct{} {
+	return h.c
+}
+
+// Unregister releases the hotkey. The channel returned by C is left open.
+func (h *Hotkey) Unregister() error {
+	muHotkeys.Lock()
+	_, ok := hotkeys[h.id]
+	delete(hotkeys, h.id)
+	muHotkeys.Unlock()
+	if !ok {
+		return ErrUnregistered
+	}
+	return unregister(h)
+}
+
+// pressed notifies the hotkey with the given ID, if still registered.
+func pressed(id int) {
+	muHotkeys.Lock()
+	h := hotkeys[id]
+	muHotkeys.Unlock()
+	if h == nil {
+		return
+	}
+	select {
+	case h.c <- struct{}{}:
+	default:
+	}
+}
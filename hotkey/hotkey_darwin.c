@@ -0,0 +1,42 @@
+//go:build cgo
+
+#include <ApplicationServices/ApplicationServices.h>
+#include "_cgo_export.h"
+
+static CFMachPortRef tap = NULL;
+
+static CGEventRef on_event(CGEventTapProxy proxy, CGEventType type,
+                           CGEventRef event, void *refcon) {
+    // the system disables taps which take too long to handle an event
+    if (type == kCGEventTapDisabledByTimeout ||
+        type == kCGEventTapDisabledByUserInput) {
+        CGEventTapEnable(tap, true);
+        return event;
+    }
+    if (type == kCGEventKeyDown &&
+        CGEventGetIntegerValueField(event, kCGKeyboardEventAutorepeat) == 0) {
+        hotkey_key_down(
+            (int)CGEventGetIntegerValueField(event, kCGKeyboardEventKeycode),
+            (unsigned long long)CGEventGetFlags(event));
+    }
+    return event;
+}
+
+// creates the event tap in the run loop of the calling thread, returning 0 if
+// it's not allowed to
+int create_event_tap(void) {
+    tap = CGEventTapCreate(kCGSessionEventTap, kCGHeadInsertEventTap,
+                           kCGEventTapOptionListenOnly,
+                           CGEventMaskBit(kCGEventKeyDown), on_event, NULL);
+    if (tap == NULL) {
+        return 0;
+    }
+    CFRunLoopSourceRef source =
+        CFMachPortCreateRunLoopSource(kCFAllocatorDefault, tap, 0);
+    CFRunLoopAddSource(CFRunLoopGetCurrent(), source, kCFRunLoopCommonModes);
+    CFRelease(source);
+    CGEventTapEnable(tap, true);
+    return 1;
+}
+
+void run_event_tap(void) { CFRunLoopRun(); }
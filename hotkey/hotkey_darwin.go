@@ -0,0 +1,86 @@
+//go:build cgo
+
+package hotkey
+
+/*
+#cgo LDFLAGS: -framework ApplicationServices -framework CoreFoundation
+
+int create_event_tap(void);
+void run_event_tap(void);
+*/
+import "C"
+
+import (
+	"errors"
+	"runtime"
+	"sync"
+
+	"github.com/bingliu221/systray/internal/keys"
+)
+
+// press is the key code and modifiers of a key press.
+type press struct {
+	keycode int
+	flags   uint64
+}
+
+var (
+	startErr  error
+	startOnce sync.Once
+	presses   = make(map[int]press)
+	muPresses sync.RWMutex
+)
+
+// start listens to key presses with an event tap, in a thread of its own.
+func start() {
+	created := make(chan bool)
+	go func() {
+		runtime.LockOSThread()
+		ok := C.create_event_tap() != 0
+		created <- ok
+		if ok {
+			C.run_event_tap()
+		}
+	}()
+	if !<-created {
+		startErr = errors.New("hotkey: unable to listen to key presses, Input Monitoring may not be granted")
+	}
+}
+
+// The event tap only listens, so key presses still reach the focused
+// application, and there's no telling whether another application uses the
+// same hotkey.
+func register(h *Hotkey) error {
+	startOnce.Do(start)
+	if startErr != nil {
+		return startErr
+	}
+	flags, keycode := keys.EventTap(h.mod, h.key)
+	muPresses.Lock()
+	presses[h.id] = press{int(keycode), flags}
+	muPresses.Unlock()
+	return nil
+}
+
+func unregister(h *Hotkey) error {
+	muPresses.Lock()
+	delete(presses, h.id)
+	muPresses.Unlock()
+	return nil
+}
+
+//export hotkey_key_down
+func hotkey_key_down(keycode C.int, flags C.ulonglong) {
+	p := press{int(keycode), uint64(flags) & keys.EventFlagsMask}
+	muPresses.RLock()
+	var ids []int
+	for id, registered := range presses {
+		if registered == p {
+			ids = append(ids, id)
+		}
+	}
+	muPresses.RUnlock()
+	for _, id := range ids {
+		pressed(id)
+	}
+}
@@ -0,0 +1,241 @@
+//go:build cgo
+
+package hotkey
+
+/*
+#cgo LDFLAGS: -lX11
+
+#include <X11/Xlib.h>
+#include <errno.h>
+#include <poll.h>
+#include <unistd.h>
+
+// hotkeys have to be grabbed with the lock modifiers as well, otherwise they
+// don't fire while Caps Lock or Num Lock is on
+static const unsigned int lock_masks[] = {0, LockMask, Mod2Mask,
+                                          LockMask | Mod2Mask};
+
+static int grab_error = 0;
+static Display *grab_display = NULL;
+static XErrorHandler previous_handler = NULL;
+
+// the error handler is process wide, so the errors of other connections, e.g.
+// the one of GTK, are passed on to the handler it replaced
+static int on_grab_error(Display *display, XErrorEvent *event) {
+    if (display != grab_display) {
+        return previous_handler != NULL ? previous_handler(display, event) : 0;
+    }
+    grab_error = event->error_code;
+    return 0;
+}
+
+static void ungrab(Display *display, int keycode, unsigned int modifiers) {
+    for (int i = 0; i < 4; i++) {
+        XUngrabKey(display, keycode, modifiers | lock_masks[i],
+                   DefaultRootWindow(display));
+    }
+    XSync(display, False);
+}
+
+// returns the keycode of the grabbed key, or 0 if it could not be grabbed
+static int grab(Display *display, unsigned int modifiers, unsigned long keysym) {
+    KeyCode keycode = XKeysymToKeycode(display, keysym);
+    if (keycode == 0) {
+        return 0;
+    }
+    // the grab fails asynchronously with BadAccess if another client
+    // already grabbed the key
+    grab_error = 0;
+    grab_display = display;
+    previous_handler = XSetErrorHandler(on_grab_error);
+    for (int i = 0; i < 4; i++) {
+        XGrabKey(display, keycode, modifiers | lock_masks[i],
+                 DefaultRootWindow(display), False, GrabModeAsync,
+                 GrabModeAsync);
+    }
+    XSync(display, False);
+    XSetErrorHandler(previous_handler);
+    previous_handler = NULL;
+    if (grab_error != 0) {
+        ungrab(display, keycode, modifiers);
+        return 0;
+    }
+    return keycode;
+}
+
+// waits for a key press, returning 1 with its keycode and modifiers, or for
+// wake_fd to be written to, returning 0. It returns -1 on error.
+static int wait_key_press(Display *display, int wake_fd, unsigned int *keycode,
+                          unsigned int *modifiers) {
+    for (;;) {
+        while (XPending(display) > 0) {
+            XEvent event;
+            XNextEvent(display, &event);
+            if (event.type == KeyPress) {
+                *keycode = event.xkey.keycode;
+                *modifiers = event.xkey.state & ~(LockMask | Mod2Mask);
+                return 1;
+            }
+        }
+        struct pollfd fds[2] = {{ConnectionNumber(display), POLLIN, 0},
+                                {wake_fd, POLLIN, 0}};
+        if (poll(fds, 2, -1) < 0) {
+            if (errno == EINTR) {
+                continue;
+            }
+            return -1;
+        }
+        if (fds[1].revents & POLLIN) {
+            char buf[64];
+            read(wake_fd, buf, sizeof(buf));
+            return 0;
+        }
+    }
+}
+*/
+import "C"
+
+import (
+	"errors"
+	"runtime"
+	"sync"
+	"syscall"
+
+	"github.com/bingliu221/systray/internal/keys"
+)
+
+// request is a function to run in the thread of the event loop, which
+// reports on done whether it ran.
+type request struct {
+	fn   func()
+	done chan error
+}
+
+// errLoopStopped is returned once the event loop stopped, after an error of
+// the connection to the X server.
+var errLoopStopped = errors.New("hotkey: lost the connection to the X display")
+
+// grab is a key grabbed for a hotkey.
+type grab struct {
+	keycode   C.int
+	modifiers C.uint
+}
+
+var (
+	// display is the connection to the X server, used only from the thread
+	// started by start, distinct from the one of GTK
+	display *C.Display
+	// wakeR and wakeW are a pipe to wake the thread up to run the pending
+	// requests
+	wakeR, wakeW int
+	startErr     error
+	startOnce    sync.Once
+	requests     []request
+	// loopErr is set once the event loop stopped, guarded by muRequests
+	loopErr    error
+	muRequests sync.Mutex
+	// grabs are only accessed from the thread
+	grabs = make(map[int]grab)
+)
+
+// start runs the event loop in a thread of its own.
+func start() {
+	// the display is used from a thread of its own while GTK uses another
+	// one. Xlib 1.8 makes the call itself before any other, earlier ones need
+	// it to be called before the connection is opened.
+	if C.XInitThreads() == 0 {
+		startErr = errors.New("hotkey: Xlib has no thread support")
+		return
+	}
+	display = C.XOpenDisplay(nil)
+	if display == nil {
+		// e.g. on Wayland without XWayland
+		startErr = errors.New("hotkey: unable to open the X display")
+		return
+	}
+	var fds [2]int
+	if err := syscall.Pipe(fds[:]); err != nil {
+		startErr = err
+		return
+	}
+	wakeR, wakeW = fds[0], fds[1]
+	go func() {
+		runtime.LockOSThread()
+		var keycode, modifiers C.uint
+		for {
+			switch C.wait_key_press(display, C.int(wakeR), &keycode, &modifiers) {
+			case 1:
+				for id, g := range grabs {
+					if C.uint(g.keycode) == keycode && g.modifiers == modifiers {
+						pressed(id)
+					}
+				}
+			case 0:
+				muRequests.Lock()
+				pending := requests
+				requests = nil
+				muRequests.Unlock()
+				for _, r := range pending {
+					r.fn()
+					r.done <- nil
+				}
+			default:
+				muRequests.Lock()
+				loopErr = errLoopStopped
+				pending := requests
+				requests = nil
+				muRequests.Unlock()
+				for _, r := range pending {
+					r.done <- errLoopStopped
+				}
+				return
+			}
+		}
+	}()
+}
+
+// runInThread runs fn in the thread of the event loop and waits for it. It
+// returns an error without running fn if the event loop stopped.
+func runInThread(fn func()) error {
+	startOnce.Do(start)
+	if startErr != nil {
+		return startErr
+	}
+	done := make(chan error, 1)
+	muRequests.Lock()
+	if loopErr != nil {
+		muRequests.Unlock()
+		return loopErr
+	}
+	requests = append(requests, request{fn, done})
+	muRequests.Unlock()
+	syscall.Write(wakeW, []byte{0})
+	return <-done
+}
+
+func register(h *Hotkey) error {
+	mods, keysym := keys.X11(h.mod, h.key)
+	var keycode C.int
+	err := runInThread(func() {
+		keycode = C.grab(display, C.uint(mods), C.ulong(keysym))
+		if keycode != 0 {
+			grabs[h.id] = grab{keycode, C.uint(mods)}
+		}
+	})
+	if err != nil {
+		return err
+	}
+	if keycode == 0 {
+		return ErrUnavailable
+	}
+	return nil
+}
+
+func unregister(h *Hotkey) error {
+	return runInThread(func() {
+		if g, ok := grabs[h.id]; ok {
+			C.ungrab(display, g.keycode, g.modifiers)
+			delete(grabs, h.id)
+		}
+	})
+}
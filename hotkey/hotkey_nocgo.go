@@ -0,0 +1,14 @@
+//go:build (linux || darwin) && !cgo
+
+package hotkey
+
+// Hotkeys need cgo on Linux and macOS, to grab keys from the X server and to
+// listen to key presses with an event tap.
+
+func register(h *Hotkey) error {
+	return ErrUnavailable
+}
+
+func unregister(h *Hotkey) error {
+	return nil
+}
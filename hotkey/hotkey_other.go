@@ -0,0 +1,15 @@
+//go:build !windows && !linux && !darwin
+
+package hotkey
+
+import (
+	"errors"
+)
+
+func register(h *Hotkey) error {
+	return errors.New("hotkey: unsupported platform")
+}
+
+func unregister(h *Hotkey) error {
+	return nil
+}
@@ -0,0 +1,119 @@
+package hotkey
+
+import (
+	"runtime"
+	"sync"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+
+	"github.com/bingliu221/systray/internal/keys"
+)
+
+var (
+	k32                 = windows.NewLazySystemDLL("Kernel32.dll")
+	pGetCurrentThreadId = k32.NewProc("GetCurrentThreadId")
+
+	u32                = windows.NewLazySystemDLL("User32.dll")
+	pGetMessage        = u32.NewProc("GetMessageW")
+	pPeekMessage       = u32.NewProc("PeekMessageW")
+	pPostThreadMessage = u32.NewProc("PostThreadMessageW")
+	pRegisterHotKey    = u32.NewProc("RegisterHotKey")
+	pUnregisterHotKey  = u32.NewProc("UnregisterHotKey")
+)
+
+const (
+	WM_HOTKEY = 0x0312
+	// WM_APP wakes the thread up to run the pending requests
+	WM_APP = 0x8000
+)
+
+// https://docs.microsoft.com/en-us/windows/win32/api/winuser/ns-winuser-msg
+type msg struct {
+	WindowHandle windows.Handle
+	Message      uint32
+	Wparam       uintptr
+	Lparam       uintptr
+	Time         uint32
+	Pt           struct{ X, Y int32 }
+}
+
+var (
+	// threadID is the thread running the message loop, as hotkeys are
+	// delivered to the thread which registered them
+	threadID   uintptr
+	startOnce  sync.Once
+	requests   []func()
+	muRequests sync.Mutex
+)
+
+// start runs the message loop in a thread of its own.
+func start() {
+	started := make(chan struct{})
+	go func() {
+		runtime.LockOSThread()
+		threadID, _, _ = pGetCurrentThreadId.Call()
+		// makes the system create the message queue of the thread
+		var m msg
+		const PM_NOREMOVE = 0x0000
+		pPeekMessage.Call(uintptr(unsafe.Pointer(&m)), 0, WM_APP, WM_APP, PM_NOREMOVE)
+		close(started)
+		for {
+			res, _, _ := pGetMessage.Call(uintptr(unsafe.Pointer(&m)), 0, 0, 0)
+			if int32(res) <= 0 {
+				return
+			}
+			switch m.Message {
+			case WM_HOTKEY:
+				pressed(int(m.Wparam))
+			case WM_APP:
+				muRequests.Lock()
+				pending := requests
+				requests = nil
+				muRequests.Unlock()
+				for _, fn := range pending {
+					fn()
+				}
+			}
+		}
+	}()
+	<-started
+}
+
+// runInThread runs fn in the thread of the message loop and waits for it.
+func runInThread(fn func()) {
+	startOnce.Do(start)
+	done := make(chan struct{})
+	muRequests.Lock()
+	requests = append(requests, func() {
+		defer close(done)
+		fn()
+	})
+	muRequests.Unlock()
+	pPostThreadMessage.Call(threadID, WM_APP, 0, 0)
+	<-done
+}
+
+func register(h *Hotkey) error {
+	mods, vk := keys.Win32(h.mod, h.key)
+	var res uintptr
+	runInThread(func() {
+		res, _, _ = pRegisterHotKey.Call(0, uintptr(h.id), uintptr(mods), uintptr(vk))
+	})
+	if res == 0 {
+		return ErrUnavailable
+	}
+	return nil
+}
+
+func unregister(h *Hotkey) error {
+	var res uintptr
+	var err error
+	runInThread(func() {
+		res, _, err = pUnregisterHotKey.Call(0, uintptr(h.id))
+	})
+	if res == 0 {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,8 @@
+package systray
+
+import "github.com/bingliu221/systray/internal/keys"
+
+// nativeHotkey converts a hotkey for RegisterEventHotKey.
+func nativeHotkey(mod Modifier, key Key) (uint32, uint32) {
+	return keys.Carbon(mod, key)
+}
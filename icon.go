@@ -0,0 +1,365 @@
+package systray
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrEmptyIcon is returned when no icon data is given.
+	ErrEmptyIcon = errors.New("systray: empty icon data")
+	// ErrUnsupportedIconFormat is returned when the icon data is not in one
+	// of the image formats systray recognizes.
+	ErrUnsupportedIconFormat = errors.New("systray: unsupported icon format")
+	// ErrIconRejected is returned when the platform fails to load the icon
+	// data even though its format is recognized.
+	ErrIconRejected = errors.New("systray: icon rejected by the platform")
+	// ErrIconTooLarge is returned when the icon data read from a stream
+	// exceeds maxIconSize.
+	ErrIconTooLarge = errors.New("systray: icon data too large")
+)
+
+// maxIconSize is the maximum size of the icon data read by SetIconFromReader,
+// far beyond any sensible tray icon.
+const maxIconSize = 4 << 20
+
+// iconFormat is the image format of icon data, detected from its magic bytes.
+type iconFormat int
+
+const (
+	iconFormatUnknown iconFormat = iota
+	iconFormatPNG
+	iconFormatICO
+	iconFormatJPEG
+	iconFormatGIF
+	iconFormatICNS
+)
+
+var (
+	pngMagic  = []byte("\x89PNG\r\n\x1a\n")
+	icoMagic  = []byte{0x00, 0x00, 0x01, 0x00}
+	jpegMagic = []byte{0xff, 0xd8, 0xff}
+	icnsMagic = []byte("icns")
+)
+
+// detectIconFormat guesses the image format of iconBytes.
+func detectIconFormat(iconBytes []byte) iconFormat {
+	switch {
+	case bytes.HasPrefix(iconBytes, pngMagic):
+		return iconFormatPNG
+	case bytes.HasPrefix(iconBytes, icoMagic):
+		return iconFormatICO
+	case bytes.HasPrefix(iconBytes, jpegMagic):
+		return iconFormatJPEG
+	case bytes.HasPrefix(iconBytes, []byte("GIF87a")), bytes.HasPrefix(iconBytes, []byte("GIF89a")):
+		return iconFormatGIF
+	case bytes.HasPrefix(iconBytes, icnsMagic):
+		return iconFormatICNS
+	}
+	return iconFormatUnknown
+}
+
+// iconAsPNG returns the largest image of .icns or .ico data as a PNG, for
+// platforms which can't load these formats or would pick a smaller image, and
+// other data as is. .icns images are only extracted when stored as PNG, as
+// they are from 256x256 up, an error being returned if there is none. .ico
+// data is returned as is unless its largest image is stored as PNG, leaving
+// images stored as bitmaps to the platform.
+func iconAsPNG(iconBytes []byte) ([]byte, error) {
+	switch detectIconFormat(iconBytes) {
+	case iconFormatICNS:
+		if img := largestICNSImage(iconBytes); img != nil {
+			return img, nil
+		}
+		return nil, ErrUnsupportedIconFormat
+	case iconFormatICO:
+		if img := largestICOImage(iconBytes); bytes.HasPrefix(img, pngMagic) {
+			return img, nil
+		}
+	}
+	return iconBytes, nil
+}
+
+// largestICNSImage returns the widest of the PNG images of .icns data, nil if
+// there is none. .icns data is made of a header and elements, each with a 4
+// byte type and a 4 byte big endian length including these 8 bytes.
+func largestICNSImage(icns []byte) []byte {
+	if len(icns) < 8 {
+		return nil
+	}
+	var largest []byte
+	var largestWidth uint32
+	for data := icns[8:]; len(data) >= 8; {
+		length := binary.BigEndian.Uint32(data[4:8])
+		if length < 8 || uint64(length) > uint64(len(data)) {
+			break
+		}
+		img := data[8:length]
+		data = data[length:]
+		if !bytes.HasPrefix(img, pngMagic) || len(img) < 24 {
+			continue
+		}
+		// the width is in the IHDR chunk, right after the magic bytes
+		if width := binary.BigEndian.Uint32(img[16:20]); largest == nil || width > largestWidth {
+			largest, largestWidth = img, width
+		}
+	}
+	return largest
+}
+
+// largestICOImage returns the data of the widest image of .ico data, the one
+// with the most bytes among those of the same width, nil if the data is
+// invalid.
+func largestICOImage(ico []byte) []byte {
+	const headerSize, entrySize = 6, 16
+	if len(ico) < headerSize {
+		return nil
+	}
+	count := int(binary.LittleEndian.Uint16(ico[4:6]))
+	var largest []byte
+	largestWidth := 0
+	for i := 0; i < count; i++ {
+		if headerSize+(i+1)*entrySize > len(ico) {
+			break
+		}
+		entry := ico[headerSize+i*entrySize:]
+		// the width is stored in a byte, 0 meaning 256 or more
+		width := int(entry[0])
+		if width == 0 {
+			width = 256
+		}
+		size := binary.LittleEndian.Uint32(entry[8:12])
+		offset := binary.LittleEndian.Uint32(entry[12:16])
+		if uint64(offset)+uint64(size) > uint64(len(ico)) {
+			continue
+		}
+		img := ico[offset : offset+size]
+		if largest == nil || width > largestWidth || width == largestWidth && len(img) > len(largest) {
+			largest, largestWidth = img, width
+		}
+	}
+	return largest
+}
+
+// pngToICO wraps PNG data into an .ico file, which may embed PNG images since
+// Windows Vista, keeping their alpha channel.
+func pngToICO(pngBytes []byte) []byte {
+	const headerSize = 6 + 16
+	// the size is in the IHDR chunk, right after the magic bytes
+	var width, height uint32
+	if len(pngBytes) >= 24 {
+		width = binary.BigEndian.Uint32(pngBytes[16:20])
+		height = binary.BigEndian.Uint32(pngBytes[20:24])
+	}
+	// sizes are stored in a byte, 0 meaning 256 or more
+	sizeByte := func(size uint32) byte {
+		if size >= 256 {
+			return 0
+		}
+		return byte(size)
+	}
+	ico := make([]byte, headerSize, headerSize+len(pngBytes))
+	// ICONDIR: reserved, type 1 for icons and number of images
+	binary.LittleEndian.PutUint16(ico[2:], 1)
+	binary.LittleEndian.PutUint16(ico[4:], 1)
+	// ICONDIRENTRY: size, palette size, reserved, planes, bits per pixel,
+	// data size and data offset
+	ico[6] = sizeByte(width)
+	ico[7] = sizeByte(height)
+	binary.LittleEndian.PutUint16(ico[10:], 1)
+	binary.LittleEndian.PutUint16(ico[12:], 32)
+	binary.LittleEndian.PutUint32(ico[14:], uint32(len(pngBytes)))
+	binary.LittleEndian.PutUint32(ico[18:], headerSize)
+	return append(ico, pngBytes...)
+}
+
+// validateIcon checks that iconBytes looks like an image before handing it
+// to the native layer, which may only fail asynchronously.
+func validateIcon(iconBytes []byte) error {
+	if len(iconBytes) == 0 {
+		return ErrEmptyIcon
+	}
+	if detectIconFormat(iconBytes) == iconFormatUnknown {
+		return ErrUnsupportedIconFormat
+	}
+	return nil
+}
+
+var (
+	// iconWidth and iconHeight are the size of the tray icon declared by
+	// SetIconSize, 0 if not declared
+	iconWidth, iconHeight int
+	muIconSize            sync.RWMutex
+)
+
+// SetIconSize declares the size in pixels of the tray icons passed to the
+// following calls of SetIcon and friends, so that the platform can use them
+// as is rather than scaling them, which blurs them when they already have the
+// right size. On Windows, it picks the image of that size in .ico files. On
+// macOS, it's the size in points, so a 32x32 image declared as 16x16 renders
+// crisply on Retina displays. Linux indicator hosts scale icons themselves.
+// Pass 0 for both to let the platform pick the size again.
+func SetIconSize(width, height int) {
+	muIconSize.Lock()
+	iconWidth, iconHeight = width, height
+	muIconSize.Unlock()
+}
+
+// trayIconSize returns the size declared by SetIconSize.
+func trayIconSize() (width, height int) {
+	muIconSize.RLock()
+	defer muIconSize.RUnlock()
+	return iconWidth, iconHeight
+}
+
+// SetIcon sets the systray icon. It can be called at any time after the
+// systray is ready, from any goroutine, to swap the icon at runtime.
+// iconBytes should be the content of .ico/.png for windows and .ico/.jpg/.png
+// for other platforms. .icns data is accepted too: macOS loads it as is, like
+// .ico data, and the other platforms use its largest image, which must be
+// stored as PNG. On Linux, the largest image of .ico data is used as well. An
+// error is returned if iconBytes is not a recognized image or the platform
+// fails to load it. It clears the status set by SetStatusColor.
+func SetIcon(iconBytes []byte) error {
+	if err := validateIcon(iconBytes); err != nil {
+		return err
+	}
+	clearStatusColor()
+	stopIconAnimation()
+	return setIcon(iconBytes)
+}
+
+// SetIconFromFile reads the icon from the file at path and sets it as the
+// systray icon, see SetIcon. The returned error tells whether the file could
+// not be read, is not in a supported format or was rejected by the platform.
+func SetIconFromFile(path string) error {
+	iconBytes, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("systray: unable to read icon file: %w", err)
+	}
+	if err := SetIcon(iconBytes); err != nil {
+		return fmt.Errorf("%w: %s", err, path)
+	}
+	return nil
+}
+
+// SetIconFromReader reads the icon from r until EOF and sets it as the
+// systray icon, see SetIcon. At most 4 MB are read, ErrIconTooLarge being
+// returned beyond that. The returned error also tells whether r failed, or
+// the data is not in a supported format or was rejected by the platform.
+func SetIconFromReader(r io.Reader) error {
+	iconBytes, err := io.ReadAll(io.LimitReader(r, maxIconSize+1))
+	if err != nil {
+		return fmt.Errorf("systray: unable to read icon: %w", err)
+	}
+	if len(iconBytes) > maxIconSize {
+		return ErrIconTooLarge
+	}
+	return SetIcon(iconBytes)
+}
+
+// SetIconFromFS reads the icon from the file at path in fsys, e.g. an
+// embed.FS or os.DirFS, and sets it as the systray icon, see SetIcon.
+func SetIconFromFS(fsys fs.FS, path string) error {
+	iconBytes, err := fs.ReadFile(fsys, path)
+	if err != nil {
+		return fmt.Errorf("systray: unable to read icon file: %w", err)
+	}
+	if err := SetIcon(iconBytes); err != nil {
+		return fmt.Errorf("%w: %s", err, path)
+	}
+	return nil
+}
+
+// iconAnimation cycles the systray icon through a set of frames until stopped.
+type iconAnimation struct {
+	frames   [][]byte
+	interval time.Duration
+	stop     chan struct{}
+	// done is closed once run returned
+	done chan struct{}
+}
+
+var (
+	animation   *iconAnimation
+	muAnimation sync.Mutex
+)
+
+func (a *iconAnimation) run() {
+	defer close(a.done)
+	ticker := time.NewTicker(a.interval)
+	defer ticker.Stop()
+	for i := 0; ; i = (i + 1) % len(a.frames) {
+		select {
+		case <-a.stop:
+			return
+		default:
+		}
+		setIcon(a.frames[i])
+		select {
+		case <-a.stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// stopIconAnimation stops the running icon animation if any, and waits for
+// it to exit, so that it can't set a frame over the icon set next. Setting a
+// frame never waits for the event loop, which may be the caller.
+func stopIconAnimation() {
+	muAnimation.Lock()
+	a := animation
+	animation = nil
+	muAnimation.Unlock()
+	a.stopAndWait()
+}
+
+// stopAndWait stops the animation a, if not nil, and waits for it to exit.
+func (a *iconAnimation) stopAndWait() {
+	if a == nil {
+		return
+	}
+	close(a.stop)
+	<-a.done
+}
+
+// SetAnimatedIcon cycles the systray icon through frames, showing each of
+// them for intervalMs milliseconds, until SetIcon or SetAnimatedIcon is
+// called again or the systray quits. All frames are validated upfront, see
+// SetIcon for the accepted formats.
+func SetAnimatedIcon(frames [][]byte, intervalMs int) error {
+	if len(frames) == 0 {
+		return ErrEmptyIcon
+	}
+	if intervalMs <= 0 {
+		return fmt.Errorf("systray: invalid animation interval %dms", intervalMs)
+	}
+	for i, frame := range frames {
+		if err := validateIcon(frame); err != nil {
+			return fmt.Errorf("%w: frame %d", err, i)
+		}
+	}
+
+	a := &iconAnimation{
+		frames:   append([][]byte(nil), frames...),
+		interval: time.Duration(intervalMs) * time.Millisecond,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	muAnimation.Lock()
+	previous := animation
+	animation = a
+	muAnimation.Unlock()
+	previous.stopAndWait()
+
+	go a.run()
+	return nil
+}
@@ -0,0 +1,51 @@
+//go:build !systray_fake
+
+package systray
+
+// #include "systray.h"
+import "C"
+
+import (
+	"unsafe"
+)
+
+// SetIconTemplate sets the systray icon as a template image, which macOS
+// renders in black or white to match the appearance of the menu bar, so
+// iconBytes should only use black and transparency, like the images named
+// with the "Template" suffix. Like SetIcon, it clears the status set by
+// SetStatusColor. It's a no-op on other platforms, see SetTemplateIcon, which
+// sets the template icon the same way on macOS, to fall back to a regular
+// icon there.
+func SetIconTemplate(iconBytes []byte) error {
+	if err := validateIcon(iconBytes); err != nil {
+		return err
+	}
+	clearStatusColor()
+	stopIconAnimation()
+	cstr := (*C.char)(unsafe.Pointer(&iconBytes[0]))
+	width, height := trayIconSize()
+	if !C.setIcon(cstr, (C.int)(len(iconBytes)), true, C.int(width), C.int(height)) {
+		return ErrIconRejected
+	}
+	return nil
+}
+
+// SetIconHighlighted sets the icon shown instead of the systray icon while
+// the menu is open, see SetIcon for the accepted formats. A nil iconBytes
+// shows the systray icon again. It's a no-op on other platforms, where the
+// system highlights the icon itself.
+func SetIconHighlighted(iconBytes []byte) error {
+	if iconBytes == nil {
+		C.set_icon_highlighted(nil, 0, C.int(0), C.int(0))
+		return nil
+	}
+	if err := validateIcon(iconBytes); err != nil {
+		return err
+	}
+	cstr := (*C.char)(unsafe.Pointer(&iconBytes[0]))
+	width, height := trayIconSize()
+	if !C.set_icon_highlighted(cstr, (C.int)(len(iconBytes)), C.int(width), C.int(height)) {
+		return ErrIconRejected
+	}
+	return nil
+}
@@ -0,0 +1,17 @@
+//go:build !darwin || systray_fake
+
+package systray
+
+// SetIconTemplate sets the systray icon as a template image on macOS. It's a
+// no-op on other platforms, see SetTemplateIcon to fall back to a regular
+// icon there.
+func SetIconTemplate(iconBytes []byte) error {
+	return nil
+}
+
+// SetIconHighlighted sets the icon shown instead of the systray icon while
+// the menu is open on macOS. It's a no-op on other platforms, where the system
+// highlights the icon itself.
+func SetIconHighlighted(iconBytes []byte) error {
+	return nil
+}
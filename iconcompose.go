@@ -0,0 +1,197 @@
+package systray
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"math"
+)
+
+// Icon is an image to be composited into a tray icon, e.g. a base icon with
+// a badge and a progress arc drawn over it, before being set with SetIcon or
+// SetIconImage. Icons are immutable: the Draw methods return new Icons,
+// leaving the icon they're called on unchanged.
+type Icon struct {
+	img *image.RGBA
+}
+
+// NewIcon returns an Icon of a copy of img, with its top left corner at the
+// origin.
+func NewIcon(img image.Image) Icon {
+	b := img.Bounds()
+	rgba := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(rgba, rgba.Bounds(), img, b.Min, draw.Src)
+	return Icon{rgba}
+}
+
+// Image returns the image of the icon, which must not be modified, e.g. to
+// pass it to SetIconImage.
+func (icon Icon) Image() image.Image {
+	return icon.rgba()
+}
+
+// rgba returns the image of the icon, empty for the zero Icon.
+func (icon Icon) rgba() *image.RGBA {
+	if icon.img == nil {
+		return image.NewRGBA(image.Rectangle{})
+	}
+	return icon.img
+}
+
+// clone returns a copy of the image of the icon, for the Draw methods to
+// draw on.
+func (icon Icon) clone() *image.RGBA {
+	src := icon.rgba()
+	dst := image.NewRGBA(src.Rect)
+	copy(dst.Pix, src.Pix)
+	return dst
+}
+
+// DrawBadge returns the icon with count drawn in white in a circle of color
+// bg over its top right corner, the way SetIconBadge does. Counts above 9 are
+// drawn as "9+", and a count of 0 or less draws no badge.
+func (icon Icon) DrawBadge(count int, bg color.RGBA) Icon {
+	img := icon.clone()
+	text := badgeText(count)
+	size := img.Rect.Dx()
+	if img.Rect.Dy() < size {
+		size = img.Rect.Dy()
+	}
+	diameter := size * 3 / 5
+	if text == "" || diameter <= 0 {
+		return Icon{img}
+	}
+	badge := image.Rect(img.Rect.Max.X-diameter, 0, img.Rect.Max.X, diameter)
+	draw.DrawMask(img, badge, image.NewUniform(bg), image.Point{}, disc{diameter, float64(diameter) / 2}, image.Point{}, draw.Over)
+
+	// the text is drawn with a 3x5 pixel font scaled to about 60% of the
+	// badge height
+	scale := diameter * 3 / 5 / 5
+	if scale < 1 {
+		scale = 1
+	}
+	width := (len(text)*4 - 1) * scale
+	origin := image.Pt(badge.Min.X+(diameter-width)/2, badge.Min.Y+(diameter-5*scale)/2)
+	white := image.NewUniform(color.White)
+	for i, r := range text {
+		glyph := badgeFont[r]
+		for y, row := range glyph {
+			for x := 0; x < 3; x++ {
+				if row&(4>>x) == 0 {
+					continue
+				}
+				cell := image.Rect(0, 0, scale, scale).Add(origin).Add(image.Pt((i*4+x)*scale, y*scale))
+				draw.Draw(img, cell.Intersect(badge), white, image.Point{}, draw.Over)
+			}
+		}
+	}
+	return Icon{img}
+}
+
+// badgeFont is a 3x5 pixel font for the badge text, each row of a glyph
+// being 3 bits, from left to right.
+var badgeFont = map[rune][5]uint8{
+	'0': {7, 5, 5, 5, 7},
+	'1': {2, 6, 2, 2, 7},
+	'2': {7, 1, 7, 4, 7},
+	'3': {7, 1, 7, 1, 7},
+	'4': {5, 5, 7, 1, 1},
+	'5': {7, 4, 7, 1, 7},
+	'6': {7, 4, 7, 5, 7},
+	'7': {7, 1, 2, 2, 2},
+	'8': {7, 5, 7, 5, 7},
+	'9': {7, 5, 7, 1, 7},
+	'+': {0, 2, 7, 2, 0},
+}
+
+// DrawProgressArc returns the icon with a ring drawn in c along its edge,
+// starting at the top and going clockwise for pct of the full circle, from
+// 0.0 to 1.0, values out of range being clamped.
+func (icon Icon) DrawProgressArc(pct float64, c color.RGBA) Icon {
+	img := icon.clone()
+	if pct < 0 {
+		pct = 0
+	} else if pct > 1 {
+		pct = 1
+	}
+	size := img.Rect.Dx()
+	if img.Rect.Dy() < size {
+		size = img.Rect.Dy()
+	}
+	if pct == 0 || size <= 0 {
+		return Icon{img}
+	}
+	thickness := float64(size) / 8
+	if thickness < 1 {
+		thickness = 1
+	}
+	mask := arc{size, float64(size)/2 - thickness, float64(size) / 2, pct * 2 * math.Pi}
+	r := image.Rect(0, 0, size, size).Add(image.Pt((img.Rect.Dx()-size)/2, (img.Rect.Dy()-size)/2))
+	draw.DrawMask(img, r, image.NewUniform(c), image.Point{}, mask, image.Point{}, draw.Over)
+	return Icon{img}
+}
+
+// Encode returns the icon as a PNG, ready for SetIcon.
+func (icon Icon) Encode() ([]byte, error) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, icon.rgba()); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// RecommendedSize returns the size in pixels icons should have to show
+// crisply in the tray: the size declared by SetIconSize if any, or else the
+// small icon size of Windows, 32x32 on macOS, showing as 16x16 points on
+// Retina displays, and 22x22 on Linux, the usual size of indicators.
+func (icon Icon) RecommendedSize() (w, h int) {
+	if w, h = trayIconSize(); w > 0 && h > 0 {
+		return w, h
+	}
+	return recommendedIconSize()
+}
+
+// arc is the mask of a ring between radiuses inner and outer centered in a
+// size x size image, from the top clockwise for sweep radians, with
+// antialiased edges.
+type arc struct {
+	size         int
+	inner, outer float64
+	sweep        float64
+}
+
+func (a arc) ColorModel() color.Model {
+	return color.AlphaModel
+}
+
+func (a arc) Bounds() image.Rectangle {
+	return image.Rect(0, 0, a.size, a.size)
+}
+
+func (a arc) At(x, y int) color.Color {
+	// the coverage of the pixel, sampled 4x4 times
+	const samples = 4
+	center := float64(a.size) / 2
+	covered := 0
+	for i := 0; i < samples; i++ {
+		for j := 0; j < samples; j++ {
+			dx := float64(x) + (float64(i)+0.5)/samples - center
+			dy := float64(y) + (float64(j)+0.5)/samples - center
+			d2 := dx*dx + dy*dy
+			if d2 < a.inner*a.inner || d2 > a.outer*a.outer {
+				continue
+			}
+			// the angle from the top, clockwise as y grows downwards
+			angle := math.Atan2(dx, -dy)
+			if angle < 0 {
+				angle += 2 * math.Pi
+			}
+			if angle <= a.sweep {
+				covered++
+			}
+		}
+	}
+	return color.Alpha{uint8(covered * 0xff / (samples * samples))}
+}
@@ -0,0 +1,30 @@
+package systray
+
+import (
+	"image"
+	"image/draw"
+)
+
+// SetIconImage sets the systray icon from img, e.g. drawn by the app to show
+// a gauge, sparing the PNG round-trip SetIcon requires: the pixels are handed
+// to the platform as is on Windows and macOS. Linux indicators only take
+// icon files, so img is still encoded to PNG there.
+func SetIconImage(img image.Image) error {
+	if img == nil || img.Bounds().Empty() {
+		return ErrEmptyIcon
+	}
+	stopIconAnimation()
+	return setIconImage(toNRGBA(img))
+}
+
+// toNRGBA returns img as non-premultiplied RGBA pixels, with its origin at
+// (0, 0) and no padding between rows, copying it if needed.
+func toNRGBA(img image.Image) *image.NRGBA {
+	b := img.Bounds()
+	if nrgba, ok := img.(*image.NRGBA); ok && b.Min == (image.Point{}) && nrgba.Stride == 4*b.Dx() {
+		return nrgba
+	}
+	nrgba := image.NewNRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(nrgba, nrgba.Bounds(), img, b.Min, draw.Src)
+	return nrgba
+}
@@ -0,0 +1,21 @@
+//go:build !systray_fake
+
+package systray
+
+// #include "systray.h"
+import "C"
+
+import (
+	"image"
+	"unsafe"
+)
+
+func setIconImage(img *image.NRGBA) error {
+	width, height := trayIconSize()
+	b := img.Bounds()
+	pixels := (*C.uchar)(unsafe.Pointer(&img.Pix[0]))
+	if !C.set_icon_rgba(pixels, C.int(b.Dx()), C.int(b.Dy()), C.int(width), C.int(height)) {
+		return ErrIconRejected
+	}
+	return nil
+}
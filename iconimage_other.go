@@ -0,0 +1,17 @@
+//go:build (!windows && !darwin) || systray_fake
+
+package systray
+
+import (
+	"bytes"
+	"image"
+	"image/png"
+)
+
+func setIconImage(img *image.NRGBA) error {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return err
+	}
+	return setIcon(buf.Bytes())
+}
@@ -0,0 +1,72 @@
+//go:build windows && !systray_fake
+
+package systray
+
+import (
+	"image"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+func setIconImage(img *image.NRGBA) error {
+	wt.muNID.RLock()
+	initialized := wt.nid != nil
+	wt.muNID.RUnlock()
+	if !initialized {
+		return errTrayNotInitialized
+	}
+	hIcon, err := iconFromImage(img)
+	if err != nil {
+		return err
+	}
+	return wt.setBaseIcon(hIcon, true)
+}
+
+// iconFromImage creates an icon with the pixels of img, which the caller must
+// destroy.
+func iconFromImage(img *image.NRGBA) (windows.Handle, error) {
+	const DIB_RGB_COLORS = 0
+	b := img.Bounds()
+	width, height := b.Dx(), b.Dy()
+
+	// a top-down 32 bits DIB, to keep the alpha channel
+	bih := bitmapInfoHeader{
+		Width:    int32(width),
+		Height:   -int32(height),
+		Planes:   1,
+		BitCount: 32,
+	}
+	bih.Size = uint32(unsafe.Sizeof(bih))
+	var bits unsafe.Pointer
+	hBmp, _, err := pCreateDIBSection.Call(0, uintptr(unsafe.Pointer(&bih)), DIB_RGB_COLORS, uintptr(unsafe.Pointer(&bits)), 0, 0)
+	if hBmp == 0 {
+		return 0, err
+	}
+	defer pDeleteObject.Call(hBmp)
+	// DIBs are BGRA, icons not being premultiplied either
+	pixels := unsafe.Slice((*byte)(bits), width*height*4)
+	for i := 0; i < len(pixels); i += 4 {
+		pixels[i] = img.Pix[i+2]
+		pixels[i+1] = img.Pix[i+1]
+		pixels[i+2] = img.Pix[i]
+		pixels[i+3] = img.Pix[i+3]
+	}
+
+	// the mask is ignored for icons with an alpha channel, but still required
+	hMask, _, err := pCreateBitmap.Call(uintptr(width), uintptr(height), 1, 1, 0)
+	if hMask == 0 {
+		return 0, err
+	}
+	defer pDeleteObject.Call(hMask)
+	ii := iconInfo{
+		Icon:        1,
+		MaskBitmap:  windows.Handle(hMask),
+		ColorBitmap: windows.Handle(hBmp),
+	}
+	hIcon, _, err := pCreateIconIndirect.Call(uintptr(unsafe.Pointer(&ii)))
+	if hIcon == 0 {
+		return 0, err
+	}
+	return windows.Handle(hIcon), nil
+}
@@ -0,0 +1,81 @@
+package systray
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+)
+
+// IconShape is a shape drawn by NewIconFromTemplate.
+type IconShape int
+
+const (
+	// IconShapeCircle is a disc filling the icon.
+	IconShapeCircle IconShape = iota
+	// IconShapeSquare is a square filling the icon.
+	IconShapeSquare
+	// IconShapeDot is a disc half the size of the icon, in its center, e.g.
+	// for a status light.
+	IconShapeDot
+)
+
+// NewIconFromTemplate draws shape in fill on a transparent background, and
+// returns it as a PNG of size x size pixels ready for SetIcon, for apps which
+// need no more than a colored icon, e.g. to tell a status.
+func NewIconFromTemplate(shape IconShape, fill color.RGBA, size int) ([]byte, error) {
+	if size <= 0 {
+		return nil, fmt.Errorf("systray: invalid icon size %d", size)
+	}
+	img := image.NewNRGBA(image.Rect(0, 0, size, size))
+	src := image.NewUniform(fill)
+	switch shape {
+	case IconShapeCircle:
+		draw.DrawMask(img, img.Bounds(), src, image.Point{}, disc{size, float64(size) / 2}, image.Point{}, draw.Over)
+	case IconShapeSquare:
+		draw.Draw(img, img.Bounds(), src, image.Point{}, draw.Src)
+	case IconShapeDot:
+		draw.DrawMask(img, img.Bounds(), src, image.Point{}, disc{size, float64(size) / 4}, image.Point{}, draw.Over)
+	default:
+		return nil, fmt.Errorf("systray: unknown icon shape %d", shape)
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// disc is the mask of a disc of radius r centered in a size x size image,
+// with antialiased edges.
+type disc struct {
+	size int
+	r    float64
+}
+
+func (d disc) ColorModel() color.Model {
+	return color.AlphaModel
+}
+
+func (d disc) Bounds() image.Rectangle {
+	return image.Rect(0, 0, d.size, d.size)
+}
+
+func (d disc) At(x, y int) color.Color {
+	// the coverage of the pixel, sampled 4x4 times
+	const samples = 4
+	center := float64(d.size) / 2
+	covered := 0
+	for i := 0; i < samples; i++ {
+		for j := 0; j < samples; j++ {
+			dx := float64(x) + (float64(i)+0.5)/samples - center
+			dy := float64(y) + (float64(j)+0.5)/samples - center
+			if dx*dx+dy*dy <= d.r*d.r {
+				covered++
+			}
+		}
+	}
+	return color.Alpha{uint8(covered * 0xff / (samples * samples))}
+}
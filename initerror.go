@@ -0,0 +1,49 @@
+package systray
+
+import "sync"
+
+// InitError is returned by RunE and RegisterE when the native initialization
+// of the systray fails, in which case neither onReady nor onExit is invoked.
+type InitError struct {
+	// Op is the step which failed, e.g. "create the status item".
+	Op string
+	// Err is the cause of the failure if the platform tells it, e.g. a
+	// syscall.Errno holding the error code on Windows, nil otherwise.
+	Err error
+}
+
+func (e *InitError) Error() string {
+	if e.Err == nil {
+		return "systray: unable to " + e.Op
+	}
+	return "systray: unable to " + e.Op + ": " + e.Err.Error()
+}
+
+func (e *InitError) Unwrap() error {
+	return e.Err
+}
+
+var (
+	// lateInitErr is the error of an initialization which failed once the
+	// event loop ran, as the status item is only created then on macOS
+	lateInitErr   error
+	muLateInitErr sync.Mutex
+)
+
+// initFailed records err as the error of the initialization, for platforms
+// finishing it in the event loop, which they must make return.
+func initFailed(err error) {
+	setState(stateStopped)
+	muLateInitErr.Lock()
+	lateInitErr = err
+	muLateInitErr.Unlock()
+}
+
+// takeLateInitError returns and clears the error recorded by initFailed.
+func takeLateInitError() error {
+	muLateInitErr.Lock()
+	defer muLateInitErr.Unlock()
+	err := lateInitErr
+	lateInitErr = nil
+	return err
+}
@@ -0,0 +1,83 @@
+// Package keys holds the hotkey modifiers and keys shared by the systray and
+// hotkey packages, along with their native codes on each platform.
+package keys
+
+// Modifier is a set of modifier keys to hold for a hotkey.
+type Modifier uint8
+
+const (
+	ModCtrl Modifier = 1 << iota
+	ModShift
+	// ModAlt is the Option key on macOS.
+	ModAlt
+	// ModSuper is the Windows key on Windows and the Command key on macOS.
+	ModSuper
+)
+
+// Key is the non-modifier key of a hotkey.
+type Key int
+
+const (
+	KeyA Key = iota + 1
+	KeyB
+	KeyC
+	KeyD
+	KeyE
+	KeyF
+	KeyG
+	KeyH
+	KeyI
+	KeyJ
+	KeyK
+	KeyL
+	KeyM
+	KeyN
+	KeyO
+	KeyP
+	KeyQ
+	KeyR
+	KeyS
+	KeyT
+	KeyU
+	KeyV
+	KeyW
+	KeyX
+	KeyY
+	KeyZ
+	Key0
+	Key1
+	Key2
+	Key3
+	Key4
+	Key5
+	Key6
+	Key7
+	Key8
+	Key9
+	KeyF1
+	KeyF2
+	KeyF3
+	KeyF4
+	KeyF5
+	KeyF6
+	KeyF7
+	KeyF8
+	KeyF9
+	KeyF10
+	KeyF11
+	KeyF12
+	KeySpace
+	KeyReturn
+	KeyEscape
+	KeyTab
+	KeyDelete
+	KeyLeft
+	KeyRight
+	KeyUp
+	KeyDown
+)
+
+// Valid reports whether key is one of the keys above.
+func Valid(key Key) bool {
+	return key >= KeyA && key <= KeyDown
+}
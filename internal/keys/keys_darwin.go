@@ -0,0 +1,118 @@
+package keys
+
+// Carbon converts a hotkey to Carbon modifiers and virtual key code for
+// RegisterEventHotKey.
+func Carbon(mod Modifier, key Key) (uint32, uint32) {
+	const (
+		cmdKey     = 0x0100
+		shiftKey   = 0x0200
+		optionKey  = 0x0800
+		controlKey = 0x1000
+	)
+	var mods uint32
+	if mod&ModCtrl != 0 {
+		mods |= controlKey
+	}
+	if mod&ModShift != 0 {
+		mods |= shiftKey
+	}
+	if mod&ModAlt != 0 {
+		mods |= optionKey
+	}
+	if mod&ModSuper != 0 {
+		mods |= cmdKey
+	}
+	return mods, darwinKeyCodes[key]
+}
+
+// The CGEventFlags of the modifiers.
+const (
+	flagMaskShift     = 0x00020000
+	flagMaskControl   = 0x00040000
+	flagMaskAlternate = 0x00080000
+	flagMaskCommand   = 0x00100000
+
+	// EventFlagsMask masks the CGEventFlags of a key press to the modifiers
+	// returned by EventTap.
+	EventFlagsMask = flagMaskShift | flagMaskControl | flagMaskAlternate | flagMaskCommand
+)
+
+// EventTap converts a hotkey to CGEventFlags and virtual key code, to match
+// the key presses seen by a Quartz event tap.
+func EventTap(mod Modifier, key Key) (uint64, uint32) {
+	var flags uint64
+	if mod&ModCtrl != 0 {
+		flags |= flagMaskControl
+	}
+	if mod&ModShift != 0 {
+		flags |= flagMaskShift
+	}
+	if mod&ModAlt != 0 {
+		flags |= flagMaskAlternate
+	}
+	if mod&ModSuper != 0 {
+		flags |= flagMaskCommand
+	}
+	return flags, darwinKeyCodes[key]
+}
+
+// darwinKeyCodes are the kVK_* constants from HIToolbox/Events.h.
+var darwinKeyCodes = map[Key]uint32{
+	KeyA:      0x00,
+	KeyB:      0x0B,
+	KeyC:      0x08,
+	KeyD:      0x02,
+	KeyE:      0x0E,
+	KeyF:      0x03,
+	KeyG:      0x05,
+	KeyH:      0x04,
+	KeyI:      0x22,
+	KeyJ:      0x26,
+	KeyK:      0x28,
+	KeyL:      0x25,
+	KeyM:      0x2E,
+	KeyN:      0x2D,
+	KeyO:      0x1F,
+	KeyP:      0x23,
+	KeyQ:      0x0C,
+	KeyR:      0x0F,
+	KeyS:      0x01,
+	KeyT:      0x11,
+	KeyU:      0x20,
+	KeyV:      0x09,
+	KeyW:      0x0D,
+	KeyX:      0x07,
+	KeyY:      0x10,
+	KeyZ:      0x06,
+	Key0:      0x1D,
+	Key1:      0x12,
+	Key2:      0x13,
+	Key3:      0x14,
+	Key4:      0x15,
+	Key5:      0x17,
+	Key6:      0x16,
+	Key7:      0x1A,
+	Key8:      0x1C,
+	Key9:      0x19,
+	KeyF1:     0x7A,
+	KeyF2:     0x78,
+	KeyF3:     0x63,
+	KeyF4:     0x76,
+	KeyF5:     0x60,
+	KeyF6:     0x61,
+	KeyF7:     0x62,
+	KeyF8:     0x64,
+	KeyF9:     0x65,
+	KeyF10:    0x6D,
+	KeyF11:    0x67,
+	KeyF12:    0x6F,
+	KeySpace:  0x31,
+	KeyReturn: 0x24,
+	KeyEscape: 0x35,
+	KeyTab:    0x30,
+	KeyDelete: 0x75, // forward delete
+	KeyLeft:   0x7B,
+	KeyRight:  0x7C,
+	KeyDown:   0x7D,
+	KeyUp:     0x7E,
+}
@@ -0,0 +1,48 @@
+package keys
+
+// X11 converts a hotkey to X11 modifier mask and keysym for
+// XGrabKey.
+func X11(mod Modifier, key Key) (uint32, uint32) {
+	const (
+		ShiftMask   = 1 << 0
+		ControlMask = 1 << 2
+		Mod1Mask    = 1 << 3 // Alt
+		Mod4Mask    = 1 << 6 // Super
+	)
+	var mods uint32
+	if mod&ModCtrl != 0 {
+		mods |= ControlMask
+	}
+	if mod&ModShift != 0 {
+		mods |= ShiftMask
+	}
+	if mod&ModAlt != 0 {
+		mods |= Mod1Mask
+	}
+	if mod&ModSuper != 0 {
+		mods |= Mod4Mask
+	}
+
+	var keysym uint32
+	switch {
+	case key >= KeyA && key <= KeyZ:
+		keysym = 'a' + uint32(key-KeyA) // XK_a
+	case key >= Key0 && key <= Key9:
+		keysym = '0' + uint32(key-Key0) // XK_0
+	case key >= KeyF1 && key <= KeyF12:
+		keysym = 0xffbe + uint32(key-KeyF1) // XK_F1
+	default:
+		keysym = map[Key]uint32{
+			KeySpace:  0x0020, // XK_space
+			KeyReturn: 0xff0d, // XK_Return
+			KeyEscape: 0xff1b, // XK_Escape
+			KeyTab:    0xff09, // XK_Tab
+			KeyDelete: 0xffff, // XK_Delete
+			KeyLeft:   0xff51, // XK_Left
+			KeyUp:     0xff52, // XK_Up
+			KeyRight:  0xff53, // XK_Right
+			KeyDown:   0xff54, // XK_Down
+		}[key]
+	}
+	return mods, keysym
+}
@@ -0,0 +1,50 @@
+package keys
+
+// Win32 converts a hotkey to modifiers and virtual-key code for
+// RegisterHotKey.
+// https://docs.microsoft.com/en-us/windows/win32/inputdev/virtual-key-codes
+func Win32(mod Modifier, key Key) (uint32, uint32) {
+	const (
+		MOD_ALT      = 0x0001
+		MOD_CONTROL  = 0x0002
+		MOD_SHIFT    = 0x0004
+		MOD_WIN      = 0x0008
+		MOD_NOREPEAT = 0x4000
+	)
+	var mods uint32 = MOD_NOREPEAT
+	if mod&ModCtrl != 0 {
+		mods |= MOD_CONTROL
+	}
+	if mod&ModShift != 0 {
+		mods |= MOD_SHIFT
+	}
+	if mod&ModAlt != 0 {
+		mods |= MOD_ALT
+	}
+	if mod&ModSuper != 0 {
+		mods |= MOD_WIN
+	}
+
+	var vk uint32
+	switch {
+	case key >= KeyA && key <= KeyZ:
+		vk = 'A' + uint32(key-KeyA)
+	case key >= Key0 && key <= Key9:
+		vk = '0' + uint32(key-Key0)
+	case key >= KeyF1 && key <= KeyF12:
+		vk = 0x70 + uint32(key-KeyF1) // VK_F1
+	default:
+		vk = map[Key]uint32{
+			KeySpace:  0x20, // VK_SPACE
+			KeyReturn: 0x0D, // VK_RETURN
+			KeyEscape: 0x1B, // VK_ESCAPE
+			KeyTab:    0x09, // VK_TAB
+			KeyDelete: 0x2E, // VK_DELETE
+			KeyLeft:   0x25, // VK_LEFT
+			KeyUp:     0x26, // VK_UP
+			KeyRight:  0x27, // VK_RIGHT
+			KeyDown:   0x28, // VK_DOWN
+		}[key]
+	}
+	return mods, vk
+}
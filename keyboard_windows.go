@@ -0,0 +1,69 @@
+//go:build windows && !systray_fake
+
+package systray
+
+import (
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+var (
+	pGetCurrentThreadId  = k32.NewProc("GetCurrentThreadId")
+	pCallNextHookEx      = u32.NewProc("CallNextHookEx")
+	pGetKeyState         = u32.NewProc("GetKeyState")
+	pSetWindowsHookEx    = u32.NewProc("SetWindowsHookExW")
+	pUnhookWindowsHookEx = u32.NewProc("UnhookWindowsHookEx")
+)
+
+// https://docs.microsoft.com/en-us/windows/win32/api/winuser/ns-winuser-msg
+type menuMessage struct {
+	WindowHandle windows.Handle
+	Message      uint32
+	Wparam       uintptr
+	Lparam       uintptr
+	Time         uint32
+	Pt           point
+}
+
+// menuKeysProc is the WH_MSGFILTER hook procedure, created once as the number
+// of callbacks is limited.
+var menuKeysProc = windows.NewCallback(func(code, wParam, lParam uintptr) uintptr {
+	const (
+		MSGF_MENU  = 2
+		WM_KEYDOWN = 0x0100
+		VK_TAB     = 0x09
+		VK_SHIFT   = 0x10
+		VK_UP      = 0x26
+		VK_DOWN    = 0x28
+	)
+	if int32(code) == MSGF_MENU {
+		// lParam points to the message, reinterpreted that way to please go vet
+		m := *(**menuMessage)(unsafe.Pointer(&lParam))
+		if m.Message == WM_KEYDOWN && m.Wparam == VK_TAB {
+			if state, _, _ := pGetKeyState.Call(VK_SHIFT); int16(state) < 0 {
+				m.Wparam = VK_UP
+			} else {
+				m.Wparam = VK_DOWN
+			}
+		}
+	}
+	res, _, _ := pCallNextHookEx.Call(0, code, wParam, lParam)
+	return res
+})
+
+// hookMenuKeys makes the menus shown from the calling thread move through
+// their items with Tab and Shift-Tab, like dialogs, as they only handle the
+// arrow keys. It returns the function to call once the menu is closed.
+func hookMenuKeys() (unhook func()) {
+	var WH_MSGFILTER int32 = -1
+	threadID, _, _ := pGetCurrentThreadId.Call()
+	hook, _, _ := pSetWindowsHookEx.Call(uintptr(WH_MSGFILTER), menuKeysProc, 0, threadID)
+	if hook == 0 {
+		// keyboard navigation is still possible with the arrow keys
+		return func() {}
+	}
+	return func() {
+		pUnhookWindowsHookEx.Call(hook)
+	}
+}
@@ -0,0 +1,64 @@
+package systray
+
+import (
+	"log"
+	"sync"
+)
+
+// Logger receives the operations systray performs on the native menu, see
+// SetLogger.
+type Logger interface {
+	Debugf(format string, args ...interface{})
+	Errorf(format string, args ...interface{})
+}
+
+var (
+	logger   Logger
+	muLogger sync.RWMutex
+)
+
+// SetLogger sets the Logger to which every change to the native menu and
+// every click are logged, along with the errors reported by the platform,
+// e.g. to debug menus not looking as expected. Nothing is logged by default,
+// nil restores that.
+func SetLogger(l Logger) {
+	muLogger.Lock()
+	logger = l
+	muLogger.Unlock()
+}
+
+// StdLogger returns a Logger writing to the standard logger of the log
+// package.
+func StdLogger() Logger {
+	return stdLogger{}
+}
+
+type stdLogger struct{}
+
+func (stdLogger) Debugf(format string, args ...interface{}) {
+	log.Printf("systray: "+format, args...)
+}
+
+func (stdLogger) Errorf(format string, args ...interface{}) {
+	log.Printf("systray: error: "+format, args...)
+}
+
+func currentLogger() Logger {
+	muLogger.RLock()
+	defer muLogger.RUnlock()
+	return logger
+}
+
+// logOp logs the operation op on item if a Logger is set.
+func logOp(op string, item *MenuItem) {
+	if l := currentLogger(); l != nil {
+		l.Debugf("%s %d %q", op, item.id, item.loadTitle())
+	}
+}
+
+// logError logs the error of the operation op on item if a Logger is set.
+func logError(op string, item *MenuItem, err error) {
+	if l := currentLogger(); l != nil {
+		l.Errorf("%s %d %q: %v", op, item.id, item.loadTitle(), err)
+	}
+}
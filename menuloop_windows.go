@@ -0,0 +1,98 @@
+//go:build windows && !systray_fake
+
+package systray
+
+import (
+	"sort"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+var (
+	pEnumThreadWindows        = u32.NewProc("EnumThreadWindows")
+	pGetClassName             = u32.NewProc("GetClassNameW")
+	pGetWindowThreadProcessId = u32.NewProc("GetWindowThreadProcessId")
+	pRedrawWindow             = u32.NewProc("RedrawWindow")
+)
+
+// holdUpdate reports whether the update of the menu item must wait for the
+// menu to close, recording it if so. Updating a menu item while the menu
+// shows makes it flicker or be redrawn incorrectly, unless it's done from the
+// thread of the window, e.g. by the callbacks invoked as sub menus open,
+// before they're drawn.
+func (t *winTray) holdUpdate(menuItemId uint32) bool {
+	t.muPendingUpdates.Lock()
+	defer t.muPendingUpdates.Unlock()
+	if !t.inMenuLoop {
+		return false
+	}
+	windowThreadID, _, _ := pGetWindowThreadProcessId.Call(uintptr(t.window), 0)
+	if threadID, _, _ := pGetCurrentThreadId.Call(); threadID == windowThreadID {
+		return false
+	}
+	t.pendingUpdates[menuItemId] = true
+	return true
+}
+
+// applyPendingUpdates updates the menu items held back while the menu showed,
+// with their latest state.
+func (t *winTray) applyPendingUpdates() {
+	t.muPendingUpdates.Lock()
+	t.inMenuLoop = false
+	pending := t.pendingUpdates
+	t.pendingUpdates = make(map[uint32]bool)
+	t.muPendingUpdates.Unlock()
+	ids := make([]uint32, 0, len(pending))
+	for menuItemId := range pending {
+		ids = append(ids, menuItemId)
+	}
+	// in the order the menu items were added, parents first
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	for _, menuItemId := range ids {
+		if item, ok := GetMenuItemByID(menuItemId); ok && !item.isRemoved() {
+			item.addOrUpdate()
+		}
+	}
+}
+
+// setMenuRedraw turns the redrawing of the menus showing off or back on, with
+// WM_SETREDRAW, redrawing them once turned back on. It does nothing while the
+// menu is closed, as menus are drawn from scratch as they open.
+func (t *winTray) setMenuRedraw(redraw bool) {
+	t.muPendingUpdates.Lock()
+	inMenuLoop := t.inMenuLoop
+	t.muPendingUpdates.Unlock()
+	if !inMenuLoop {
+		return
+	}
+	var lParam uintptr
+	if redraw {
+		lParam = 1
+	}
+	// the menus are windows of the thread of the window which opened them
+	windowThreadID, _, _ := pGetWindowThreadProcessId.Call(uintptr(t.window), 0)
+	pEnumThreadWindows.Call(windowThreadID, menuRedrawProc, lParam)
+}
+
+// menuRedrawProc sends WM_SETREDRAW to the menu windows, of the "#32768"
+// class, with lParam as the redraw flag.
+var menuRedrawProc = windows.NewCallback(func(hwnd, lParam uintptr) uintptr {
+	const (
+		WM_SETREDRAW    = 0x000B
+		RDW_INVALIDATE  = 0x0001
+		RDW_ERASE       = 0x0004
+		RDW_FRAME       = 0x0400
+		RDW_ALLCHILDREN = 0x0080
+	)
+	var class [8]uint16
+	n, _, _ := pGetClassName.Call(hwnd, uintptr(unsafe.Pointer(&class[0])), uintptr(len(class)))
+	if windows.UTF16ToString(class[:n]) != "#32768" {
+		return 1
+	}
+	pSendMessage.Call(hwnd, WM_SETREDRAW, lParam, 0)
+	if lParam != 0 {
+		pRedrawWindow.Call(hwnd, 0, 0, RDW_INVALIDATE|RDW_ERASE|RDW_FRAME|RDW_ALLCHILDREN)
+	}
+	return 1
+})
@@ -0,0 +1,105 @@
+package systray
+
+import (
+	"fmt"
+)
+
+// MenuItemSpec describes a menu item for BuildMenuFromSpec, e.g. decoded from
+// a configuration file.
+type MenuItemSpec struct {
+	// Title is the title of the menu item, which ParentTitle refers to.
+	Title string
+	// Tooltip is the tooltip of the menu item, see WithTooltip.
+	Tooltip string
+	// Disabled disables the menu item, see WithDisabled.
+	Disabled bool
+	// Checked checks the menu item, which makes it checkable.
+	Checked bool
+	// Checkable makes the menu item checkable, see WithCheckable.
+	Checkable bool
+	// ParentTitle is the title of the menu item whose sub menu contains the
+	// menu item, the main menu if empty.
+	ParentTitle string
+	// Separator makes the spec a separator bar rather than a menu item, of
+	// which only ParentTitle is used.
+	Separator bool
+	// OnClicked is called when the menu item is clicked, if not nil.
+	OnClicked func() `json:"-"`
+}
+
+// BuildMenuFromSpec adds the menu items described by specs, parents before
+// their children whatever their order in specs, each menu listing its menu
+// items in the order of specs. It returns the menu items in the order of
+// specs, including separators. Parents are referred to by title, so when
+// several specs have the same title, the first one is the parent. No menu item
+// is added if a parent is missing or a menu item is its own ancestor.
+func BuildMenuFromSpec(specs []MenuItemSpec) ([]*MenuItem, error) {
+	byTitle := make(map[string]int, len(specs))
+	for i, spec := range specs {
+		if _, ok := byTitle[spec.Title]; !ok && !spec.Separator {
+			byTitle[spec.Title] = i
+		}
+	}
+	// parents holds the index of the parent of each spec, -1 for the main
+	// menu, and depths the number of ancestors
+	parents := make([]int, len(specs))
+	depths := make([]int, len(specs))
+	maxDepth := 0
+	for i, spec := range specs {
+		parents[i] = -1
+		if spec.ParentTitle == "" {
+			continue
+		}
+		parent, ok := byTitle[spec.ParentTitle]
+		if !ok {
+			return nil, fmt.Errorf("systray: parent %q of menu item %q not found", spec.ParentTitle, spec.Title)
+		}
+		parents[i] = parent
+	}
+	for i, spec := range specs {
+		for p := parents[i]; p != -1; p = parents[p] {
+			if p == i || depths[i] >= len(specs) {
+				return nil, fmt.Errorf("systray: menu item %q is its own ancestor", spec.Title)
+			}
+			depths[i]++
+		}
+		if depths[i] > maxDepth {
+			maxDepth = depths[i]
+		}
+	}
+
+	items := make([]*MenuItem, len(specs))
+	for depth := 0; depth <= maxDepth; depth++ {
+		for i, spec := range specs {
+			if depths[i] != depth {
+				continue
+			}
+			var parent *MenuItem
+			if parents[i] != -1 {
+				parent = items[parents[i]]
+			}
+			if spec.Separator {
+				items[i] = newSeparator(parent)
+				continue
+			}
+			var opts []MenuItemOption
+			if parent != nil {
+				opts = append(opts, WithParent(parent))
+			}
+			if spec.Tooltip != "" {
+				opts = append(opts, WithTooltip(spec.Tooltip))
+			}
+			if spec.Disabled {
+				opts = append(opts, WithDisabled())
+			}
+			if spec.Checkable || spec.Checked {
+				opts = append(opts, WithCheckable(spec.Checked))
+			}
+			if spec.OnClicked != nil {
+				opts = append(opts, WithOnClickedFunc(spec.OnClicked))
+			}
+			items[i] = NewMenuItem(spec.Title, opts...)
+		}
+	}
+	return items, nil
+}
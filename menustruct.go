@@ -0,0 +1,141 @@
+package systray
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// Separator marks a separator bar in a struct passed to BuildMenuFromStruct.
+type Separator struct{}
+
+// menuSpec is a menu item described by a struct field, see
+// BuildMenuFromStruct.
+type menuSpec struct {
+	field     reflect.Value
+	separator bool
+	title     string
+	opts      []MenuItemOption
+	// children is the sub menu of nested structs
+	children []menuSpec
+}
+
+var (
+	separatorType = reflect.TypeOf(Separator{})
+	funcType      = reflect.TypeOf(func() {})
+	menuItemType  = reflect.TypeOf((*MenuItem)(nil))
+)
+
+// BuildMenuFromStruct adds menu items described by the fields of the struct
+// v points to, in the order of the fields, e.g.
+//
+//	var menu struct {
+//		Open     func()            `systray:"title=Open,tooltip=Open the app"`
+//		_        systray.Separator
+//		Status   *systray.MenuItem `systray:"title=Connected,disabled"`
+//		Settings struct {
+//			Sync func()
+//		} `systray:"title=Settings"`
+//		Quit func() `systray:"title=Quit"`
+//	}
+//	menu.Open = openApp
+//	menu.Settings.Sync = sync
+//	menu.Quit = systray.Quit
+//	err := systray.BuildMenuFromStruct(&menu)
+//
+// Fields of type func() become menu items calling the function when
+// clicked, and fields of type *MenuItem are set to the menu items created
+// for them. Nested structs become sub menus, and fields of type Separator,
+// which may be blank, separator bars. Other fields are ignored, as well as
+// unexported fields except separators. The systray tag of a field sets the
+// title of the menu item, the name of the field by default, its tooltip, and
+// whether it's disabled; values can't contain commas. No menu item is added
+// if v is not a pointer to a struct or a tag is invalid.
+func BuildMenuFromStruct(v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("systray: BuildMenuFromStruct needs a pointer to a struct, got %T", v)
+	}
+	specs, err := parseMenuStruct(rv.Elem())
+	if err != nil {
+		return err
+	}
+	buildMenuSpecs(specs, nil)
+	return nil
+}
+
+func parseMenuStruct(v reflect.Value) ([]menuSpec, error) {
+	var specs []menuSpec
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.Type == separatorType {
+			specs = append(specs, menuSpec{separator: true})
+			continue
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if field.Type != funcType && field.Type != menuItemType && field.Type.Kind() != reflect.Struct {
+			continue
+		}
+		spec := menuSpec{field: v.Field(i), title: field.Name}
+		if err := spec.parseTag(field.Tag.Get("systray")); err != nil {
+			return nil, fmt.Errorf("systray: field %s: %w", field.Name, err)
+		}
+		if field.Type.Kind() == reflect.Struct {
+			children, err := parseMenuStruct(v.Field(i))
+			if err != nil {
+				return nil, err
+			}
+			spec.children = children
+		}
+		specs = append(specs, spec)
+	}
+	return specs, nil
+}
+
+// parseTag parses a tag of the form "title=Quit,tooltip=Quit the app".
+func (s *menuSpec) parseTag(tag string) error {
+	if tag == "" {
+		return nil
+	}
+	for _, kv := range strings.Split(tag, ",") {
+		key, value, hasValue := strings.Cut(kv, "=")
+		switch key {
+		case "title":
+			s.title = value
+		case "tooltip":
+			s.opts = append(s.opts, WithTooltip(value))
+		case "disabled":
+			if hasValue {
+				return fmt.Errorf("unexpected value for disabled: %q", value)
+			}
+			s.opts = append(s.opts, WithDisabled())
+		default:
+			return fmt.Errorf("unknown tag key %q", key)
+		}
+	}
+	return nil
+}
+
+func buildMenuSpecs(specs []menuSpec, parent *MenuItem) {
+	for _, spec := range specs {
+		if spec.separator {
+			newSeparator(parent)
+			continue
+		}
+		opts := spec.opts
+		if parent != nil {
+			opts = append(opts, WithParent(parent))
+		}
+		if spec.field.Type() == funcType && !spec.field.IsNil() {
+			opts = append(opts, WithOnClickedFunc(spec.field.Interface().(func())))
+		}
+		item := NewMenuItem(spec.title, opts...)
+		if spec.field.Type() == menuItemType {
+			spec.field.Set(reflect.ValueOf(item))
+		}
+		buildMenuSpecs(spec.children, item)
+	}
+}
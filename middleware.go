@@ -0,0 +1,46 @@
+package systray
+
+import (
+	"sync"
+)
+
+// ClickMiddleware intercepts the clicks on a menu item. It calls next to
+// carry on handling the click, or not to drop it.
+type ClickMiddleware func(next func(), item *MenuItem)
+
+var (
+	clickMiddlewares   []ClickMiddleware
+	muClickMiddlewares sync.RWMutex
+)
+
+// UseClickMiddleware adds fn to the chain of middlewares intercepting the
+// clicks on the menu items created from now on, e.g. to log clicks or recover
+// from panics in click handlers. Middlewares run in the order they were added,
+// the last one calling the handlers of the menu item, see Mux.
+func UseClickMiddleware(fn func(next func(), item *MenuItem)) {
+	muClickMiddlewares.Lock()
+	defer muClickMiddlewares.Unlock()
+	// copying on write, as menu items share the slice
+	clickMiddlewares = append(clickMiddlewares[:len(clickMiddlewares):len(clickMiddlewares)], fn)
+}
+
+// currentClickMiddlewares returns the middlewares for a new menu item.
+func currentClickMiddlewares() []ClickMiddleware {
+	muClickMiddlewares.RLock()
+	defer muClickMiddlewares.RUnlock()
+	return clickMiddlewares
+}
+
+// handleClick runs the click on item through its middlewares to DefaultMux.
+func handleClick(item *MenuItem) {
+	next := func() {
+		DefaultMux.Dispatch(item)
+	}
+	for i := len(item.middlewares) - 1; i >= 0; i-- {
+		mw, inner := item.middlewares[i], next
+		next = func() {
+			mw(inner, item)
+		}
+	}
+	next()
+}
@@ -0,0 +1,66 @@
+package systray
+
+import (
+	"sync"
+)
+
+// Mux dispatches the clicks on menu items to the handlers registered for
+// them, like http.ServeMux does for requests. Clicks are dispatched by
+// DefaultMux, and other instances can be used to group handlers, their
+// Dispatch method being called from a handler of DefaultMux.
+type Mux struct {
+	mu sync.RWMutex
+	// handlers are keyed by menu item rather than by ID, as WithID lets a
+	// menu item reuse the ID of a removed one
+	handlers map[*MenuItem]func()
+}
+
+// DefaultMux is the Mux dispatching the clicks on all menu items.
+var DefaultMux = NewMux()
+
+// NewMux allocates and returns a new Mux.
+func NewMux() *Mux {
+	return &Mux{handlers: make(map[*MenuItem]func())}
+}
+
+// Handle registers fn to be called when item is clicked, replacing the
+// handler previously registered for item if any. A nil fn unregisters it.
+func (m *Mux) Handle(item *MenuItem, fn func()) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if fn == nil {
+		delete(m.handlers, item)
+		return
+	}
+	m.handlers[item] = fn
+}
+
+// HandleFunc is the same as Handle, named after http.HandleFunc.
+func (m *Mux) HandleFunc(item *MenuItem, fn func()) {
+	m.Handle(item, fn)
+}
+
+// Dispatch handles a click on item: it calls the handler registered for
+// item if any, and, for DefaultMux, the callbacks set on item, see
+// WithOnClickedFunc and WithClickChan.
+func (m *Mux) Dispatch(item *MenuItem) {
+	m.mu.RLock()
+	fn := m.handlers[item]
+	m.mu.RUnlock()
+	if fn != nil {
+		fn()
+	}
+	if m == DefaultMux {
+		item.clicked()
+	}
+}
+
+// Handle registers fn to be called when item is clicked in DefaultMux.
+func Handle(item *MenuItem, fn func()) {
+	DefaultMux.Handle(item, fn)
+}
+
+// HandleFunc registers fn to be called when item is clicked in DefaultMux.
+func HandleFunc(item *MenuItem, fn func()) {
+	DefaultMux.HandleFunc(item, fn)
+}
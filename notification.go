@@ -0,0 +1,108 @@
+package systray
+
+import (
+	"sync"
+	"time"
+)
+
+// NotificationIconType is the kind of stock icon shown in a notification.
+type NotificationIconType int
+
+const (
+	// NotificationIconNone shows no stock icon.
+	NotificationIconNone NotificationIconType = iota
+	// NotificationIconInfo shows an information icon.
+	NotificationIconInfo
+	// NotificationIconWarning shows a warning icon.
+	NotificationIconWarning
+	// NotificationIconError shows an error icon.
+	NotificationIconError
+)
+
+// notification keeps the content and settings of a notification to show.
+type notification struct {
+	title    string
+	body     string
+	iconType NotificationIconType
+	// icon is the content of a custom icon, which takes precedence over
+	// iconType
+	icon      []byte
+	timeout   time.Duration
+	onClicked func()
+}
+
+type NotificationOption func(n *notification)
+
+// WithNotificationIconType sets the stock icon of the notification. It has
+// no effect on macOS, which always shows the application icon.
+func WithNotificationIconType(iconType NotificationIconType) NotificationOption {
+	return func(n *notification) {
+		n.iconType = iconType
+	}
+}
+
+// WithNotificationIcon sets a custom icon for the notification, taking
+// precedence over WithNotificationIconType. iconBytes should be the content
+// of .ico for windows and .ico/.jpg/.png for other platforms.
+func WithNotificationIcon(iconBytes []byte) NotificationOption {
+	return func(n *notification) {
+		n.icon = iconBytes
+	}
+}
+
+// WithNotificationTimeout sets how long the notification is shown. Note that
+// Windows Vista and later ignore it in favor of the accessibility settings,
+// and some Linux notification daemons ignore it as well.
+func WithNotificationTimeout(timeout time.Duration) NotificationOption {
+	return func(n *notification) {
+		n.timeout = timeout
+	}
+}
+
+// WithNotificationOnClickedFunc sets the callback function to call when the
+// notification is clicked.
+func WithNotificationOnClickedFunc(callback func()) NotificationOption {
+	return func(n *notification) {
+		n.onClicked = callback
+	}
+}
+
+var (
+	notificationClicked   func()
+	muNotificationClicked sync.Mutex
+)
+
+// ShowNotification shows a notification, e.g. a balloon on Windows, with the
+// given title and body. It uses Shell_NotifyIcon on Windows,
+// NSUserNotificationCenter on macOS, which requires the program to run as an
+// application bundle, and the org.freedesktop.Notifications D-Bus service on
+// Linux. Only the click callback of the latest notification is kept.
+func ShowNotification(title, body string, opts ...NotificationOption) error {
+	n := &notification{
+		title: title,
+		body:  body,
+	}
+	for _, opt := range opts {
+		opt(n)
+	}
+	if n.icon != nil {
+		if err := validateIcon(n.icon); err != nil {
+			return err
+		}
+	}
+
+	muNotificationClicked.Lock()
+	notificationClicked = n.onClicked
+	muNotificationClicked.Unlock()
+	return showNotification(n)
+}
+
+func systrayNotificationClicked() {
+	muNotificationClicked.Lock()
+	onClicked := notificationClicked
+	notificationClicked = nil
+	muNotificationClicked.Unlock()
+	if onClicked != nil {
+		onClicked()
+	}
+}
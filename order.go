@@ -0,0 +1,183 @@
+package systray
+
+import (
+	"sync"
+)
+
+var (
+	// menuOrder keeps the IDs of the menu items and separators of each menu
+	// in display order, keyed by the ID of the parent menu item, 0 being the
+	// main menu.
+	menuOrder = make(map[uint32][]uint32)
+	// separators keeps the IDs of the separators in menuOrder
+	separators  = make(map[uint32]bool)
+	muMenuOrder sync.RWMutex
+)
+
+// addToMenuOrder places id in the menu of parent, right before or after
+// anchor. id is appended to the menu if anchor is 0 or not in the menu.
+func addToMenuOrder(parent, id, anchor uint32, after bool) {
+	muMenuOrder.Lock()
+	defer muMenuOrder.Unlock()
+	insertInMenuOrder(parent, id, anchor, after)
+}
+
+// insertInMenuOrder is addToMenuOrder with muMenuOrder held.
+func insertInMenuOrder(parent, id, anchor uint32, after bool) {
+	ids := menuOrder[parent]
+	pos := len(ids)
+	for i, v := range ids {
+		if v == anchor {
+			pos = i
+			if after {
+				pos++
+			}
+			break
+		}
+	}
+	ids = append(ids, 0)
+	copy(ids[pos+1:], ids[pos:])
+	ids[pos] = id
+	menuOrder[parent] = ids
+}
+
+// addSeparatorToMenuOrder appends the separator id to the menu of parent.
+func addSeparatorToMenuOrder(parent, id uint32) {
+	addToMenuOrder(parent, id, 0, false)
+	muMenuOrder.Lock()
+	separators[id] = true
+	muMenuOrder.Unlock()
+}
+
+// delFromMenuOrder removes id from the menu of parent, and forgets about the
+// sub menu of id if any.
+func delFromMenuOrder(parent, id uint32) {
+	muMenuOrder.Lock()
+	defer muMenuOrder.Unlock()
+	removeFromMenuOrder(parent, id)
+	delete(menuOrder, id)
+	delete(separators, id)
+}
+
+// resetMenuOrder forgets about all the menus.
+func resetMenuOrder() {
+	muMenuOrder.Lock()
+	defer muMenuOrder.Unlock()
+	menuOrder = make(map[uint32][]uint32)
+	separators = make(map[uint32]bool)
+}
+
+// reorderMenu reorders the menu of parent so that ids come first, in the
+// given order, followed by the other menu items of the menu in their current
+// relative order. Separators keep their positions, only the menu items move
+// around them. It returns the new order.
+func reorderMenu(parent uint32, ids []uint32) []uint32 {
+	muMenuOrder.Lock()
+	defer muMenuOrder.Unlock()
+	current := menuOrder[parent]
+	inMenu := make(map[uint32]bool, len(current))
+	for _, id := range current {
+		inMenu[id] = !separators[id]
+	}
+	items := make([]uint32, 0, len(current))
+	listed := make(map[uint32]bool, len(ids))
+	for _, id := range ids {
+		if inMenu[id] && !listed[id] {
+			items = append(items, id)
+			listed[id] = true
+		}
+	}
+	for _, id := range current {
+		if inMenu[id] && !listed[id] {
+			items = append(items, id)
+		}
+	}
+	order := make([]uint32, 0, len(current))
+	for _, id := range current {
+		if inMenu[id] {
+			id, items = items[0], items[1:]
+		}
+		order = append(order, id)
+	}
+	menuOrder[parent] = order
+	return append([]uint32(nil), order...)
+}
+
+// moveInMenuOrder moves id right before or after anchor in the menu of
+// parent, both being in the menu. It returns the new order.
+func moveInMenuOrder(parent, id, anchor uint32, after bool) []uint32 {
+	muMenuOrder.Lock()
+	defer muMenuOrder.Unlock()
+	removeFromMenuOrder(parent, id)
+	insertInMenuOrder(parent, id, anchor, after)
+	return append([]uint32(nil), menuOrder[parent]...)
+}
+
+// swapInMenuOrder exchanges the positions of the runs of IDs a and b in the
+// menu of parent, which is left as is if either isn't in the menu. It returns
+// the new order.
+func swapInMenuOrder(parent uint32, a, b []uint32) []uint32 {
+	muMenuOrder.Lock()
+	defer muMenuOrder.Unlock()
+	current := menuOrder[parent]
+	runIndex := func(run []uint32) int {
+		for i := range current {
+			if i+len(run) <= len(current) && equalIDs(current[i:i+len(run)], run) {
+				return i
+			}
+		}
+		return -1
+	}
+	i, j := runIndex(a), runIndex(b)
+	if i == -1 || j == -1 {
+		return append([]uint32(nil), current...)
+	}
+	if i > j {
+		i, j, a, b = j, i, b, a
+	}
+	order := make([]uint32, 0, len(current))
+	order = append(order, current[:i]...)
+	order = append(order, b...)
+	order = append(order, current[i+len(a):j]...)
+	order = append(order, a...)
+	order = append(order, current[j+len(b):]...)
+	menuOrder[parent] = order
+	return append([]uint32(nil), order...)
+}
+
+func equalIDs(a, b []uint32) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// removeFromMenuOrder removes id from the menu of parent, with muMenuOrder
+// held.
+func removeFromMenuOrder(parent, id uint32) {
+	ids := menuOrder[parent]
+	for i, v := range ids {
+		if v == id {
+			menuOrder[parent] = append(ids[:i], ids[i+1:]...)
+			return
+		}
+	}
+}
+
+// menuOrderIndex returns the position of id in the menu of parent, or -1 if
+// it's not in the menu.
+func menuOrderIndex(parent, id uint32) int {
+	muMenuOrder.RLock()
+	defer muMenuOrder.RUnlock()
+	for i, v := range menuOrder[parent] {
+		if v == id {
+			return i
+		}
+	}
+	return -1
+}
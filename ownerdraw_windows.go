@@ -0,0 +1,292 @@
+//go:build windows && !systray_fake
+
+package systray
+
+import (
+	"image/color"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+var (
+	pCreateFontIndirect   = g32.NewProc("CreateFontIndirectW")
+	pFillRect             = u32.NewProc("FillRect")
+	pGetSysColor          = u32.NewProc("GetSysColor")
+	pSystemParametersInfo = u32.NewProc("SystemParametersInfoW")
+)
+
+// ownerDrawnItem is a menu item as drawn by the window procedure, see
+// WithItemStyle and WithSoftDisable.
+type ownerDrawnItem struct {
+	title string
+	style ItemStyle
+	// styled is set if the menu item has a custom style
+	styled bool
+	// grayed is set for soft disabled menu items, which are grayed out but
+	// enabled for Windows to still send their clicks
+	grayed bool
+}
+
+// https://docs.microsoft.com/en-us/windows/win32/api/wingdi/ns-wingdi-logfontw
+type logFont struct {
+	Height, Width, Escapement, Orientation, Weight int32
+	Italic, Underline, StrikeOut, CharSet          byte
+	OutPrecision, ClipPrecision, Quality           byte
+	PitchAndFamily                                 byte
+	FaceName                                       [32]uint16
+}
+
+// https://docs.microsoft.com/en-us/windows/win32/api/winuser/ns-winuser-nonclientmetricsw
+type nonClientMetrics struct {
+	Size                              uint32
+	BorderWidth, ScrollWidth          int32
+	ScrollHeight                      int32
+	CaptionWidth, CaptionHeight       int32
+	CaptionFont                       logFont
+	SmCaptionWidth, SmCaptionHeight   int32
+	SmCaptionFont                     logFont
+	MenuWidth, MenuHeight             int32
+	MenuFont, StatusFont, MessageFont logFont
+	PaddedBorderWidth                 int32
+}
+
+// https://docs.microsoft.com/en-us/windows/win32/api/winuser/ns-winuser-measureitemstruct
+type measureItemStruct struct {
+	CtlType, CtlID, ItemID uint32
+	ItemWidth, ItemHeight  uint32
+	ItemData               uintptr
+}
+
+// https://docs.microsoft.com/en-us/windows/win32/api/winuser/ns-winuser-drawitemstruct
+type drawItemStruct struct {
+	CtlType, CtlID, ItemID uint32
+	ItemAction, ItemState  uint32
+	HwndItem, HDC          windows.Handle
+	RcItem                 rect
+	ItemData               uintptr
+}
+
+const (
+	ODT_MENU = 1
+
+	DT_LEFT       = 0x0
+	DT_VCENTER    = 0x4
+	DT_SINGLELINE = 0x20
+	DT_CALCRECT   = 0x400
+	DT_HIDEPREFIX = 0x100000
+)
+
+// setOwnerDrawn records the title and style to draw the menu item with, and
+// whether it's grayed. It reports whether the whole menu switched owner draw
+// mode, as it is while any menu item has a custom style, in which case the
+// other menu items must be updated.
+func (t *winTray) setOwnerDrawn(menuItemId uint32, title string, style *ItemStyle, grayed bool) (switched bool) {
+	t.muOwnerDrawn.Lock()
+	defer t.muOwnerDrawn.Unlock()
+	switched = t.countStyled(menuItemId, style != nil)
+	item := ownerDrawnItem{title: title, styled: style != nil, grayed: grayed}
+	if style != nil {
+		item.style = *style
+	}
+	t.ownerDrawn[menuItemId] = item
+	return switched
+}
+
+// forgetOwnerDrawn drops the menu item once removed, reporting whether the
+// whole menu switched owner draw mode, see setOwnerDrawn.
+func (t *winTray) forgetOwnerDrawn(menuItemId uint32) (switched bool) {
+	t.muOwnerDrawn.Lock()
+	defer t.muOwnerDrawn.Unlock()
+	switched = t.countStyled(menuItemId, false)
+	delete(t.ownerDrawn, menuItemId)
+	return switched
+}
+
+// countStyled updates styledItems as the menu item gets a custom style or
+// not, reporting whether the whole menu switched owner draw mode. It must be
+// called with muOwnerDrawn locked.
+func (t *winTray) countStyled(menuItemId uint32, styled bool) (switched bool) {
+	if t.ownerDrawn[menuItemId].styled == styled {
+		return false
+	}
+	if styled {
+		t.styledItems++
+		return t.styledItems == 1
+	}
+	t.styledItems--
+	return t.styledItems == 0
+}
+
+// isOwnerDrawn reports whether the menu item is drawn by the window
+// procedure, that is if any menu item has a custom style, or if it's grayed.
+func (t *winTray) isOwnerDrawn(menuItemId uint32) bool {
+	t.muOwnerDrawn.RLock()
+	defer t.muOwnerDrawn.RUnlock()
+	item, ok := t.ownerDrawn[menuItemId]
+	return ok && (t.styledItems > 0 || item.grayed)
+}
+
+func (t *winTray) ownerDrawnItem(menuItemId uint32) (ownerDrawnItem, bool) {
+	t.muOwnerDrawn.RLock()
+	defer t.muOwnerDrawn.RUnlock()
+	item, ok := t.ownerDrawn[menuItemId]
+	if !ok || (t.styledItems == 0 && !item.grayed) {
+		return ownerDrawnItem{}, false
+	}
+	return item, true
+}
+
+// menuFont creates the font of the menus, in bold if asked.
+func menuFont(bold bool) (windows.Handle, error) {
+	const (
+		SPI_GETNONCLIENTMETRICS = 0x0029
+		FW_BOLD                 = 700
+	)
+	var ncm nonClientMetrics
+	ncm.Size = uint32(unsafe.Sizeof(ncm))
+	res, _, err := pSystemParametersInfo.Call(SPI_GETNONCLIENTMETRICS, uintptr(ncm.Size), uintptr(unsafe.Pointer(&ncm)), 0)
+	if res == 0 {
+		return 0, err
+	}
+	if bold {
+		ncm.MenuFont.Weight = FW_BOLD
+	}
+	hFont, _, err := pCreateFontIndirect.Call(uintptr(unsafe.Pointer(&ncm.MenuFont)))
+	if hFont == 0 {
+		return 0, err
+	}
+	return windows.Handle(hFont), nil
+}
+
+// checkWidth is the room left of the title, for the check mark.
+func checkWidth() int32 {
+	const SM_CXMENUCHECK = 71
+	cx, _, _ := pGetSystemMetrics.Call(SM_CXMENUCHECK)
+	return int32(cx) * 2
+}
+
+// measureItem handles WM_MEASUREITEM, reporting whether the item was measured.
+func (t *winTray) measureItem(lParam uintptr) bool {
+	// lParam points to the struct, reinterpreted that way to please go vet
+	mis := *(**measureItemStruct)(unsafe.Pointer(&lParam))
+	if mis.CtlType != ODT_MENU {
+		return false
+	}
+	item, ok := t.ownerDrawnItem(mis.ItemID)
+	if !ok {
+		return false
+	}
+	titlePtr, err := windows.UTF16PtrFromString(item.title)
+	if err != nil {
+		return false
+	}
+	hDC, _, _ := pGetDC.Call(uintptr(t.window))
+	if hDC == 0 {
+		return false
+	}
+	defer pReleaseDC.Call(uintptr(t.window), hDC)
+	hFont, err := menuFont(item.style.Bold)
+	if err != nil {
+		return false
+	}
+	defer pDeleteObject.Call(uintptr(hFont))
+	hOriginalFont, _, _ := pSelectObject.Call(hDC, uintptr(hFont))
+	var r rect
+	pDrawText.Call(hDC, uintptr(unsafe.Pointer(titlePtr)), ^uintptr(0), uintptr(unsafe.Pointer(&r)), DT_SINGLELINE|DT_CALCRECT)
+	pSelectObject.Call(hDC, hOriginalFont)
+
+	const SM_CYMENU = 15
+	cy, _, _ := pGetSystemMetrics.Call(SM_CYMENU)
+	mis.ItemWidth = uint32(r.Right - r.Left + checkWidth())
+	mis.ItemHeight = uint32(r.Bottom - r.Top + 8)
+	if mis.ItemHeight < uint32(cy) {
+		mis.ItemHeight = uint32(cy)
+	}
+	return true
+}
+
+// drawItem handles WM_DRAWITEM, reporting whether the item was drawn.
+func (t *winTray) drawItem(lParam uintptr) bool {
+	const (
+		ODS_SELECTED = 0x0001
+		ODS_GRAYED   = 0x0002
+		ODS_DISABLED = 0x0004
+		ODS_CHECKED  = 0x0008
+		ODS_DEFAULT  = 0x0020
+		ODS_NOACCEL  = 0x0100
+	)
+	const (
+		COLOR_MENU          = 4
+		COLOR_MENUTEXT      = 7
+		COLOR_HIGHLIGHT     = 13
+		COLOR_HIGHLIGHTTEXT = 14
+		COLOR_GRAYTEXT      = 17
+	)
+	const TRANSPARENT = 1
+	dis := *(**drawItemStruct)(unsafe.Pointer(&lParam))
+	if dis.CtlType != ODT_MENU {
+		return false
+	}
+	item, ok := t.ownerDrawnItem(dis.ItemID)
+	if !ok {
+		return false
+	}
+
+	sysColor := func(index uintptr) uintptr {
+		c, _, _ := pGetSysColor.Call(index)
+		return c
+	}
+	back := sysColor(COLOR_MENU)
+	if item.style.BackColor.A != 0 {
+		back = colorRef(item.style.BackColor)
+	}
+	fore := sysColor(COLOR_MENUTEXT)
+	if item.style.ForeColor.A != 0 {
+		fore = colorRef(item.style.ForeColor)
+	}
+	if dis.ItemState&ODS_SELECTED != 0 {
+		back = sysColor(COLOR_HIGHLIGHT)
+		fore = sysColor(COLOR_HIGHLIGHTTEXT)
+	}
+	if item.grayed || dis.ItemState&(ODS_GRAYED|ODS_DISABLED) != 0 {
+		fore = sysColor(COLOR_GRAYTEXT)
+	}
+
+	hBrush, _, _ := pCreateSolidBrush.Call(back)
+	pFillRect.Call(uintptr(dis.HDC), uintptr(unsafe.Pointer(&dis.RcItem)), hBrush)
+	pDeleteObject.Call(hBrush)
+
+	// section headers are the default items, bold when drawn by the system
+	hFont, err := menuFont(item.style.Bold || dis.ItemState&ODS_DEFAULT != 0)
+	if err != nil {
+		return true
+	}
+	defer pDeleteObject.Call(uintptr(hFont))
+	hOriginalFont, _, _ := pSelectObject.Call(uintptr(dis.HDC), uintptr(hFont))
+	pSetBkMode.Call(uintptr(dis.HDC), TRANSPARENT)
+	pSetTextColor.Call(uintptr(dis.HDC), fore)
+	var format uintptr = DT_LEFT | DT_VCENTER | DT_SINGLELINE
+	if dis.ItemState&ODS_NOACCEL != 0 {
+		format |= DT_HIDEPREFIX
+	}
+	if dis.ItemState&ODS_CHECKED != 0 {
+		checkRect := dis.RcItem
+		checkRect.Left += checkWidth() / 4
+		if check, err := windows.UTF16PtrFromString("✓"); err == nil {
+			pDrawText.Call(uintptr(dis.HDC), uintptr(unsafe.Pointer(check)), ^uintptr(0), uintptr(unsafe.Pointer(&checkRect)), format)
+		}
+	}
+	textRect := dis.RcItem
+	textRect.Left += checkWidth()
+	if titlePtr, err := windows.UTF16PtrFromString(item.title); err == nil {
+		pDrawText.Call(uintptr(dis.HDC), uintptr(unsafe.Pointer(titlePtr)), ^uintptr(0), uintptr(unsafe.Pointer(&textRect)), format)
+	}
+	pSelectObject.Call(uintptr(dis.HDC), hOriginalFont)
+	return true
+}
+
+// colorRef converts c to a COLORREF, which is 0x00bbggrr.
+func colorRef(c color.RGBA) uintptr {
+	return uintptr(c.B)<<16 | uintptr(c.G)<<8 | uintptr(c.R)
+}
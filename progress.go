@@ -0,0 +1,93 @@
+package systray
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// progressBarWidth is the number of cells of the progress bars drawn in
+// titles.
+const progressBarWidth = 10
+
+// ProgressMenuItem is a menu item showing a progress bar along with its
+// title, e.g. for a download. It's a MenuItem in every other respect.
+type ProgressMenuItem struct {
+	*MenuItem
+
+	mu       sync.Mutex
+	title    string
+	progress float64
+}
+
+// NewProgressMenuItem adds a menu item showing title and a progress bar,
+// empty until SetProgress is called. On macOS, it's a native progress bar
+// below the title. Elsewhere, the bar is drawn in the title, e.g.
+// "Downloading [█████░░░░░] 50%", as menus can't embed one.
+func NewProgressMenuItem(title string, opts ...MenuItemOption) *ProgressMenuItem {
+	item := &ProgressMenuItem{
+		MenuItem: NewMenuItem(title, opts...),
+		title:    title,
+	}
+	item.show()
+	return item
+}
+
+// SetProgress sets the progress from 0.0 to 1.0, values out of range being
+// clamped.
+func (item *ProgressMenuItem) SetProgress(progress float64) {
+	if progress < 0 {
+		progress = 0
+	} else if progress > 1 {
+		progress = 1
+	}
+	item.mu.Lock()
+	item.progress = progress
+	item.mu.Unlock()
+	item.show()
+}
+
+// Progress returns the progress set by SetProgress.
+func (item *ProgressMenuItem) Progress() float64 {
+	item.mu.Lock()
+	defer item.mu.Unlock()
+	return item.progress
+}
+
+// GetTitle returns the text shown along with the progress bar, as set by
+// NewProgressMenuItem or SetTitle, on every platform, without the progress
+// bar drawn in the title outside of macOS.
+func (item *ProgressMenuItem) GetTitle() string {
+	item.mu.Lock()
+	defer item.mu.Unlock()
+	return item.title
+}
+
+// SetTitle sets the text shown along with the progress bar.
+func (item *ProgressMenuItem) SetTitle(title string) {
+	item.mu.Lock()
+	item.title = title
+	item.mu.Unlock()
+	item.show()
+}
+
+func (item *ProgressMenuItem) show() {
+	if item.isRemoved() {
+		return
+	}
+	item.mu.Lock()
+	title, progress := item.title, item.progress
+	item.mu.Unlock()
+	if !setMenuItemProgress(item.MenuItem, title, progress) {
+		item.MenuItem.SetTitle(progressTitle(title, progress))
+	}
+}
+
+// progressTitle returns title followed by a progress bar drawn with block
+// characters and the percentage.
+func progressTitle(title string, progress float64) string {
+	filled := int(progress*progressBarWidth + 0.5)
+	return fmt.Sprintf("%s [%s%s] %d%%", title,
+		strings.Repeat("█", filled), strings.Repeat("░", progressBarWidth-filled),
+		int(progress*100+0.5))
+}
@@ -0,0 +1,97 @@
+package systray
+
+import (
+	"sync"
+)
+
+// RadioGroup is a set of checkable menu items of which at most one is
+// checked at a time. Windows and Linux show the checked item with a radio
+// mark, macOS with a tick as its guidelines recommend for mutually exclusive
+// items.
+type RadioGroup struct {
+	items    []*MenuItem
+	onChange func(index int)
+
+	mu       sync.Mutex
+	selected int
+}
+
+// NewMenuItemRadioGroup adds a menu item for each of titles, linked so that
+// clicking one of them checks it and unchecks the others. selectedIndex is
+// the item initially checked, -1 for none. onChange, if not nil, is called
+// with the index of the item the user clicked when the selection changes.
+// opts apply to all the menu items, e.g. WithParent to add the group to a
+// sub menu.
+func NewMenuItemRadioGroup(titles []string, selectedIndex int, onChange func(index int), opts ...MenuItemOption) *RadioGroup {
+	if selectedIndex < 0 || selectedIndex >= len(titles) {
+		selectedIndex = -1
+	}
+	g := &RadioGroup{
+		onChange: onChange,
+		selected: selectedIndex,
+	}
+	for i, title := range titles {
+		i := i
+		itemOpts := append([]MenuItemOption(nil), opts...)
+		itemOpts = append(itemOpts,
+			WithCheckable(i == selectedIndex),
+			withRadio(),
+			WithOnClickedFunc(func() { g.clicked(i) }),
+		)
+		g.items = append(g.items, NewMenuItem(title, itemOpts...))
+	}
+	return g
+}
+
+// withRadio makes the menuItem to be created a radio item.
+func withRadio() MenuItemOption {
+	return func(item *MenuItem) {
+		item.isRadio = true
+	}
+}
+
+// Items returns the menu items of the group, in the order of their titles.
+func (g *RadioGroup) Items() []*MenuItem {
+	return append([]*MenuItem(nil), g.items...)
+}
+
+// Selected returns the index of the checked menu item, or -1 if none is.
+func (g *RadioGroup) Selected() int {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.selected
+}
+
+// SetSelected checks the menu item at index and unchecks the others. An
+// index out of range unchecks all of them. It doesn't invoke onChange.
+func (g *RadioGroup) SetSelected(index int) {
+	g.setSelected(index)
+}
+
+// setSelected updates the selection and reports whether it changed.
+func (g *RadioGroup) setSelected(index int) bool {
+	if index < 0 || index >= len(g.items) {
+		index = -1
+	}
+	g.mu.Lock()
+	changed := g.selected != index
+	g.selected = index
+	g.mu.Unlock()
+
+	// always refresh all items, as some platforms toggle the native check
+	// mark by themselves on click
+	for i, item := range g.items {
+		if i == index {
+			item.Check()
+		} else {
+			item.Uncheck()
+		}
+	}
+	return changed
+}
+
+func (g *RadioGroup) clicked(index int) {
+	if g.setSelected(index) && g.onChange != nil {
+		g.onChange(index)
+	}
+}
@@ -0,0 +1,73 @@
+package systray
+
+import (
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// minUpdateInterval is the minimum time between two native updates of a
+// menu item in nanoseconds, 0 if not limited, see SetMaxUpdateRate.
+var minUpdateInterval int64
+
+// updateLimiter coalesces the native updates of a menu item, see
+// SetMaxUpdateRate.
+type updateLimiter struct {
+	mu sync.Mutex
+	// timer applies the latest state of the menu item once the interval
+	// elapsed, nil if no update is pending
+	timer *time.Timer
+	// last is the time of the latest native update
+	last time.Time
+}
+
+// SetMaxUpdateRate limits the native updates of each menu item, e.g. by
+// SetTitle, to hz per second, so that changing a menu item in a hot loop
+// doesn't flood the native event loop. Updates made within the interval are
+// coalesced into a single one applied at its end, with the latest state of
+// the menu item: intermediate states may never show up. A hz of 0 or less,
+// the default, removes the limit, updates then being applied right away.
+func SetMaxUpdateRate(hz float64) {
+	var interval int64
+	if hz > 0 && !math.IsInf(hz, 1) {
+		interval = int64(float64(time.Second) / hz)
+	}
+	atomic.StoreInt64(&minUpdateInterval, interval)
+}
+
+// throttledAddOrUpdate propagates the menu item to the native menu, right
+// away unless it was propagated less than the interval set by
+// SetMaxUpdateRate ago, in which case it's propagated at the end of the
+// interval.
+func (item *MenuItem) throttledAddOrUpdate() {
+	interval := time.Duration(atomic.LoadInt64(&minUpdateInterval))
+	l := &item.updates
+	l.mu.Lock()
+	if l.timer != nil {
+		// the pending update applies the latest state anyway
+		l.mu.Unlock()
+		return
+	}
+	now := time.Now()
+	if wait := interval - now.Sub(l.last); interval > 0 && !l.last.IsZero() && wait > 0 {
+		l.timer = time.AfterFunc(wait, func() {
+			l.mu.Lock()
+			l.timer = nil
+			l.last = time.Now()
+			l.mu.Unlock()
+			if item.isRemoved() {
+				return
+			}
+			item.addOrUpdate()
+			if item.isRemoved() {
+				item.forget()
+			}
+		})
+		l.mu.Unlock()
+		return
+	}
+	l.last = now
+	l.mu.Unlock()
+	item.addOrUpdate()
+}
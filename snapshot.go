@@ -0,0 +1,37 @@
+package systray
+
+// MenuItemSnapshot is the state of a menu item at the time SnapshotMenu was
+// called. It can be marshaled to JSON, e.g. to log or diff the menu.
+type MenuItemSnapshot struct {
+	ID       uint32
+	Title    string
+	Tooltip  string
+	Disabled bool
+	Checked  bool
+	Visible  bool
+	// ParentID is the ID of the menu item whose sub menu contains the menu
+	// item, 0 for the main menu.
+	ParentID    uint32
+	IsSeparator bool
+}
+
+// SnapshotMenu returns the state of all the menu items, sub menu items and
+// separators included, in creation order. The tree can be rebuilt from
+// ParentID.
+func SnapshotMenu() []MenuItemSnapshot {
+	var snapshot []MenuItemSnapshot
+	WalkMenuItems(func(item *MenuItem) bool {
+		snapshot = append(snapshot, MenuItemSnapshot{
+			ID:          item.id,
+			Title:       item.loadTitle(),
+			Tooltip:     item.loadTooltip(),
+			Disabled:    item.IsDisabled(),
+			Checked:     item.IsChecked(),
+			Visible:     item.IsVisible(),
+			ParentID:    item.parentId(),
+			IsSeparator: item.IsSeparator(),
+		})
+		return true
+	})
+	return snapshot
+}
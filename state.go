@@ -0,0 +1,87 @@
+package systray
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// The systray goes through these states, in this order, each time it's run,
+// starting from stateIdle.
+const (
+	// stateIdle is the state until the systray is first run
+	stateIdle int32 = iota
+	// stateInit is the state until the event loop is set up
+	stateInit
+	// stateRunning is the state once the systray is ready
+	stateRunning
+	// stateQuitting is the state from Quit until onExit returns
+	stateQuitting
+	// stateStopped is the state once onExit has returned
+	stateStopped
+)
+
+var state = stateIdle
+
+// IsRunning reports whether the systray is ready, that is once onReady is
+// invoked and until Quit is called. Calling systray functions before that
+// may misbehave on some platforms.
+func IsRunning() bool {
+	return atomic.LoadInt32(&state) == stateRunning
+}
+
+func setState(s int32) {
+	atomic.StoreInt32(&state, s)
+	if s == stateStopped {
+		resetReady()
+	}
+}
+
+// beginQuitting switches to stateQuitting if the systray is initializing or
+// running, returning the state it was in.
+func beginQuitting() int32 {
+	for {
+		s := atomic.LoadInt32(&state)
+		if s != stateInit && s != stateRunning {
+			return s
+		}
+		if atomic.CompareAndSwapInt32(&state, s, stateQuitting) {
+			return s
+		}
+	}
+}
+
+var (
+	// ready is closed once the systray is ready, and replaced once it
+	// stopped, see WaitForReady
+	ready   = make(chan struct{})
+	muReady sync.Mutex
+)
+
+// WaitForReady returns a channel closed once the systray is ready, right
+// before onReady is invoked, so that goroutines started before Run can wait
+// for it before calling other systray functions. It can be called before
+// Run. The channel is never closed if the initialization fails, or if Quit is
+// called before the systray is ready. Once the systray exits, WaitForReady
+// returns a new channel, closed when the systray is run again.
+func WaitForReady() <-chan struct{} {
+	muReady.Lock()
+	defer muReady.Unlock()
+	return ready
+}
+
+// resetReady replaces the ready channel if it was closed.
+func resetReady() {
+	muReady.Lock()
+	defer muReady.Unlock()
+	select {
+	case <-ready:
+		ready = make(chan struct{})
+	default:
+	}
+}
+
+func closeReady() {
+	muReady.Lock()
+	defer muReady.Unlock()
+	close(ready)
+}
@@ -0,0 +1,147 @@
+package systray
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/draw"
+	"sync"
+)
+
+// StatusColor is the color of the status dot drawn over the systray icon by
+// SetStatusColor.
+type StatusColor int
+
+const (
+	// StatusGreen tells all is well.
+	StatusGreen StatusColor = iota
+	// StatusYellow tells something needs attention.
+	StatusYellow
+	// StatusRed tells something is wrong.
+	StatusRed
+	// StatusGray tells the status is unknown or the app inactive.
+	StatusGray
+)
+
+var statusColors = map[StatusColor]color.RGBA{
+	StatusGreen:  {R: 0x2e, G: 0xb8, B: 0x4a, A: 0xff},
+	StatusYellow: {R: 0xf2, G: 0xc0, B: 0x1e, A: 0xff},
+	StatusRed:    {R: 0xe0, G: 0x2c, B: 0x2c, A: 0xff},
+	StatusGray:   {R: 0x9a, G: 0x9a, B: 0x9a, A: 0xff},
+}
+
+var (
+	// baseIcon is the icon set by SetBaseIcon, the zero Icon if none
+	baseIcon Icon
+	// status is the color set by SetStatusColor, nil if none
+	status   *StatusColor
+	muStatus sync.Mutex
+)
+
+// SetBaseIcon sets the icon SetStatusColor draws the status dot over, and
+// sets it as the systray icon, with the dot if a status is set. iconBytes may
+// be .png data, or .ico and .icns data as long as their largest image is
+// stored as PNG. Errors are reported to the Logger, see SetLogger.
+func SetBaseIcon(iconBytes []byte) {
+	if err := setBaseIcon(iconBytes); err != nil {
+		logStatusError("SetBaseIcon", err)
+	}
+}
+
+func setBaseIcon(iconBytes []byte) error {
+	if err := validateIcon(iconBytes); err != nil {
+		return err
+	}
+	pngBytes, err := iconAsPNG(iconBytes)
+	if err != nil {
+		return err
+	}
+	img, _, err := image.Decode(bytes.NewReader(pngBytes))
+	if err != nil {
+		return ErrUnsupportedIconFormat
+	}
+	muStatus.Lock()
+	defer muStatus.Unlock()
+	baseIcon = NewIcon(img)
+	if status == nil {
+		return setStatusIcon(iconBytes)
+	}
+	return showStatus()
+}
+
+// SetStatusColor draws a dot of color s over the bottom right corner of the
+// base icon set by SetBaseIcon, or of an empty icon if none is set, and sets
+// the result as the systray icon, e.g. for monitoring apps to show a health
+// check as a traffic light without an icon per state. Calling SetIcon
+// afterwards replaces the icon as usual and clears the status, so that
+// SetBaseIcon no longer draws the dot until SetStatusColor is called again.
+// Errors are reported to the Logger, see SetLogger.
+func SetStatusColor(s StatusColor) {
+	if _, ok := statusColors[s]; !ok {
+		s = StatusGray
+	}
+	muStatus.Lock()
+	defer muStatus.Unlock()
+	status = &s
+	if err := showStatus(); err != nil {
+		logStatusError("SetStatusColor", err)
+	}
+}
+
+// clearStatusColor forgets the status set by SetStatusColor, as SetIcon
+// replaced the icon with the dot.
+func clearStatusColor() {
+	muStatus.Lock()
+	status = nil
+	muStatus.Unlock()
+}
+
+// showStatus sets the base icon with the status dot as the systray icon, with
+// muStatus held.
+func showStatus() error {
+	icon := baseIcon
+	if icon.img == nil {
+		w, h := icon.RecommendedSize()
+		icon = NewIcon(image.NewRGBA(image.Rect(0, 0, w, h)))
+	}
+	iconBytes, err := icon.drawStatusDot(statusColors[*status]).Encode()
+	if err != nil {
+		return err
+	}
+	return setStatusIcon(iconBytes)
+}
+
+// setStatusIcon sets the systray icon like SetIcon, but keeps the status.
+func setStatusIcon(iconBytes []byte) error {
+	stopIconAnimation()
+	return setIcon(iconBytes)
+}
+
+// logStatusError logs the error of the operation op if a Logger is set.
+func logStatusError(op string, err error) {
+	if l := currentLogger(); l != nil {
+		l.Errorf("%s: %v", op, err)
+	}
+}
+
+// drawStatusDot returns the icon with a dot of color c, circled in white to
+// stand out from the icon, over its bottom right corner.
+func (icon Icon) drawStatusDot(c color.RGBA) Icon {
+	img := icon.clone()
+	size := img.Rect.Dx()
+	if img.Rect.Dy() < size {
+		size = img.Rect.Dy()
+	}
+	diameter := size / 2
+	if diameter <= 0 {
+		return Icon{img}
+	}
+	dot := image.Rect(img.Rect.Max.X-diameter, img.Rect.Max.Y-diameter, img.Rect.Max.X, img.Rect.Max.Y)
+	outline := float64(diameter) / 8
+	if outline < 1 {
+		outline = 1
+	}
+	draw.DrawMask(img, dot, image.NewUniform(color.White), image.Point{}, disc{diameter, float64(diameter) / 2}, image.Point{}, draw.Over)
+	draw.DrawMask(img, dot, image.NewUniform(c), image.Point{}, disc{diameter, float64(diameter)/2 - outline}, image.Point{}, draw.Over)
+	return Icon{img}
+}
@@ -0,0 +1,25 @@
+package systray
+
+import (
+	"image/color"
+)
+
+// ItemStyle is the custom look of a menu item, see WithItemStyle.
+type ItemStyle struct {
+	// Bold shows the title in bold.
+	Bold bool
+	// ForeColor is the color of the title, and BackColor the one of the
+	// background. Colors with a zero alpha leave the default color, and
+	// alpha is otherwise ignored.
+	ForeColor, BackColor color.RGBA
+}
+
+// WithItemStyle sets the look of the MenuItem to be created. It's only
+// supported on Windows, where the whole menu is then drawn by systray rather
+// than by the system, for the menu items to look alike, showing no icons,
+// for as long as any menu item has a style. It's a no-op on other platforms.
+func WithItemStyle(s ItemStyle) MenuItemOption {
+	return func(item *MenuItem) {
+		item.style = &s
+	}
+}
@@ -0,0 +1,31 @@
+package systray
+
+// SubMenu is a menu item with a sub menu, its header being the embedded
+// MenuItem, whose methods apply to the header: hiding it hides the whole sub
+// menu, its items keeping their own state. E.g.
+//
+//	sub := systray.NewSubMenu("More")
+//	sub.AddItem("Help")
+//	sub.AddSeparator()
+//	sub.AddItem("About")
+type SubMenu struct {
+	*MenuItem
+}
+
+// NewSubMenu adds the header of a sub menu to the menu, see NewMenuItem.
+// The sub menu is only shown once it has items.
+func NewSubMenu(title string, opts ...MenuItemOption) *SubMenu {
+	return &SubMenu{MenuItem: NewMenuItem(title, opts...)}
+}
+
+// AddItem appends a menu item to the sub menu, like NewMenuItem with
+// WithParent, overriding any other WithParent option.
+func (s *SubMenu) AddItem(title string, opts ...MenuItemOption) *MenuItem {
+	opts = append(opts[:len(opts):len(opts)], WithParent(s.MenuItem))
+	return NewMenuItem(title, opts...)
+}
+
+// AddSeparator appends a separator bar to the sub menu.
+func (s *SubMenu) AddSeparator() {
+	newSeparator(s.MenuItem)
+}
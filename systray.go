@@ -4,29 +4,103 @@ Package systray is a cross-platform Go library to place an icon and menu in the
 package systray
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"log"
 	"runtime"
+	"sort"
+	"strings"
 	"sync"
 	"sync/atomic"
+	"time"
 )
 
 var (
 	systrayReady = func() {}
 	systrayExit  = func() {}
-	menuItems    sync.Map // map[uint32]*menuItem
+	menuItems    sync.Map // map[uint32]*MenuItem
 
 	currentID = uint32(0)
-	quitOnce  sync.Once
+	// quitOnce makes Quit end the event loop once per run, replaced by
+	// register
+	quitOnce   = new(sync.Once)
+	muQuitOnce sync.Mutex
+
+	// clickCtx is passed to the callbacks set by WithOnClickedFuncContext,
+	// and cancelled when the systray quits
+	clickCtx, cancelClickCtx = context.WithCancel(context.Background())
+	muClickCtx               sync.Mutex
+
+	// errorHandler is called with the errors of native updates, see
+	// SetErrorHandler
+	errorHandler   func(error)
+	muErrorHandler sync.RWMutex
+)
+
+var (
+	// ErrMenuItemRemoved is returned when operating on a removed menu item.
+	ErrMenuItemRemoved = errors.New("systray: menu item has been removed")
+	// ErrNotSameMenu is returned when menu items expected to belong to the
+	// same menu don't.
+	ErrNotSameMenu = errors.New("systray: menu items don't belong to the same menu")
+	// ErrMoveAroundItself is returned when moving a menu item before or after
+	// itself.
+	ErrMoveAroundItself = errors.New("systray: menu item can't be moved around itself")
+	// ErrCheckableUnchangeable is returned when the platform can't change
+	// whether an existing menu item is checkable, in which case it has to be
+	// recreated with or without WithCheckable.
+	ErrCheckableUnchangeable = errors.New("systray: menu item must be recreated to change whether it's checkable")
 )
 
 func init() {
 	runtime.LockOSThread()
 }
 
-// menuItem is used to keep track each menu item of systray.
-type menuItem struct {
+// SetErrorHandler sets the function to call with the errors the native menu
+// reports when updating menu items, in addition to recording them, see
+// MenuItem.LastError. Errors are ignored by default, nil restores that.
+func SetErrorHandler(fn func(error)) {
+	muErrorHandler.Lock()
+	errorHandler = fn
+	muErrorHandler.Unlock()
+}
+
+func handleError(err error) {
+	muErrorHandler.RLock()
+	fn := errorHandler
+	muErrorHandler.RUnlock()
+	if fn != nil {
+		fn(err)
+	}
+}
+
+// MenuItem is used to keep track each menu item of systray.
+type MenuItem struct {
+	// mu guards the fields of the menu item which may be changed after it
+	// has been created
+	mu sync.RWMutex
+
 	// onClicked is the callback function which will be called when the menu item is clicked
 	onClicked func()
+	// clickCh receives the menu item when it is clicked, if set
+	clickCh chan<- *MenuItem
+	// middlewares intercept the clicks, as set when the menu item was
+	// created, see UseClickMiddleware
+	middlewares []ClickMiddleware
+	// debounce and throttle limit how often the click callbacks are
+	// invoked, see WithDebounce and WithThrottle
+	debounce, throttle time.Duration
+	limiter            clickLimiter
+	// onOpen and onClose are the callback functions which will be called when
+	// the sub menu of the menu item opens and closes
+	onOpen, onClose func()
+	// onHover is the callback function which will be called when the cursor
+	// enters the menu item
+	onHover func()
+	// onChange is the callback of the menu items added by
+	// NewMenuItemCheckbox, nil for the other menu items
+	onChange func(checked bool)
 
 	// id uniquely identify a menu item, not supposed to be modified
 	id uint32
@@ -34,187 +108,1208 @@ type menuItem struct {
 	title string
 	// tooltip is the text shown when pointing to menu item
 	tooltip string
-	// disabled menu item is grayed out and has no effect when clicked
-	disabled bool
-	// checked menu item has a tick before the title
-	checked bool
-	// has the menu item a checkbox (Linux)
-	isCheckable bool
+	// description is the text announced by screen readers for the menu item
+	description string
+	// tooltipDelay is the delay before showing the tooltip in milliseconds,
+	// negative for the system default
+	tooltipDelay int
+	// disabled menu item is grayed out and has no effect when clicked, set
+	// to 1 when disabled
+	disabled int32
+	// softDisabled menu item is still clicked while disabled, see
+	// WithSoftDisable
+	softDisabled bool
+	// checked menu item has a tick before the title, set to 1 when checked
+	checked int32
+	// has the menu item a checkbox (Linux), set to 1 when checkable
+	isCheckable int32
+	// has the menu item a radio mark instead of a tick, see RadioGroup
+	isRadio bool
+	// is the menu item a section header, see NewMenuHeader
+	isHeader bool
+	// is the menu item a separator, see NewSeparator
+	isSeparator bool
+	// separator shown right before the label of a labeled separator, see
+	// NewLabeledSeparator
+	separator *MenuItem
+	// accelerator is the key to select the menu item with the keyboard
+	accelerator string
+	// icon is the content of the icon set by WithItemIcon, applied once the
+	// menu item is created, or by SetIcon since, guarded by mu
+	icon []byte
+	// iconWidth and iconHeight are the size of the icon declared by
+	// WithIconSize, 0 if not declared
+	iconWidth, iconHeight int
+	// style is the custom look of the menu item if any, see WithItemStyle
+	style *ItemStyle
 	// parent item, for sub menus
-	parent *menuItem
+	parent *MenuItem
+	// removed is set to 1 once the menu item is removed from the menu
+	removed int32
+	// hidden is set to 1 while the menu item is hidden, see Hide
+	hidden int32
+	// announced is set to 1 once the hooks were notified of the menu item
+	// being added, see RegisterMenuChangeHook
+	announced int32
+	// updates coalesces the native updates, see SetMaxUpdateRate
+	updates updateLimiter
+	// lastErr holds the error of the latest native update as a lastError,
+	// see LastError
+	lastErr atomic.Value
 }
 
-func (item *menuItem) String() string {
+// lastError wraps the error stored in MenuItem.lastErr, as atomic.Value can
+// store neither nil nor different concrete types.
+type lastError struct {
+	err error
+}
+
+func (item *MenuItem) String() string {
 	if item.parent == nil {
-		return fmt.Sprintf("menuItem[%d, %q]", item.id, item.title)
+		return fmt.Sprintf("MenuItem[%d, %q]", item.id, item.loadTitle())
 	}
-	return fmt.Sprintf("menuItem[%d, parent %d, %q]", item.id, item.parent.id, item.title)
+	return fmt.Sprintf("MenuItem[%d, parent %d, %q]", item.id, item.parent.id, item.loadTitle())
 }
 
 // Run initializes GUI and starts the event loop, then invokes the onReady
-// callback. It blocks until systray.Quit() is called.
-func Run(onReady func(), onExit func()) {
-	Register(onReady, onExit)
-	nativeLoop()
+// callback. It blocks until systray.Quit() is called. It panics if the
+// initialization fails, see RunE.
+func Run(onReady func(), onExit func(), opts ...Option) {
+	defaultTray.Run(onReady, onExit, opts...)
+}
+
+// initOrPanic panics if err, the error of RunE or RegisterE, is not nil,
+// unless the failure is only due to SYSTRAY_HEADLESS being set in a native
+// build, which is logged instead, so that headless runs exit cleanly.
+func initOrPanic(err error) {
+	if err == nil {
+		return
+	}
+	if errors.Is(err, errHeadlessUnsupported) {
+		log.Print(err)
+		return
+	}
+	panic(err)
+}
+
+// RunE is like Run, but returns an *InitError if the initialization fails,
+// e.g. when no display is available on Linux or the window of the tray icon
+// can't be created on Windows.
+func RunE(onReady func(), onExit func(), opts ...Option) error {
+	return defaultTray.RunE(onReady, onExit, opts...)
+}
+
+// RunWithContext is like Run but also quits the systray when ctx is done. It
+// blocks until the event loop exits, either because ctx is done or because
+// systray.Quit() is called.
+func RunWithContext(ctx context.Context, onReady func(), onExit func(), opts ...Option) {
+	defaultTray.RunWithContext(ctx, onReady, onExit, opts...)
+}
+
+// Option configures the systray, see Run and Register.
+type Option func(*options)
+
+type options struct {
+	exitTimeout time.Duration
+	// shutdownTimeout is set by ShutdownTimeout before the run
+	shutdownTimeout time.Duration
+	// statusItemPriority is set by WithStatusItemPriority, nil by default
+	statusItemPriority *int
+}
+
+// ExitTimeout runs the onExit callback in its own goroutine, and waits at
+// most d for it to return before the event loop exits, so that a blocking
+// onExit can't freeze the process. A warning is logged if it times out. By
+// default, onExit runs in the event loop and is waited for.
+func ExitTimeout(d time.Duration) Option {
+	return func(o *options) {
+		o.exitTimeout = d
+	}
+}
+
+// shutdownTimeout is the deadline of onExit in nanoseconds, see
+// ShutdownTimeout.
+var shutdownTimeout int64
+
+// ShutdownTimeout gives onExit at most d to return in the following runs of
+// the systray, for apps to set it once, e.g. in main before calling Run. Like
+// the deadline of http.Server.Shutdown, it's a hard one: past it, a warning
+// is logged and the process is terminated with exit status 1 by the OS,
+// without returning from Run. Unlike with ExitTimeout, onExit still runs in
+// the event loop. Pass 0 to wait for onExit again, the default.
+func ShutdownTimeout(d time.Duration) {
+	atomic.StoreInt64(&shutdownTimeout, int64(d))
+}
+
+// WithStatusItemPriority sets the priority of the status item on macOS, which
+// orders the items of the menu bar: higher priorities are placed further
+// right, next to the clock. macOS only exposes it privately, so it's ignored
+// if it becomes unavailable, as well as on other platforms, where the user or
+// the notification area orders the icons.
+func WithStatusItemPriority(priority int) Option {
+	return func(o *options) {
+		o.statusItemPriority = &priority
+	}
 }
 
 // Register initializes GUI and registers the callbacks but relies on the
 // caller to run the event loop somewhere else. It's useful if the program
 // needs to show other UI elements, for example, webview.
 // To overcome some OS weirdness, On macOS versions before Catalina, calling
-// this does exactly the same as Run().
-func Register(onReady func(), onExit func()) {
-	if onReady != nil {
-		systrayReady = func() {
+// this does exactly the same as Run(). It panics if the initialization fails,
+// see RegisterE.
+func Register(onReady func(), onExit func(), opts ...Option) {
+	defaultTray.Register(onReady, onExit, opts...)
+}
+
+// RegisterE is like Register, but returns an *InitError if the initialization
+// fails. On macOS, the status item is only created once the event loop runs,
+// so its creation failing is only reported by RunE, which makes the event
+// loop return.
+func RegisterE(onReady func(), onExit func(), opts ...Option) error {
+	return defaultTray.RegisterE(onReady, onExit, opts...)
+}
+
+func register(onReady func(), onExit func(), opts ...Option) error {
+	o := options{shutdownTimeout: time.Duration(atomic.LoadInt64(&shutdownTimeout))}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	setState(stateInit)
+	muQuitOnce.Lock()
+	quitOnce = new(sync.Once)
+	muQuitOnce.Unlock()
+	systrayReady = func() {
+		if !atomic.CompareAndSwapInt32(&state, stateInit, stateRunning) {
+			// Quit was called while initializing, which left quitting the
+			// event loop to now that it runs
+			quitEventLoop()
+			return
+		}
+		closeReady()
+		if onReady != nil {
 			go onReady()
 		}
 	}
 
 	// unlike onReady, onExit runs in the event loop to make sure it has time to
-	// finish before the process terminates
-	if onExit != nil {
-		systrayExit = onExit
+	// finish before the process terminates, unless ExitTimeout is set
+	systrayExit = func() {
+		defer setState(stateStopped)
+		cancelClickContext()
+		if onExit == nil {
+			return
+		}
+		if d := o.shutdownTimeout; d > 0 {
+			timer := time.AfterFunc(d, func() {
+				log.Printf("systray: onExit did not return within %v, terminating the process", d)
+				forceQuit()
+			})
+			defer timer.Stop()
+		}
+		if o.exitTimeout <= 0 {
+			onExit()
+			return
+		}
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			onExit()
+		}()
+		select {
+		case <-done:
+		case <-time.After(o.exitTimeout):
+			log.Printf("systray: onExit did not return within %v, exiting anyway", o.exitTimeout)
+		}
 	}
 
-	registerSystray()
+	muClickCtx.Lock()
+	clickCtx, cancelClickCtx = context.WithCancel(context.Background())
+	muClickCtx.Unlock()
+
+	if o.statusItemPriority != nil {
+		setStatusItemPriority(*o.statusItemPriority)
+	}
+	takeLateInitError()
+	err := registerSystray()
+	if err == nil {
+		// the event loop already ran on macOS versions before Catalina
+		err = takeLateInitError()
+	}
+	if err != nil {
+		setState(stateStopped)
+		cancelClickContext()
+		return err
+	}
+	return nil
 }
 
-// Quit the systray
+// Quit the systray. It's safe to call at any time, from any goroutine, and
+// more than once: it does nothing before the systray is first run or once it
+// quit, and if the systray is still initializing, it quits as soon as its
+// event loop is set up, without invoking onReady.
 func Quit() {
-	quitOnce.Do(quit)
+	was := beginQuitting()
+	if was == stateIdle {
+		return
+	}
+	cancelClickContext()
+	stopIconAnimation()
+	endAttentionMode()
+	unregisterHotkeys()
+	stopDebouncedClicks()
+	if was == stateInit {
+		// the native APIs may not be set up yet, systrayReady quits then
+		return
+	}
+	quitEventLoop()
+}
+
+// quitEventLoop ends the event loop, unless it was already ended in the
+// current run.
+func quitEventLoop() {
+	muQuitOnce.Lock()
+	once := quitOnce
+	muQuitOnce.Unlock()
+	once.Do(quit)
 }
 
-type MenuItemOption func(item *menuItem)
+// clickContext returns the context to pass to click callbacks.
+func clickContext() context.Context {
+	muClickCtx.Lock()
+	defer muClickCtx.Unlock()
+	return clickCtx
+}
+
+func cancelClickContext() {
+	muClickCtx.Lock()
+	defer muClickCtx.Unlock()
+	cancelClickCtx()
+}
+
+// SetTooltipText sets the text to display on mouse hover of the tray icon,
+// distinct from the tooltips of menu items. It's the same as SetTooltip.
+func SetTooltipText(text string) {
+	SetTooltip(text)
+}
 
-// WithTooltip sets the tooltip for menuItem
+type MenuItemOption func(item *MenuItem)
+
+// WithTooltip sets the tooltip for MenuItem
 func WithTooltip(tooltip string) MenuItemOption {
-	return func(item *menuItem) {
+	return func(item *MenuItem) {
 		item.tooltip = tooltip
 	}
 }
 
-// WithCheckable sets the menuItem to be checkable with initial value checked.
-// menuItem is checkable on Windows and OSX by default. This option is required
-// for Linux to have a checkable menuItem.
+// WithDescription sets the description of the MenuItem, see
+// MenuItem.SetDescription.
+func WithDescription(description string) MenuItemOption {
+	return func(item *MenuItem) {
+		item.description = description
+	}
+}
+
+// WithTooltipDelay sets the delay before showing the tooltip of the MenuItem,
+// see MenuItem.SetTooltipDelay.
+func WithTooltipDelay(ms int) MenuItemOption {
+	return func(item *MenuItem) {
+		item.tooltipDelay = ms
+	}
+}
+
+// WithCheckable sets the MenuItem to be checkable with initial value checked.
+// MenuItem is checkable on Windows and OSX by default. This option is required
+// for Linux to have a checkable MenuItem.
 func WithCheckable(checked bool) MenuItemOption {
-	return func(item *menuItem) {
-		item.isCheckable = true
-		item.checked = checked
+	return func(item *MenuItem) {
+		item.isCheckable = 1
+		if checked {
+			item.checked = 1
+		} else {
+			item.checked = 0
+		}
 	}
 }
 
-// WithParent sets the parent for menuItem to be created
-func WithParent(parent *menuItem) MenuItemOption {
-	return func(item *menuItem) {
+// WithParent sets the parent for MenuItem to be created
+func WithParent(parent *MenuItem) MenuItemOption {
+	return func(item *MenuItem) {
 		item.parent = parent
 	}
 }
 
-// WithDisable disables the menuItem to be created. menuItem is enabled by
+// WithDisable disables the MenuItem to be created. MenuItem is enabled by
 // default.
 func WithDisabled() MenuItemOption {
-	return func(item *menuItem) {
-		item.disabled = true
+	return func(item *MenuItem) {
+		item.disabled = 1
+	}
+}
+
+// WithSoftDisable disables the MenuItem to be created, but only in
+// appearance: the native menu item stays enabled so that clicks are still
+// delivered, and it's up to the callbacks to check IsDisabled. Enable and
+// Disable keep it that way. It's grayed out on every platform: its title is
+// drawn faded on Linux, and Windows draws it the way WithItemStyle does.
+func WithSoftDisable() MenuItemOption {
+	return func(item *MenuItem) {
+		item.disabled = 1
+		item.softDisabled = true
+	}
+}
+
+// WithID assigns id to the MenuItem instead of the next free ID, so that it
+// stays the same from run to run, e.g. to persist which menu item was last
+// clicked. An id of 0 leaves the ID to be assigned automatically. The menu
+// item creation panics if id is already in use by another menu item. As
+// automatically assigned IDs are greater than all the IDs assigned so far,
+// create the menu items with a stable ID first, or pick their IDs from a
+// range unlikely to collide.
+func WithID(id uint32) MenuItemOption {
+	return func(item *MenuItem) {
+		item.id = id
+	}
+}
+
+// WithAccelerator sets the key to select the menuItem with the keyboard while
+// the menu is open, e.g. "q" for a "Quit" item. On Windows and Linux, the
+// first occurrence of key in the title is underlined, or key is appended to
+// the title between parentheses if it doesn't occur. On macOS, it's set as
+// the key equivalent of the menu item, used with the Command key.
+func WithAccelerator(key string) MenuItemOption {
+	return func(item *MenuItem) {
+		item.accelerator = key
+	}
+}
+
+// WithItemIcon sets the icon shown before the title of the MenuItem, see
+// MenuItem.SetIcon.
+func WithItemIcon(iconBytes []byte) MenuItemOption {
+	return func(item *MenuItem) {
+		item.icon = iconBytes
+	}
+}
+
+// WithIconSize declares the size in pixels of the icons of the MenuItem, see
+// SetIconSize. Otherwise, icons are scaled to the size of menu icons on
+// Windows and Linux, and to 16x16 points on macOS.
+func WithIconSize(width, height int) MenuItemOption {
+	return func(item *MenuItem) {
+		item.iconWidth, item.iconHeight = width, height
 	}
 }
 
-// WithOnClickedFunc sets the callback function to call when a menuItem is
+// WithOnClickedFunc sets the callback function to call when a MenuItem is
 // clicked.
 func WithOnClickedFunc(callback func()) MenuItemOption {
-	return func(item *menuItem) {
+	return func(item *MenuItem) {
 		item.onClicked = callback
 	}
 }
 
+// WithOnClickedFuncContext is like WithOnClickedFunc, but passes callback a
+// context of its own for each click, which is cancelled once callback
+// returns, or when the systray quits, to tie the work of a click, e.g. in
+// goroutines that callback waits for, to the lifetime of the systray. The
+// context is cancelled asynchronously on Quit, while callback may still be
+// running, so it should watch ctx.Done() and return promptly.
+func WithOnClickedFuncContext(callback func(ctx context.Context)) MenuItemOption {
+	return func(item *MenuItem) {
+		item.onClicked = func() {
+			ctx, cancel := context.WithCancel(clickContext())
+			defer cancel()
+			callback(ctx)
+		}
+	}
+}
+
+// WithClickChan sets a channel to send the menuItem to when it's clicked, as
+// an alternative to WithOnClickedFunc which plays well with select loops. The
+// send never blocks: if the channel is not ready to receive, the click is
+// dropped, so use a buffered channel if clicks may come faster than they are
+// consumed.
+func WithClickChan(ch chan<- *MenuItem) MenuItemOption {
+	return func(item *MenuItem) {
+		item.clickCh = ch
+	}
+}
+
+// WithOnOpenFunc sets the callback function to call when the sub menu of the
+// MenuItem opens, e.g. to populate it lazily. Menu items added by the callback
+// show in the opening sub menu on Windows and macOS. On Linux, it relies on
+// the sub menu being mapped, which some indicator hosts never do.
+func WithOnOpenFunc(callback func()) MenuItemOption {
+	return func(item *MenuItem) {
+		item.onOpen = callback
+	}
+}
+
+// WithOnCloseFunc sets the callback function to call when the sub menu of the
+// MenuItem closes. See WithOnOpenFunc for the limitations on Linux.
+func WithOnCloseFunc(callback func()) MenuItemOption {
+	return func(item *MenuItem) {
+		item.onClose = callback
+	}
+}
+
+// WithOnHoverFunc sets the callback function to call when the cursor enters
+// the MenuItem, or it's selected with the keyboard, e.g. to prefetch what a
+// click would need. It's best effort: on Linux, it relies on the menu item
+// being selected in a GTK menu, which indicator hosts rendering the menu
+// themselves never do.
+func WithOnHoverFunc(callback func()) MenuItemOption {
+	return func(item *MenuItem) {
+		item.onHover = callback
+	}
+}
+
 // NewMenuItem adds a menu item with the designated title and tooltip.
 // It can be safely invoked from different goroutines.
-func NewMenuItem(title string, opts ...MenuItemOption) *menuItem {
-	item := &menuItem{
-		id:    atomic.AddUint32(&currentID, 1),
-		title: title,
+func NewMenuItem(title string, opts ...MenuItemOption) *MenuItem {
+	return newMenuItem(title, opts, nil, false)
+}
+
+// InsertMenuItemBefore adds a menu item right before anchor, in the same menu
+// as anchor regardless of any WithParent option. The menu item is appended
+// to the menu instead if anchor has been removed.
+func InsertMenuItemBefore(anchor *MenuItem, title string, opts ...MenuItemOption) *MenuItem {
+	return newMenuItem(title, opts, anchor, false)
+}
+
+// InsertMenuItemAfter adds a menu item right after anchor, in the same menu
+// as anchor regardless of any WithParent option. The menu item is appended
+// to the menu instead if anchor has been removed.
+func InsertMenuItemAfter(anchor *MenuItem, title string, opts ...MenuItemOption) *MenuItem {
+	return newMenuItem(title, opts, anchor, true)
+}
+
+func newMenuItem(title string, opts []MenuItemOption, anchor *MenuItem, after bool) *MenuItem {
+	if s := atomic.LoadInt32(&state); s == stateIdle || s == stateInit {
+		log.Printf("systray: menu item %q added before the systray is ready", title)
+	}
+	item := &MenuItem{
+		title:        title,
+		tooltipDelay: -1,
+		middlewares:  currentClickMiddlewares(),
 	}
 
 	for _, opt := range opts {
 		opt(item)
 	}
+	if item.id == 0 {
+		item.id = atomic.AddUint32(&currentID, 1)
+	} else {
+		reserveID(item)
+	}
+
+	var anchorID uint32
+	if anchor != nil {
+		item.parent = anchor.parent
+		anchorID = anchor.id
+	}
+	addToMenuOrder(item.parentId(), item.id, anchorID, after)
 
 	item.update()
+	if item.icon != nil {
+		item.SetIcon(item.icon)
+	}
+	if item.tooltipDelay >= 0 {
+		setTooltipDelay(item)
+	}
 	return item
 }
 
-// SetTitle set the text to display on a menu item
-func (item *menuItem) SetTitle(title string) {
+// reserveID registers item under the ID assigned by WithID, panicking if it's
+// taken, and makes sure the automatically assigned IDs don't
+// collide with it.
+func reserveID(item *MenuItem) {
+	if other, loaded := menuItems.LoadOrStore(item.id, item); loaded {
+		panic(fmt.Sprintf("systray: menu item ID %d is already in use by %v", item.id, other))
+	}
+	for {
+		current := atomic.LoadUint32(&currentID)
+		if current >= item.id || atomic.CompareAndSwapUint32(&currentID, current, item.id) {
+			return
+		}
+	}
+}
+
+// NewMenuHeader adds a section header with the designated title, a menu item
+// which labels the menu items following it and can't be clicked. It's
+// rendered as a bold disabled item on Windows and Linux, and as a small bold
+// gray label on macOS, similar to the native section headers.
+func NewMenuHeader(title string) *MenuItem {
+	return newMenuItem(title, []MenuItemOption{WithDisabled(), withHeader()}, nil, false)
+}
+
+// withHeader makes the menuItem to be created a section header.
+func withHeader() MenuItemOption {
+	return func(item *MenuItem) {
+		item.isHeader = true
+	}
+}
+
+// ID returns the ID of the menu item, unique among the menu items of the
+// process. Unless set by WithID, IDs are assigned in creation order, so they
+// are stable across restarts as long as the menu is built the same way.
+func (item *MenuItem) ID() uint32 {
+	return item.id
+}
+
+// GetID is an alias for ID.
+func (item *MenuItem) GetID() uint32 {
+	return item.id
+}
+
+// GetMenuItemByID returns the menu item with the given ID, if it exists and
+// hasn't been removed.
+func GetMenuItemByID(id uint32) (*MenuItem, bool) {
+	v, ok := menuItems.Load(id)
+	if !ok {
+		return nil, false
+	}
+	item, ok := v.(*MenuItem)
+	return item, ok
+}
+
+// WalkMenuItems calls fn for each menu item, sub menu items and separators
+// included, in creation order, until fn returns false. It walks a snapshot of the menu
+// items taken when called and holds no lock while calling fn, so fn may call
+// any method of the menu items: menu items it creates are not visited, while
+// menu items it removes are skipped. It can be safely invoked from different
+// goroutines.
+func WalkMenuItems(fn func(item *MenuItem) bool) {
+	for _, item := range sortedMenuItems(func(*MenuItem) bool { return true }) {
+		if item.isRemoved() {
+			continue
+		}
+		if !fn(item) {
+			return
+		}
+	}
+}
+
+// sortedMenuItems returns the menu items for which match returns true, in
+// creation order.
+func sortedMenuItems(match func(item *MenuItem) bool) []*MenuItem {
+	var items []*MenuItem
+	menuItems.Range(func(_, v interface{}) bool {
+		if item, ok := v.(*MenuItem); ok && match(item) {
+			items = append(items, item)
+		}
+		return true
+	})
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].id < items[j].id
+	})
+	return items
+}
+
+// SetMenuItemOrder reorders the menu containing items, which must all belong
+// to the same menu, so that they come first in the given order, followed by
+// the other menu items of the menu in their current relative order.
+// Separators keep their positions, only the menu items move around them.
+func SetMenuItemOrder(items []*MenuItem) error {
+	if len(items) == 0 {
+		return nil
+	}
+	parentID := items[0].parentId()
+	ids := make([]uint32, len(items))
+	for i, item := range items {
+		if item.isRemoved() {
+			return ErrMenuItemRemoved
+		}
+		if item.parentId() != parentID {
+			return ErrNotSameMenu
+		}
+		ids[i] = item.id
+	}
+	order := reorderMenu(parentID, ids)
+	reorderMenuItems(parentID, order)
+	return nil
+}
+
+// MoveBefore moves the menu item right before anchor, which must belong to
+// the same menu. Moving never changes the parent of the menu item: menu items
+// can't be moved to another menu.
+func (item *MenuItem) MoveBefore(anchor *MenuItem) error {
+	return item.move(anchor, false)
+}
+
+// MoveAfter moves the menu item right after anchor, which must belong to the
+// same menu. The menu item keeps its parent, see MoveBefore.
+func (item *MenuItem) MoveAfter(anchor *MenuItem) error {
+	return item.move(anchor, true)
+}
+
+func (item *MenuItem) move(anchor *MenuItem, after bool) error {
+	if item == anchor {
+		return ErrMoveAroundItself
+	}
+	if item.isRemoved() || anchor.isRemoved() {
+		return ErrMenuItemRemoved
+	}
+	parentID := item.parentId()
+	if anchor.parentId() != parentID {
+		return ErrNotSameMenu
+	}
+	if anchor.separator != nil && !after {
+		// don't split a labeled separator from its label
+		anchor = anchor.separator
+	}
+	order := moveInMenuOrder(parentID, item.id, anchor.id, after)
+	if item.separator != nil {
+		order = moveInMenuOrder(parentID, item.separator.id, item.id, false)
+	}
+	reorderMenuItems(parentID, order)
+	return nil
+}
+
+// SwapMenuItems exchanges the positions of a and b, which must belong to the
+// same menu, labeled separators moving along with their label. The native
+// menu is reordered once for both, rather than once per move as with
+// MoveBefore and MoveAfter. Swapping a menu item with itself does nothing.
+func SwapMenuItems(a, b *MenuItem) error {
+	if a.isRemoved() || b.isRemoved() {
+		return ErrMenuItemRemoved
+	}
+	parentID := a.parentId()
+	if b.parentId() != parentID {
+		return ErrNotSameMenu
+	}
+	if a == b {
+		return nil
+	}
+	order := swapInMenuOrder(parentID, a.orderIDs(), b.orderIDs())
+	reorderMenuItems(parentID, order)
+	return nil
+}
+
+// orderIDs returns the IDs the menu item takes in menuOrder, its labeled
+// separator coming first if any.
+func (item *MenuItem) orderIDs() []uint32 {
+	if item.separator != nil {
+		return []uint32{item.separator.id, item.id}
+	}
+	return []uint32{item.id}
+}
+
+// SetTitle set the text to display on a menu item. On Windows, changes made
+// from other goroutines while the menu shows are applied once it closes, to
+// avoid redrawing it incorrectly, except from the callbacks of
+// WithOnOpenFunc.
+func (item *MenuItem) SetTitle(title string) {
+	item.mu.Lock()
 	item.title = title
+	item.mu.Unlock()
 	item.update()
 }
 
 // SetTooltip set the tooltip to show when mouse hover
-func (item *menuItem) SetTooltip(tooltip string) {
+func (item *MenuItem) SetTooltip(tooltip string) {
+	item.mu.Lock()
 	item.tooltip = tooltip
+	item.mu.Unlock()
+	item.update()
+}
+
+// SetDescription sets the description of the menu item, which screen readers
+// announce in addition to its title. Unlike the tooltip, it's never shown.
+// It sets the accessibility help of the item on macOS, the accessible
+// description on Linux and the MSAA description on Windows.
+func (item *MenuItem) SetDescription(description string) {
+	item.mu.Lock()
+	item.description = description
+	item.mu.Unlock()
 	item.update()
 }
 
+// GetTitle returns the text displayed on the menu item. It can be safely
+// invoked concurrently with SetTitle.
+func (item *MenuItem) GetTitle() string {
+	return item.loadTitle()
+}
+
+// GetTooltip returns the tooltip of the menu item. It can be safely invoked
+// concurrently with SetTooltip.
+func (item *MenuItem) GetTooltip() string {
+	return item.loadTooltip()
+}
+
+// SetTooltipDelay sets the delay in milliseconds before showing the tooltip of
+// the menu item, 0 to show it immediately, e.g. when it holds important status
+// information, or a negative value for the system default. On Windows, the
+// tooltip is shown by a tracking tooltip after the delay of the menu item
+// being pointed to. macOS has no per item delay: it sets the delay of all the
+// tooltips of the app, the last one set wins. It's ignored on Linux, where
+// the indicator host renders the menu, and GTK 3 has no tooltip delay
+// anyway.
+func (item *MenuItem) SetTooltipDelay(ms int) {
+	item.mu.Lock()
+	item.tooltipDelay = ms
+	item.mu.Unlock()
+	if !item.isRemoved() {
+		setTooltipDelay(item)
+	}
+}
+
+// SetIcon sets the icon shown before the title of the menu item, scaled to
+// the menu icon size of the platform. iconBytes should be the content of .ico
+// for windows and .ico/.jpg/.png for other platforms. Invalid icons are
+// ignored. On Linux, checkable menu items can't have an icon.
+func (item *MenuItem) SetIcon(iconBytes []byte) {
+	if item.isRemoved() || item.isSeparator || validateIcon(iconBytes) != nil {
+		return
+	}
+	// kept for CloneMenuItem
+	item.mu.Lock()
+	item.icon = iconBytes
+	item.mu.Unlock()
+	setMenuItemIcon(item, iconBytes)
+}
+
+// SetOnClickedFunc replaces the callback function to call when the menu item
+// is clicked. It can be safely invoked from different goroutines, even while
+// the menu item is being clicked. A nil callback makes clicks do nothing.
+func (item *MenuItem) SetOnClickedFunc(callback func()) {
+	item.mu.Lock()
+	item.onClicked = callback
+	item.mu.Unlock()
+}
+
 // IsDisabled checks if the menu item is disabled
-func (item *menuItem) IsDisabled() bool {
-	return item.disabled
+func (item *MenuItem) IsDisabled() bool {
+	return atomic.LoadInt32(&item.disabled) == 1
 }
 
-// Enable a menu item regardless if it's previously enabled or not
-func (item *menuItem) Enable() {
-	item.disabled = false
+// Enable a menu item regardless if it's previously enabled or not. Section
+// headers can't be enabled: it does nothing on them, so that IsDisabled keeps
+// matching the native menu item.
+func (item *MenuItem) Enable() {
+	if item.isHeader {
+		return
+	}
+	atomic.StoreInt32(&item.disabled, 0)
 	item.update()
 }
 
-// Disable a menu item regardless if it's previously disabled or not
-func (item *menuItem) Disable() {
-	item.disabled = true
+// Disable a menu item regardless if it's previously disabled or not. Clicks
+// on disabled menu items are dropped by the platform, without invoking any
+// callback, see WithSoftDisable to still get them.
+func (item *MenuItem) Disable() {
+	atomic.StoreInt32(&item.disabled, 1)
 	item.update()
 }
 
+// SetEnabled enables the menu item if enabled is true, and disables it
+// otherwise.
+func (item *MenuItem) SetEnabled(enabled bool) {
+	if enabled {
+		item.Enable()
+	} else {
+		item.Disable()
+	}
+}
+
 // Hide hides a menu item
-func (item *menuItem) Hide() {
+func (item *MenuItem) Hide() {
+	if item.isRemoved() {
+		return
+	}
+	atomic.StoreInt32(&item.hidden, 1)
+	logOp("hideMenuItem", item)
 	hideMenuItem(item)
+	if item.separator != nil {
+		item.separator.Hide()
+	}
 }
 
 // Show shows a previously hidden menu item
-func (item *menuItem) Show() {
+func (item *MenuItem) Show() {
+	if item.isRemoved() {
+		return
+	}
+	if item.separator != nil {
+		item.separator.Show()
+	}
+	atomic.StoreInt32(&item.hidden, 0)
+	logOp("showMenuItem", item)
 	showMenuItem(item)
 }
 
+// IsVisible tells if the menu item is shown, i.e. it hasn't been hidden by
+// Hide, or has been shown again since.
+func (item *MenuItem) IsVisible() bool {
+	return atomic.LoadInt32(&item.hidden) == 0
+}
+
+// SetVisible shows the menu item if visible is true, and hides it otherwise.
+func (item *MenuItem) SetVisible(visible bool) {
+	if visible {
+		item.Show()
+	} else {
+		item.Hide()
+	}
+}
+
+// Remove removes a menu item, along with its sub menu items if any, from the
+// menu. Unlike Hide, the menu item can't be shown again: any further call on
+// it is a no-op.
+func (item *MenuItem) Remove() {
+	if !atomic.CompareAndSwapInt32(&item.removed, 0, 1) {
+		return
+	}
+	for _, child := range item.Children() {
+		child.Remove()
+	}
+	if item.separator != nil {
+		item.separator.Remove()
+	}
+	item.UnregisterHotkey()
+	item.limiter.stop()
+	DefaultMux.Handle(item, nil)
+	menuItems.Delete(item.id)
+	removeMenuItem(item)
+	delFromMenuOrder(item.parentId(), item.id)
+	notifyItemRemoved(item)
+}
+
+// mnemonicTitle returns title with its first occurrence of key, compared
+// case insensitively, prefixed by marker, which is the way Windows and GTK
+// underline the access key of menu items. Existing markers in title are
+// escaped by doubling them. If title doesn't contain key, it's appended
+// between parentheses after it.
+func mnemonicTitle(title, key, marker string) string {
+	if key == "" {
+		return title
+	}
+	title = strings.ReplaceAll(title, marker, marker+marker)
+	lowerKey := strings.ToLower(key)
+	for i, r := range title {
+		if strings.ToLower(string(r)) == lowerKey {
+			return title[:i] + marker + title[i:]
+		}
+	}
+	return title + " (" + marker + key + ")"
+}
+
+func (item *MenuItem) parentId() uint32 {
+	if item.parent != nil {
+		return item.parent.id
+	}
+	return 0
+}
+
+// loadTitle returns the title of the menu item, which may be set concurrently.
+func (item *MenuItem) loadTitle() string {
+	item.mu.RLock()
+	defer item.mu.RUnlock()
+	return item.title
+}
+
+// loadTooltip returns the tooltip of the menu item, which may be set
+// concurrently.
+func (item *MenuItem) loadTooltip() string {
+	item.mu.RLock()
+	defer item.mu.RUnlock()
+	return item.tooltip
+}
+
+// loadTooltipDelay returns the tooltip delay of the menu item, which may be
+// set concurrently.
+func (item *MenuItem) loadTooltipDelay() int {
+	item.mu.RLock()
+	defer item.mu.RUnlock()
+	return item.tooltipDelay
+}
+
+// loadDescription returns the description of the menu item, which may be set
+// concurrently.
+func (item *MenuItem) loadDescription() string {
+	item.mu.RLock()
+	defer item.mu.RUnlock()
+	return item.description
+}
+
+func (item *MenuItem) isRemoved() bool {
+	return atomic.LoadInt32(&item.removed) == 1
+}
+
+// Parent returns the menu item whose sub menu contains the menu item, or nil
+// for the menu items of the main menu and removed menu items.
+func (item *MenuItem) Parent() *MenuItem {
+	// parent is never changed once the menu item is created, so that it can
+	// be read without locking
+	if item.isRemoved() {
+		return nil
+	}
+	return item.parent
+}
+
+// Children returns the menu items of the sub menu of the menu item, in
+// creation order, excluding their own sub menu items.
+func (item *MenuItem) Children() []*MenuItem {
+	return sortedMenuItems(func(child *MenuItem) bool {
+		return child.parent == item
+	})
+}
+
+// IsCheckable reports whether the menu item is checkable, see WithCheckable.
+func (item *MenuItem) IsCheckable() bool {
+	return atomic.LoadInt32(&item.isCheckable) == 1
+}
+
+// SetCheckable makes the menu item checkable or not after its creation, see
+// WithCheckable. It returns ErrCheckableUnchangeable on Linux, where GTK
+// menu items can't be made checkable once created.
+func (item *MenuItem) SetCheckable(checkable bool) error {
+	if item.isRemoved() {
+		return ErrMenuItemRemoved
+	}
+	var want int32
+	if checkable {
+		want = 1
+	}
+	if atomic.LoadInt32(&item.isCheckable) == want {
+		return nil
+	}
+	if !canChangeCheckable() {
+		return ErrCheckableUnchangeable
+	}
+	atomic.StoreInt32(&item.isCheckable, want)
+	item.update()
+	return nil
+}
+
 // IsChecked returns if the menu item has a check mark
-func (item *menuItem) IsChecked() bool {
-	return item.checked
+func (item *MenuItem) IsChecked() bool {
+	return atomic.LoadInt32(&item.checked) == 1
 }
 
 // Check a menu item regardless if it's previously checked or not
-func (item *menuItem) Check() {
-	item.checked = true
+func (item *MenuItem) Check() {
+	atomic.StoreInt32(&item.checked, 1)
 	item.update()
 }
 
 // Uncheck a menu item regardless if it's previously unchecked or not
-func (item *menuItem) Uncheck() {
-	item.checked = false
+func (item *MenuItem) Uncheck() {
+	atomic.StoreInt32(&item.checked, 0)
 	item.update()
 }
 
-// update propagates changes on a menu item to systray
-func (item *menuItem) update() {
+// SetChecked checks the menu item if checked is true, and unchecks it
+// otherwise.
+func (item *MenuItem) SetChecked(checked bool) {
+	if checked {
+		item.Check()
+	} else {
+		item.Uncheck()
+	}
+}
+
+// Toggle checks the menu item if it's unchecked and unchecks it otherwise,
+// returning whether it's now checked. Concurrent toggles never cancel each
+// other out, unlike a sequence of IsChecked and Check or Uncheck.
+func (item *MenuItem) Toggle() bool {
+	for {
+		old := atomic.LoadInt32(&item.checked)
+		if atomic.CompareAndSwapInt32(&item.checked, old, 1-old) {
+			item.update()
+			return old == 0
+		}
+	}
+}
+
+// update propagates changes on a menu item to systray, unless it was removed,
+// so that setters called after Remove don't make it reappear.
+func (item *MenuItem) update() {
+	if item.isRemoved() || item.isSeparator {
+		return
+	}
 	menuItems.LoadOrStore(item.id, item)
-	addOrUpdateMenuItem(item)
+	if queueUpdate(item) {
+		// the hooks are notified once the batch propagates the update
+		return
+	}
+	item.throttledAddOrUpdate()
+	if item.isRemoved() {
+		// Remove ran meanwhile, possibly before the menu item was stored
+		// and propagated above, which would make it reappear
+		item.forget()
+		return
+	}
+	notifyItemAdded(item)
+}
+
+// forget drops the menu item from menuItems and the native menu again, once
+// removed.
+func (item *MenuItem) forget() {
+	if other, ok := menuItems.Load(item.id); ok && other == item {
+		menuItems.Delete(item.id)
+	}
+	removeMenuItem(item)
+}
+
+// addOrUpdate propagates the menu item to the native menu right away,
+// recording the error if any, see LastError.
+func (item *MenuItem) addOrUpdate() {
+	logOp("addOrUpdateMenuItem", item)
+	err := addOrUpdateMenuItem(item)
+	item.lastErr.Store(lastError{err})
+	if err != nil {
+		logError("addOrUpdateMenuItem", item, err)
+		handleError(err)
+	}
+}
+
+// LastError returns the error of the latest update of the menu item in the
+// native menu, e.g. by SetTitle, or nil if it succeeded. Updates held back by
+// BatchUpdate only count once propagated. Only Windows reports errors so far,
+// updates being asynchronous on other platforms.
+func (item *MenuItem) LastError() error {
+	last, _ := item.lastErr.Load().(lastError)
+	return last.err
 }
 
 func systrayMenuItemSelected(id uint32) {
-	if v, ok := menuItems.Load(id); ok {
-		if item, ok := v.(*menuItem); ok {
-			if item.onClicked != nil {
-				item.onClicked()
-			}
+	endAttentionMode()
+	if item, ok := GetMenuItemByID(id); ok && !item.isHeader {
+		logOp("systrayMenuItemSelected", item)
+		dispatchClick(func() {
+			handleClick(item)
+		})
+	}
+}
+
+// clicked invokes the callbacks set on the menu item for clicks, unless
+// debounced or throttled.
+func (item *MenuItem) clicked() {
+	switch {
+	case item.debounce > 0:
+		item.limiter.debounce(item.debounce, item.invokeClickCallbacks)
+	case item.throttle > 0:
+		if item.limiter.allow(item.throttle) {
+			item.invokeClickCallbacks()
+		}
+	default:
+		item.invokeClickCallbacks()
+	}
+}
+
+func (item *MenuItem) invokeClickCallbacks() {
+	item.mu.RLock()
+	onClicked := item.onClicked
+	item.mu.RUnlock()
+	if onClicked != nil {
+		onClicked()
+	}
+	if item.clickCh != nil {
+		select {
+		case item.clickCh <- item:
+		default:
+		}
+	}
+}
+
+// systrayMenuOpened is called with id 0 for the main menu.
+func systrayMenuOpened(id uint32) {
+	endAttentionMode()
+	if id == 0 {
+		events.publish(MenuOpenedEvent)
+		return
+	}
+	if item, ok := GetMenuItemByID(id); ok {
+		item.mu.RLock()
+		onOpen := item.onOpen
+		item.mu.RUnlock()
+		if onOpen != nil {
+			onOpen()
+		}
+	}
+}
+
+// systrayMenuClosed is called with id 0 for the main menu.
+func systrayMenuClosed(id uint32) {
+	if id == 0 {
+		events.publish(MenuClosedEvent)
+		return
+	}
+	if item, ok := GetMenuItemByID(id); ok {
+		item.mu.RLock()
+		onClose := item.onClose
+		item.mu.RUnlock()
+		if onClose != nil {
+			onClose()
+		}
+	}
+}
+
+func systrayMenuItemHovered(id uint32) {
+	if item, ok := GetMenuItemByID(id); ok {
+		item.mu.RLock()
+		onHover := item.onHover
+		item.mu.RUnlock()
+		if onHover != nil {
+			onHover()
 		}
 	}
 }
 
-// NewSeparator adds a separator bar to the menu
-func NewSeparator() {
-	addSeparator(atomic.AddUint32(&currentID, 1))
+// ResetMenu removes all the menu items and separators from the menu, as if
+// Remove was called on each of them, so that the menu can be built again
+// from scratch, e.g. on configuration change. Unlike everything else, menu
+// item IDs don't start over: they keep increasing for the lifetime of the
+// process, across ResetMenu and runs of the systray, so that a click on a
+// removed menu item, still in flight in the native menu, can't reach the menu
+// item added under its ID. Use WithID for IDs stable across rebuilds. It can
+// be safely invoked while the systray is running, but not concurrently with
+// calls adding menu items.
+func ResetMenu() {
+	for _, item := range sortedMenuItems(func(item *MenuItem) bool { return item.parent == nil }) {
+		item.Remove()
+	}
+	resetMenuOrder()
+}
+
+// NewSeparator adds a separator bar to the menu. The returned menu item can
+// be hidden, shown and removed like other menu items, while other changes
+// have no effect on it.
+func NewSeparator() *MenuItem {
+	return newSeparator(nil)
+}
+
+// newSeparator adds a separator bar to the sub menu of parent, or to the main
+// menu if parent is nil.
+func newSeparator(parent *MenuItem) *MenuItem {
+	item := &MenuItem{
+		id:          atomic.AddUint32(&currentID, 1),
+		isSeparator: true,
+		parent:      parent,
+	}
+	addSeparatorToMenuOrder(item.parentId(), item.id)
+	menuItems.Store(item.id, item)
+	logOp("addSeparator", item)
+	addSeparator(item.id, item.parentId())
+	notifyItemAdded(item)
+	return item
+}
+
+// NewLabeledSeparator adds a separator bar with a label to the menu, made of
+// a plain separator followed by a section header, see NewMenuHeader, which
+// looks like the native titled separators on macOS. The returned menu item is
+// the label: hiding, showing, moving or removing it does the same to the
+// separator, and SetTitle changes the label.
+func NewLabeledSeparator(title string) *MenuItem {
+	separator := NewSeparator()
+	item := newMenuItem(title, []MenuItemOption{WithDisabled(), withHeader()}, separator, true)
+	item.separator = separator
+	return item
+}
+
+// IsSeparator tells if the menu item is a separator, see NewSeparator and
+// NewLabeledSeparator.
+func (item *MenuItem) IsSeparator() bool {
+	return item.isSeparator || item.separator != nil
 }
@@ -3,18 +3,57 @@
 extern void systray_ready();
 extern void systray_on_exit();
 extern void systray_menu_item_selected(int menu_id);
-void registerSystray(void);
+extern void systray_hotkey_pressed(int hotkey_id);
+extern void systray_menu_opened(int menu_id);
+extern void systray_menu_closed(int menu_id);
+extern void systray_menu_item_hovered(int menu_id);
+extern int systray_validate_menu_item(int menu_id);
+extern void systray_init_failed(char *op);
+extern void systray_notification_clicked();
+extern void systray_theme_changed(int is_dark);
+// returns NULL, or the step which failed
+const char *registerSystray(void);
 int nativeLoop(void);
 
-void setIcon(const char *iconBytes, int length, bool template);
+bool setIcon(const char *iconBytes, int length, bool template, int width,
+             int height);
 void setMenuItemIcon(const char *iconBytes, int length, int menuId,
-                     bool template);
-void setTitle(char *title);
+                     bool template, int width, int height);
+bool set_icon_highlighted(const char *iconBytes, int length, int width,
+                          int height);
+bool set_icon_rgba(const unsigned char *pixels, int pixelsWide, int pixelsHigh,
+                   int width, int height);
+void setIconBadge(char *text);
+void setTitle(char *title); // macOS
 void setTooltip(char *tooltip);
-void add_or_update_menu_item(int menuId, int parentMenuId, char *title,
-                             char *tooltip, short disabled, short checked,
-                             short isCheckable);
-void add_separator(int menuId);
+void add_or_update_menu_item(int menuId, int parentMenuId, int position,
+                             char *title, char *tooltip, char *description,
+                             char *accelerator, short disabled, short checked,
+                             short isCheckable, short isRadio, short isHeader,
+                             short hidden);
+void add_separator(int menuId, int parentMenuId);
+void reorder_menu_items(int parentMenuId, int *menuIds, int count);
 void hide_menu_item(int menuId);
 void show_menu_item(int menuId);
+void remove_menu_item(int menuId);
+void showNotification(char *title, char *body, const char *iconBytes,
+                      int iconLength, int iconType, int timeout);
+void watch_theme();
+void set_tooltip_delay(int ms); // macOS
+void set_menu_batching(bool batching); // macOS
+bool set_clipboard_text(char *text);
+void *native_handle(void);
+void set_menu_item_progress(int menuId, char *title, double progress);
+void set_status_item_priority(int priority);
+void set_icon_dimmed(bool dimmed);
+bool tray_icon_bounds(int *x, int *y, int *width, int *height);
+void request_user_attention(bool enabled);
+bool register_hotkey(int hotkeyId, unsigned int modifiers, unsigned int key);
+void unregister_hotkey(int hotkeyId);
+#ifdef SYSTRAY_A11Y
+// returns a line per accessible child of the main menu, with its index in its
+// accessible parent, -1 if that's not the menu, a tab and its name (Linux,
+// for the tests built with the systray_a11y tag)
+char *accessible_menu_children(void);
+#endif
 void quit();
@@ -1,14 +1,17 @@
+//go:build !systray_fake
+
 package systray
 
 /*
 #cgo darwin CFLAGS: -DDARWIN -x objective-c -fobjc-arc
-#cgo darwin LDFLAGS: -framework Cocoa -framework WebKit
+#cgo darwin LDFLAGS: -framework Cocoa -framework WebKit -framework Carbon
 
 #include "systray.h"
 */
 import "C"
 
 import (
+	"os/exec"
 	"unsafe"
 )
 
@@ -17,22 +20,121 @@ import (
 // templateIconBytes and regularIconBytes should be the content of .ico for windows and
 // .ico/.jpg/.png for other platforms.
 func SetTemplateIcon(templateIconBytes []byte, regularIconBytes []byte) {
-	cstr := (*C.char)(unsafe.Pointer(&templateIconBytes[0]))
-	C.setIcon(cstr, (C.int)(len(templateIconBytes)), true)
+	if err := SetIconTemplate(templateIconBytes); err != nil {
+		if l := currentLogger(); l != nil {
+			l.Errorf("SetTemplateIcon: %v", err)
+		}
+	}
 }
 
-// SetIcon sets the icon of a menu item. Only works on macOS and Windows.
-// iconBytes should be the content of .ico/.jpg/.png
-func (item *menuItem) SetIcon(iconBytes []byte) {
+// systray_init_failed is called when the initialization fails in the event
+// loop, with the step which failed, see RegisterE.
+//
+//export systray_init_failed
+func systray_init_failed(op *C.char) {
+	initFailed(&InitError{Op: C.GoString(op)})
+}
+
+// systray_validate_menu_item returns 1 if the menu item is enabled, 0 if it's
+// disabled, and -1 if it's left alone, see SetMenuValidationFunc.
+//
+//export systray_validate_menu_item
+func systray_validate_menu_item(cID C.int) C.int {
+	enabled, ok := validateMenuItem(uint32(cID))
+	switch {
+	case !ok:
+		return -1
+	case enabled:
+		return 1
+	}
+	return 0
+}
+
+// nativeIconBytes returns iconBytes as is, as NSImage loads all the
+// resolutions of .icns and .ico data, picking the best one for the display.
+func nativeIconBytes(iconBytes []byte) ([]byte, error) {
+	return iconBytes, nil
+}
+
+func setMenuItemIcon(item *MenuItem, iconBytes []byte) {
 	cstr := (*C.char)(unsafe.Pointer(&iconBytes[0]))
-	C.setMenuItemIcon(cstr, (C.int)(len(iconBytes)), C.int(item.id), false)
+	C.setMenuItemIcon(cstr, (C.int)(len(iconBytes)), C.int(item.id), false, C.int(item.iconWidth), C.int(item.iconHeight))
 }
 
-// SetTemplateIcon sets the icon of a menu item as a template icon (on macOS). On Windows, it
-// falls back to the regular icon bytes and on Linux it does nothing.
+// SetTemplateIcon sets the icon of a menu item as a template icon (on macOS). On Windows and
+// Linux, it falls back to the regular icon bytes.
 // templateIconBytes and regularIconBytes should be the content of .ico for windows and
 // .ico/.jpg/.png for other platforms.
-func (item *menuItem) SetTemplateIcon(templateIconBytes []byte, regularIconBytes []byte) {
+func (item *MenuItem) SetTemplateIcon(templateIconBytes []byte, regularIconBytes []byte) {
+	if item.isRemoved() || validateIcon(templateIconBytes) != nil {
+		return
+	}
 	cstr := (*C.char)(unsafe.Pointer(&templateIconBytes[0]))
-	C.setMenuItemIcon(cstr, (C.int)(len(templateIconBytes)), C.int(item.id), true)
+	C.setMenuItemIcon(cstr, (C.int)(len(templateIconBytes)), C.int(item.id), true, C.int(item.iconWidth), C.int(item.iconHeight))
+}
+
+// canChangeCheckable is true as all menu items are checkable on macOS.
+func canChangeCheckable() bool {
+	return true
+}
+
+// recommendedIconSize is twice the size of icons in points when none is
+// declared, for them to be crisp on Retina displays.
+func recommendedIconSize() (width, height int) {
+	return 32, 32
+}
+
+func trayIconBounds() (x, y, width, height int, err error) {
+	var cx, cy, cw, ch C.int
+	if !C.tray_icon_bounds(&cx, &cy, &cw, &ch) {
+		return 0, 0, 0, 0, ErrBoundsUnavailable
+	}
+	return int(cx), int(cy), int(cw), int(ch), nil
+}
+
+func openURL(url string) error {
+	return startCommand(exec.Command("open", url))
+}
+
+func setMenuItemProgress(item *MenuItem, title string, progress float64) bool {
+	C.set_menu_item_progress(C.int(item.id), C.CString(title), C.double(progress))
+	return true
+}
+
+func setStatusItemPriority(priority int) {
+	C.set_status_item_priority(C.int(priority))
+}
+
+func setIconDimmed(dimmed bool) {
+	C.set_icon_dimmed(C.bool(dimmed))
+}
+
+func requestUserAttention(enabled bool) {
+	C.request_user_attention(C.bool(enabled))
+}
+
+// SetTitle sets the text shown next to the tray icon, e.g. to display live
+// metrics such as "CPU 42%" in the menu bar on macOS. It does nothing on
+// Windows, whose notification area has no room for text, nor on Linux, where
+// few indicator hosts show a label.
+func SetTitle(title string) {
+	C.setTitle(C.CString(title))
+}
+
+func setTooltipDelay(item *MenuItem) {
+	C.set_tooltip_delay(C.int(item.loadTooltipDelay()))
+}
+
+func beginBatchUpdate() {
+	C.set_menu_batching(true)
+}
+
+func endBatchUpdate() {
+	C.set_menu_batching(false)
+}
+
+// nativeTitle returns the title of item. The accelerator is set as the key
+// equivalent of the menu item instead.
+func nativeTitle(item *MenuItem) string {
+	return item.loadTitle()
 }
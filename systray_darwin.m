@@ -1,4 +1,8 @@
+//go:build !systray_fake
+
 #import <Cocoa/Cocoa.h>
+#import <Carbon/Carbon.h>
+#import <objc/message.h>
 #include "systray.h"
 
 #if __MAC_OS_X_VERSION_MIN_REQUIRED < 101400
@@ -18,10 +22,14 @@
   @public
     NSNumber* menuId;
     NSNumber* parentMenuId;
+    NSInteger position;
     NSString* title;
     NSString* tooltip;
+    NSString* description;
+    NSString* accelerator;
     short disabled;
     short checked;
+    short header;
 }
 -(id) initWithId: (int)theMenuId
 withParentMenuId: (int)theParentMenuId
@@ -50,9 +58,47 @@ withParentMenuId: (int)theParentMenuId
 }
 @end
 
-@interface AppDelegate: NSObject <NSApplicationDelegate>
+// ProgressView is the view of the menu items showing a progress bar, see
+// set_menu_item_progress. AppKit neither highlights menu items with a view
+// nor sends their action when clicked, so it does both.
+@interface ProgressView : NSView
+@end
+
+@implementation ProgressView
+- (void)drawRect:(NSRect)dirtyRect {
+  NSMenuItem* menuItem = [self enclosingMenuItem];
+  BOOL highlighted = menuItem.highlighted && menuItem.enabled;
+  if (highlighted) {
+    if (@available(macOS 10.14, *)) {
+      [[NSColor selectedContentBackgroundColor] setFill];
+    } else {
+      [[NSColor selectedMenuItemColor] setFill];
+    }
+    NSRectFill(dirtyRect);
+  }
+  NSColor* textColor = highlighted ? [NSColor selectedMenuItemTextColor] : [NSColor labelColor];
+  for (NSView* subview in self.subviews) {
+    if ([subview isKindOfClass:[NSTextField class]]) {
+      ((NSTextField*)subview).textColor = textColor;
+    }
+  }
+  [super drawRect:dirtyRect];
+}
+
+- (void)mouseUp:(NSEvent*)event {
+  NSMenuItem* menuItem = [self enclosingMenuItem];
+  if (!menuItem.enabled) {
+    return;
+  }
+  [[menuItem menu] cancelTracking];
+  [NSApp sendAction:menuItem.action to:menuItem.target from:menuItem];
+}
+@end
+
+@interface AppDelegate: NSObject <NSApplicationDelegate, NSMenuDelegate, NSUserNotificationCenterDelegate>
   - (void) add_or_update_menu_item:(MenuItem*) item;
   - (IBAction)menuHandler:(id)sender;
+  - (NSStatusItem*) statusItem;
   @property (assign) IBOutlet NSWindow *window;
   @end
 
@@ -60,17 +106,51 @@ withParentMenuId: (int)theParentMenuId
 {
   NSStatusItem *statusItem;
   NSMenu *menu;
+  // the icon set by setIcon, shown with the badge if badgeText is not empty
+  NSImage *baseImage;
+  NSString *badgeText;
   NSCondition* cond;
 }
 
 @synthesize window = _window;
 
+// the priority of the status item set by set_status_item_priority, if any
+static bool hasStatusItemPriority = false;
+static NSInteger statusItemPriority = 0;
+
 - (void)applicationDidFinishLaunching:(NSNotification *)aNotification
 {
-  self->statusItem = [[NSStatusBar systemStatusBar] statusItemWithLength:NSVariableStatusItemLength];
+  NSStatusBar *bar = [NSStatusBar systemStatusBar];
+  // NSStatusBar only exposes priorities privately, so check it's still there
+  SEL withPriority = NSSelectorFromString(@"_statusItemWithLength:withPriority:");
+  if (hasStatusItemPriority && [bar respondsToSelector:withPriority]) {
+    self->statusItem = ((NSStatusItem* (*)(id, SEL, CGFloat, NSInteger))objc_msgSend)(
+        bar, withPriority, NSVariableStatusItemLength, statusItemPriority);
+  } else {
+    self->statusItem = [bar statusItemWithLength:NSVariableStatusItemLength];
+  }
+  if (self->statusItem == nil) {
+    // e.g. denied by the sandbox, stops the event loop for RunE to return
+    systray_init_failed((char *)"create the status item");
+    [NSApp stop:nil];
+    // stop only takes effect once an event is processed
+    [NSApp postEvent:[NSEvent otherEventWithType:NSEventTypeApplicationDefined
+                                        location:NSZeroPoint
+                                   modifierFlags:0
+                                       timestamp:0
+                                    windowNumber:0
+                                         context:nil
+                                         subtype:0
+                                           data1:0
+                                           data2:0]
+             atStart:YES];
+    return;
+  }
   self->menu = [[NSMenu alloc] init];
   [self->menu setAutoenablesItems: FALSE];
+  [self->menu setDelegate:self];
   [self->statusItem setMenu:self->menu];
+  [[NSUserNotificationCenter defaultUserNotificationCenter] setDelegate:self];
   systray_ready();
 }
 
@@ -80,10 +160,54 @@ withParentMenuId: (int)theParentMenuId
 }
 
 - (void)setIcon:(NSImage *)image {
+  baseImage = image;
+  [self updateIcon];
+}
+
+- (void)set_icon_highlighted:(NSImage *)image {
+  statusItem.button.alternateImage = image;
+}
+
+- (void)setIconBadge:(NSString *)text {
+  badgeText = text;
+  [self updateIcon];
+}
+
+- (void)set_icon_dimmed:(NSNumber *)dimmed {
+  statusItem.button.alphaValue = [dimmed boolValue] ? 0.25 : 1.0;
+}
+
+- (void)updateIcon {
+  NSImage *image = baseImage;
+  if (image != nil && [badgeText length] > 0) {
+    image = draw_badge(baseImage, badgeText);
+  }
   statusItem.button.image = image;
   [self updateTitleButtonStyle];
 }
 
+// draws text in a red circle over the top right corner of image. The result
+// can't be a template image, as the badge wouldn't be red anymore.
+NSImage *draw_badge(NSImage *image, NSString *text) {
+  NSSize size = image.size;
+  return [NSImage imageWithSize:size flipped:NO drawingHandler:^BOOL(NSRect rect) {
+    [image drawInRect:rect];
+    CGFloat diameter = size.height * 0.6;
+    NSRect badgeRect = NSMakeRect(size.width - diameter, size.height - diameter, diameter, diameter);
+    [[NSColor systemRedColor] setFill];
+    [[NSBezierPath bezierPathWithOvalInRect:badgeRect] fill];
+    NSDictionary *attributes = @{
+      NSFontAttributeName: [NSFont boldSystemFontOfSize:diameter * ([text length] > 1 ? 0.55 : 0.75)],
+      NSForegroundColorAttributeName: [NSColor whiteColor]
+    };
+    NSSize textSize = [text sizeWithAttributes:attributes];
+    [text drawAtPoint:NSMakePoint(NSMidX(badgeRect) - textSize.width / 2,
+                                  NSMidY(badgeRect) - textSize.height / 2)
+       withAttributes:attributes];
+    return YES;
+  }];
+}
+
 - (void)setTitle:(NSString *)title {
   statusItem.button.title = title;
   [self updateTitleButtonStyle];
@@ -112,32 +236,142 @@ withParentMenuId: (int)theParentMenuId
   systray_menu_item_selected(menuId.intValue);
 }
 
-- (void)add_or_update_menu_item:(MenuItem *)item {
-  NSMenu *theMenu = self->menu;
-  NSMenuItem *parentItem;
-  if ([item->parentMenuId integerValue] > 0) {
-    parentItem = find_menu_item(menu, item->parentMenuId);
-    if (parentItem.hasSubmenu) {
-      theMenu = parentItem.submenu;
-    } else {
-      theMenu = [[NSMenu alloc] init];
-      [theMenu setAutoenablesItems:NO];
-      [parentItem setSubmenu:theMenu];
+NSMenuItem *find_parent_item(NSMenu *subMenu) {
+  NSMenu *superMenu = [subMenu supermenu];
+  if (superMenu == nil) {
+    return nil;
+  }
+  NSInteger index = [superMenu indexOfItemWithSubmenu:subMenu];
+  if (index < 0) {
+    return nil;
+  }
+  return [superMenu itemAtIndex:index];
+}
+
+- (void)watch_theme:(id)unused {
+  [NSApp addObserver:self
+          forKeyPath:@"effectiveAppearance"
+             options:NSKeyValueObservingOptionInitial | NSKeyValueObservingOptionNew
+             context:nil];
+}
+
+- (void)observeValueForKeyPath:(NSString *)keyPath
+                      ofObject:(id)object
+                        change:(NSDictionary *)change
+                       context:(void *)context {
+  if (![keyPath isEqualToString:@"effectiveAppearance"]) {
+    [super observeValueForKeyPath:keyPath ofObject:object change:change context:context];
+    return;
+  }
+  int dark = 0;
+  if (@available(macOS 10.14, *)) {
+    NSAppearanceName name = [[NSApp effectiveAppearance]
+        bestMatchFromAppearancesWithNames:@[NSAppearanceNameAqua, NSAppearanceNameDarkAqua]];
+    dark = [name isEqualToString:NSAppearanceNameDarkAqua];
+  }
+  systray_theme_changed(dark);
+}
+
+// the main menu is reported as menu 0
+- (void)menuWillOpen:(NSMenu *)theMenu {
+  NSMenuItem *parentItem = find_parent_item(theMenu);
+  if (parentItem != nil) {
+    systray_menu_opened([parentItem tag]);
+  } else if (theMenu == self->menu) {
+    systray_menu_opened(0);
+  }
+  // menus have autoenablesItems off, so items are validated by hand
+  for (NSMenuItem *item in theMenu.itemArray) {
+    if (item.isSeparatorItem) {
+      continue;
+    }
+    int enabled = systray_validate_menu_item([item tag]);
+    if (enabled >= 0) {
+      item.enabled = enabled == 1;
     }
   }
+}
+
+- (void)menuDidClose:(NSMenu *)theMenu {
+  NSMenuItem *parentItem = find_parent_item(theMenu);
+  if (parentItem != nil) {
+    systray_menu_closed([parentItem tag]);
+  } else if (theMenu == self->menu) {
+    systray_menu_closed(0);
+  }
+}
+
+- (void)menu:(NSMenu *)theMenu willHighlightItem:(NSMenuItem *)item {
+  // item is nil when the cursor leaves the menu items
+  if (item != nil && !item.isSeparatorItem) {
+    systray_menu_item_hovered([item tag]);
+  }
+}
+
+// returns the menu with the given parent, the main menu if parentMenuId is 0,
+// creating the sub menu of the parent if it doesn't have one yet
+- (NSMenu *)menu_of:(NSNumber *)parentMenuId {
+  if ([parentMenuId integerValue] == 0) {
+    return self->menu;
+  }
+  NSMenuItem *parentItem = find_menu_item(menu, parentMenuId);
+  if (parentItem.hasSubmenu) {
+    return parentItem.submenu;
+  }
+  NSMenu *theMenu = [[NSMenu alloc] init];
+  [theMenu setAutoenablesItems:NO];
+  [theMenu setDelegate:self];
+  [parentItem setSubmenu:theMenu];
+  return theMenu;
+}
+
+- (void)add_or_update_menu_item:(MenuItem *)item {
+  NSMenu *theMenu = [self menu_of:item->parentMenuId];
 
   NSMenuItem *menuItem;
   menuItem = find_menu_item(theMenu, item->menuId);
   if (menuItem == NULL) {
-    menuItem = [theMenu addItemWithTitle:item->title
-                               action:@selector(menuHandler:)
-                        keyEquivalent:@""];
+    NSInteger position = item->position;
+    if (position < 0 || position > [theMenu numberOfItems]) {
+      position = [theMenu numberOfItems];
+    }
+    menuItem = [theMenu insertItemWithTitle:item->title
+                                     action:@selector(menuHandler:)
+                              keyEquivalent:@""
+                                    atIndex:position];
     [menuItem setRepresentedObject:item->menuId];
   }
   [menuItem setTitle:item->title];
+  if (item->header == 1) {
+    // looks like the section headers of macOS 14, which can't be created
+    // from an existing menu item
+    menuItem.attributedTitle = [[NSAttributedString alloc]
+        initWithString:item->title
+            attributes:@{
+              NSFontAttributeName: [NSFont boldSystemFontOfSize:[NSFont smallSystemFontSize]],
+              NSForegroundColorAttributeName: [NSColor secondaryLabelColor]
+            }];
+  }
   [menuItem setTag:[item->menuId integerValue]];
   [menuItem setTarget:self];
   [menuItem setToolTip:item->tooltip];
+  // announced by VoiceOver after the title
+  if (@available(macOS 10.10, *)) {
+    [menuItem setAccessibilityHelp:item->description];
+  }
+  // the default modifier mask of key equivalents is the Command key
+  [menuItem setKeyEquivalent:[item->accelerator lowercaseString]];
+  if (item->disabled == 2) {
+    // soft disabled, looks disabled but still clickable
+    menuItem.attributedTitle = [[NSAttributedString alloc]
+        initWithString:item->title
+            attributes:@{
+              NSForegroundColorAttributeName: [NSColor disabledControlTextColor]
+            }];
+  } else if (item->header != 1) {
+    // back to the plain title once enabled again
+    menuItem.attributedTitle = nil;
+  }
   if (item->disabled == 1) {
     menuItem.enabled = FALSE;
   } else {
@@ -170,9 +404,36 @@ NSMenuItem *find_menu_item(NSMenu *ourMenu, NSNumber *menuId) {
   return NULL;
 };
 
-- (void) add_separator:(NSNumber*) menuId
+- (void) add_separator:(NSArray*)menuIdAndParentMenuId
+{
+  NSNumber* menuId = [menuIdAndParentMenuId objectAtIndex:0];
+  NSNumber* parentMenuId = [menuIdAndParentMenuId objectAtIndex:1];
+  NSMenuItem *separator = [NSMenuItem separatorItem];
+  // tagged like menu items, to be able to move it
+  [separator setTag:[menuId integerValue]];
+  [[self menu_of:parentMenuId] addItem:separator];
+}
+
+- (void) reorder_menu_items:(NSArray*)parentMenuIdAndMenuIds
 {
-  [menu addItem: [NSMenuItem separatorItem]];
+  NSNumber* parentMenuId = [parentMenuIdAndMenuIds objectAtIndex:0];
+  NSArray* menuIds = [parentMenuIdAndMenuIds objectAtIndex:1];
+  NSMenu *theMenu = self->menu;
+  if ([parentMenuId integerValue] > 0) {
+    NSMenuItem *parentItem = find_menu_item(menu, parentMenuId);
+    if (parentItem == NULL || !parentItem.hasSubmenu) {
+      return;
+    }
+    theMenu = parentItem.submenu;
+  }
+  NSInteger i;
+  for (i = 0; i < [menuIds count]; i++) {
+    NSMenuItem *menuItem = [theMenu itemWithTag:[[menuIds objectAtIndex:i] integerValue]];
+    if (menuItem != NULL) {
+      [theMenu removeItem:menuItem];
+      [theMenu insertItem:menuItem atIndex:MIN(i, [theMenu numberOfItems])];
+    }
+  }
 }
 
 - (void) hide_menu_item:(NSNumber*) menuId
@@ -195,6 +456,40 @@ NSMenuItem *find_menu_item(NSMenu *ourMenu, NSNumber *menuId) {
   menuItem.image = image;
 }
 
+// shows the title above a progress bar, in a view replacing the standard
+// rendering of the menu item
+- (void) set_menu_item_progress:(NSArray*)menuIdTitleAndProgress
+{
+  NSNumber* menuId = [menuIdTitleAndProgress objectAtIndex:0];
+  NSString* title = [menuIdTitleAndProgress objectAtIndex:1];
+  NSNumber* progress = [menuIdTitleAndProgress objectAtIndex:2];
+  NSMenuItem* menuItem = find_menu_item(menu, menuId);
+  if (menuItem == NULL) {
+    return;
+  }
+  if (menuItem.view == nil) {
+    NSView* view = [[ProgressView alloc] initWithFrame:NSMakeRect(0, 0, 220, 40)];
+    NSTextField* label = [NSTextField labelWithString:title];
+    label.frame = NSMakeRect(20, 20, 190, 17);
+    [view addSubview:label];
+    NSProgressIndicator* bar = [[NSProgressIndicator alloc]
+        initWithFrame:NSMakeRect(20, 6, 180, 12)];
+    bar.style = NSProgressIndicatorStyleBar;
+    bar.indeterminate = NO;
+    bar.minValue = 0;
+    bar.maxValue = 1;
+    [view addSubview:bar];
+    menuItem.view = view;
+  }
+  for (NSView* subview in menuItem.view.subviews) {
+    if ([subview isKindOfClass:[NSTextField class]]) {
+      ((NSTextField*)subview).stringValue = title;
+    } else if ([subview isKindOfClass:[NSProgressIndicator class]]) {
+      ((NSProgressIndicator*)subview).doubleValue = [progress doubleValue];
+    }
+  }
+}
+
 - (void) show_menu_item:(NSNumber*) menuId
 {
   NSMenuItem* menuItem = find_menu_item(menu, menuId);
@@ -203,6 +498,53 @@ NSMenuItem *find_menu_item(NSMenu *ourMenu, NSNumber *menuId) {
   }
 }
 
+- (void) remove_menu_item:(NSNumber*) menuId
+{
+  NSMenuItem* menuItem = find_menu_item(menu, menuId);
+  if (menuItem != NULL) {
+    [[menuItem menu] removeItem:menuItem];
+  }
+}
+
+- (void) show_notification:(NSArray*) args
+{
+  NSUserNotification *notification = [[NSUserNotification alloc] init];
+  notification.title = [args objectAtIndex:0];
+  notification.informativeText = [args objectAtIndex:1];
+  id image = [args objectAtIndex:2];
+  if (image != [NSNull null]) {
+    notification.contentImage = image;
+  }
+  NSUserNotificationCenter *center = [NSUserNotificationCenter defaultUserNotificationCenter];
+  [center deliverNotification:notification];
+  NSNumber *timeout = [args objectAtIndex:3];
+  if ([timeout intValue] > 0) {
+    dispatch_after(dispatch_time(DISPATCH_TIME_NOW, (int64_t)[timeout intValue] * NSEC_PER_MSEC),
+                   dispatch_get_main_queue(), ^{
+      [center removeDeliveredNotification:notification];
+    });
+  }
+}
+
+// show notifications even if the application is frontmost, which is often
+// the case for a systray application
+- (BOOL)userNotificationCenter:(NSUserNotificationCenter *)center
+     shouldPresentNotification:(NSUserNotification *)notification
+{
+  return YES;
+}
+
+- (void)userNotificationCenter:(NSUserNotificationCenter *)center
+       didActivateNotification:(NSUserNotification *)notification
+{
+  systray_notification_clicked();
+}
+
+- (NSStatusItem*) statusItem
+{
+  return statusItem;
+}
+
 - (void) quit
 {
   [NSApp terminate:self];
@@ -210,7 +552,12 @@ NSMenuItem *find_menu_item(NSMenu *ourMenu, NSNumber *menuId) {
 
 @end
 
-void registerSystray(void) {
+void set_status_item_priority(int priority) {
+  hasStatusItemPriority = true;
+  statusItemPriority = priority;
+}
+
+const char *registerSystray(void) {
   AppDelegate *delegate = [[AppDelegate alloc] init];
   [[NSApplication sharedApplication] setDelegate:delegate];
   // A workaround to avoid crashing on macOS versions before Catalina. Somehow
@@ -219,6 +566,9 @@ void registerSystray(void) {
   if (floor(NSAppKitVersionNumber) <= /*NSAppKitVersionNumber10_14*/ 1671){
     [NSApp run];
   }
+  // the status item is created in applicationDidFinishLaunching, see
+  // systray_init_failed
+  return NULL;
 }
 
 int nativeLoop(void) {
@@ -228,6 +578,11 @@ int nativeLoop(void) {
   return EXIT_SUCCESS;
 }
 
+void* native_handle(void) {
+  AppDelegate* delegate = (AppDelegate*)[NSApp delegate];
+  return (__bridge void*)[delegate statusItem];
+}
+
 void runInMainThread(SEL method, id object) {
   [(AppDelegate*)[NSApp delegate]
     performSelectorOnMainThread:method
@@ -235,23 +590,175 @@ void runInMainThread(SEL method, id object) {
                   waitUntilDone: YES];
 }
 
-void setIcon(const char* iconBytes, int length, bool template) {
+void runBlockInMainThread(void (^block)(void)) {
+  if ([NSThread isMainThread]) {
+    block();
+  } else {
+    dispatch_sync(dispatch_get_main_queue(), block);
+  }
+}
+
+// postToMainThread is like runInMainThread, but returns without waiting for
+// the method to run, for callers which may block the main thread
+void postToMainThread(SEL method, id object) {
+  [(AppDelegate*)[NSApp delegate]
+    performSelectorOnMainThread:method
+                     withObject:object
+                  waitUntilDone: NO];
+}
+
+bool tray_icon_bounds(int *x, int *y, int *width, int *height) {
+  __block bool ok = false;
+  runBlockInMainThread(^{
+    NSStatusItem *statusItem = [(AppDelegate*)[NSApp delegate] statusItem];
+    NSWindow *window = statusItem.button.window;
+    NSScreen *primary = [[NSScreen screens] firstObject];
+    if (window == nil || primary == nil || !window.visible) {
+      return;
+    }
+    // AppKit coordinates start from the bottom left corner of the primary
+    // display, y growing upwards
+    NSRect frame = window.frame;
+    *x = (int)frame.origin.x;
+    *y = (int)(NSMaxY(primary.frame) - NSMaxY(frame));
+    *width = (int)frame.size.width;
+    *height = (int)frame.size.height;
+    ok = true;
+  });
+  return ok;
+}
+
+// hotkey IDs to the EventHotKeyRef of their hotkey, only accessed in main
+// thread
+static NSMutableDictionary* hotkeyRefs = nil;
+
+OSStatus hotkeyPressed(EventHandlerCallRef nextHandler, EventRef event, void *userData) {
+  EventHotKeyID hotkeyID;
+  GetEventParameter(event, kEventParamDirectObject, typeEventHotKeyID, NULL,
+                    sizeof(hotkeyID), NULL, &hotkeyID);
+  systray_hotkey_pressed(hotkeyID.id);
+  return noErr;
+}
+
+void unregisterHotkeyInMainThread(int hotkeyId) {
+  NSNumber *hId = [NSNumber numberWithInt:hotkeyId];
+  NSValue *ref = [hotkeyRefs objectForKey:hId];
+  if (ref != nil) {
+    UnregisterEventHotKey((EventHotKeyRef)[ref pointerValue]);
+    [hotkeyRefs removeObjectForKey:hId];
+  }
+}
+
+// returns the size in points to show icons with, 16x16 unless declared
+NSSize icon_size(int width, int height) {
+  if (width <= 0 || height <= 0) {
+    return NSMakeSize(16, 16);
+  }
+  return NSMakeSize(width, height);
+}
+
+bool setIcon(const char* iconBytes, int length, bool template, int width, int height) {
   NSData* buffer = [NSData dataWithBytes: iconBytes length:length];
   NSImage *image = [[NSImage alloc] initWithData:buffer];
-  [image setSize:NSMakeSize(16, 16)];
+  if (image == nil) {
+    return false;
+  }
+  [image setSize:icon_size(width, height)];
   image.template = template;
+  // not waited for, so that the icon animation never waits for the main
+  // thread, which may be waiting for the animation to stop
+  postToMainThread(@selector(setIcon:), (id)image);
+  return true;
+}
+
+// pixels are non-premultiplied RGBA, copied as the image may outlive them
+bool set_icon_rgba(const unsigned char* pixels, int pixelsWide, int pixelsHigh, int width, int height) {
+  NSBitmapImageRep *rep = [[NSBitmapImageRep alloc]
+      initWithBitmapDataPlanes:NULL
+                    pixelsWide:pixelsWide
+                    pixelsHigh:pixelsHigh
+                 bitsPerSample:8
+               samplesPerPixel:4
+                      hasAlpha:YES
+                      isPlanar:NO
+                colorSpaceName:NSDeviceRGBColorSpace
+                  bitmapFormat:NSBitmapFormatAlphaNonpremultiplied
+                   bytesPerRow:pixelsWide * 4
+                  bitsPerPixel:32];
+  if (rep == nil) {
+    return false;
+  }
+  memcpy([rep bitmapData], pixels, pixelsWide * pixelsHigh * 4);
+  NSImage *image = [[NSImage alloc] initWithSize:NSMakeSize(pixelsWide, pixelsHigh)];
+  [image addRepresentation:rep];
+  [image setSize:icon_size(width, height)];
   runInMainThread(@selector(setIcon:), (id)image);
+  return true;
 }
 
-void setMenuItemIcon(const char* iconBytes, int length, int menuId, bool template) {
+bool set_icon_highlighted(const char* iconBytes, int length, int width, int height) {
+  if (iconBytes == NULL) {
+    runInMainThread(@selector(set_icon_highlighted:), nil);
+    return true;
+  }
+  NSData* buffer = [NSData dataWithBytes: iconBytes length:length];
+  NSImage *image = [[NSImage alloc] initWithData:buffer];
+  if (image == nil) {
+    return false;
+  }
+  [image setSize:icon_size(width, height)];
+  runInMainThread(@selector(set_icon_highlighted:), (id)image);
+  return true;
+}
+
+void setMenuItemIcon(const char* iconBytes, int length, int menuId, bool template, int width, int height) {
   NSData* buffer = [NSData dataWithBytes: iconBytes length:length];
   NSImage *image = [[NSImage alloc] initWithData:buffer];
-  [image setSize:NSMakeSize(16, 16)];
+  if (image == nil) {
+    return;
+  }
+  [image setSize:icon_size(width, height)];
   image.template = template;
   NSNumber *mId = [NSNumber numberWithInt:menuId];
   runInMainThread(@selector(setMenuItemIcon:), @[image, (id)mId]);
 }
 
+void set_menu_item_progress(int menuId, char* ctitle, double progress) {
+  NSString* title = [[NSString alloc] initWithCString:ctitle
+                                             encoding:NSUTF8StringEncoding];
+  free(ctitle);
+  NSNumber *mId = [NSNumber numberWithInt:menuId];
+  runInMainThread(@selector(set_menu_item_progress:),
+                  @[mId, title, [NSNumber numberWithDouble:progress]]);
+}
+
+void set_icon_dimmed(bool dimmed) {
+  runInMainThread(@selector(set_icon_dimmed:), [NSNumber numberWithBool:dimmed]);
+}
+
+// the attention request bouncing the Dock icon, if any
+static NSInteger attentionRequest = 0;
+
+void request_user_attention(bool enabled) {
+  runBlockInMainThread(^{
+    if (attentionRequest != 0) {
+      [NSApp cancelUserAttentionRequest:attentionRequest];
+      attentionRequest = 0;
+    }
+    if (enabled) {
+      // returns 0 if the app is active, or has no Dock icon
+      attentionRequest = [NSApp requestUserAttention:NSCriticalRequest];
+    }
+  });
+}
+
+void setIconBadge(char* ctext) {
+  NSString* text = [[NSString alloc] initWithCString:ctext
+                                            encoding:NSUTF8StringEncoding];
+  free(ctext);
+  runInMainThread(@selector(setIconBadge:), (id)text);
+}
+
 void setTitle(char* ctitle) {
   NSString* title = [[NSString alloc] initWithCString:ctitle
                                              encoding:NSUTF8StringEncoding];
@@ -259,6 +766,19 @@ void setTitle(char* ctitle) {
   runInMainThread(@selector(setTitle:), (id)title);
 }
 
+bool set_clipboard_text(char* ctext) {
+  NSString* text = [[NSString alloc] initWithCString:ctext
+                                            encoding:NSUTF8StringEncoding];
+  free(ctext);
+  __block bool result = false;
+  runBlockInMainThread(^{
+    NSPasteboard* pasteboard = [NSPasteboard generalPasteboard];
+    [pasteboard clearContents];
+    result = [pasteboard setString:text forType:NSPasteboardTypeString];
+  });
+  return result;
+}
+
 void setTooltip(char* ctooltip) {
   NSString* tooltip = [[NSString alloc] initWithCString:ctooltip
                                                encoding:NSUTF8StringEncoding];
@@ -266,16 +786,37 @@ void setTooltip(char* ctooltip) {
   runInMainThread(@selector(setTooltip:), (id)tooltip);
 }
 
-void add_or_update_menu_item(int menuId, int parentMenuId, char* title, char* tooltip, short disabled, short checked, short isCheckable) {
+void add_or_update_menu_item(int menuId, int parentMenuId, int position, char* title, char* tooltip, char* description, char* accelerator, short disabled, short checked, short isCheckable, short isRadio, short isHeader, short hidden) {
+  // hidden is unused, as updating an NSMenuItem doesn't change whether it's
+  // hidden, see hide_menu_item
   MenuItem* item = [[MenuItem alloc] initWithId: menuId withParentMenuId: parentMenuId withTitle: title withTooltip: tooltip withDisabled: disabled withChecked: checked];
+  item->position = position;
+  item->header = isHeader;
+  item->description = [[NSString alloc] initWithCString:description
+                                               encoding:NSUTF8StringEncoding];
+  item->accelerator = [[NSString alloc] initWithCString:accelerator
+                                               encoding:NSUTF8StringEncoding];
   free(title);
   free(tooltip);
+  free(description);
+  free(accelerator);
   runInMainThread(@selector(add_or_update_menu_item:), (id)item);
 }
 
-void add_separator(int menuId) {
+void add_separator(int menuId, int parentMenuId) {
   NSNumber *mId = [NSNumber numberWithInt:menuId];
-  runInMainThread(@selector(add_separator:), (id)mId);
+  NSNumber *pId = [NSNumber numberWithInt:parentMenuId];
+  runInMainThread(@selector(add_separator:), @[mId, pId]);
+}
+
+void reorder_menu_items(int parentMenuId, int* menuIds, int count) {
+  NSMutableArray *ids = [NSMutableArray arrayWithCapacity:count];
+  int i;
+  for (i = 0; i < count; i++) {
+    [ids addObject:[NSNumber numberWithInt:menuIds[i]]];
+  }
+  NSNumber *pId = [NSNumber numberWithInt:parentMenuId];
+  runInMainThread(@selector(reorder_menu_items:), @[pId, ids]);
 }
 
 void hide_menu_item(int menuId) {
@@ -288,6 +829,89 @@ void show_menu_item(int menuId) {
   runInMainThread(@selector(show_menu_item:), (id)mId);
 }
 
+void remove_menu_item(int menuId) {
+  NSNumber *mId = [NSNumber numberWithInt:menuId];
+  runInMainThread(@selector(remove_menu_item:), (id)mId);
+}
+
+void showNotification(char* ctitle, char* cbody, const char* iconBytes, int iconLength, int iconType, int timeout) {
+  NSString* title = [[NSString alloc] initWithCString:ctitle
+                                             encoding:NSUTF8StringEncoding];
+  NSString* body = [[NSString alloc] initWithCString:cbody
+                                            encoding:NSUTF8StringEncoding];
+  free(ctitle);
+  free(cbody);
+  id image = [NSNull null];
+  if (iconLength > 0) {
+    NSData* buffer = [NSData dataWithBytes: iconBytes length:iconLength];
+    NSImage *icon = [[NSImage alloc] initWithData:buffer];
+    if (icon != nil) {
+      image = icon;
+    }
+  }
+  runInMainThread(@selector(show_notification:), @[title, body, image, [NSNumber numberWithInt:timeout]]);
+}
+
+void watch_theme() {
+  runInMainThread(@selector(watch_theme:), nil);
+}
+
+void set_tooltip_delay(int ms) {
+  // NSToolTip has no per view delay, only the app wide default
+  NSUserDefaults* defaults = [NSUserDefaults standardUserDefaults];
+  if (ms < 0) {
+    [defaults removeObjectForKey:@"NSInitialToolTipDelay"];
+  } else {
+    [defaults setInteger:ms forKey:@"NSInitialToolTipDelay"];
+  }
+}
+
+// setMenuChangedMessagesEnabled makes menu and its sub menus post their
+// change notifications right away, or hold them back until enabled again.
+static void setMenuChangedMessagesEnabled(NSMenu* menu, BOOL enabled) {
+  [menu setMenuChangedMessagesEnabled:enabled];
+  for (NSMenuItem* item in [menu itemArray]) {
+    if ([item hasSubmenu]) {
+      setMenuChangedMessagesEnabled([item submenu], enabled);
+    }
+  }
+}
+
+void set_menu_batching(bool batching) {
+  runBlockInMainThread(^{
+    NSStatusItem *statusItem = [(AppDelegate*)[NSApp delegate] statusItem];
+    setMenuChangedMessagesEnabled([statusItem menu], !batching);
+  });
+}
+
+bool register_hotkey(int hotkeyId, unsigned int modifiers, unsigned int key) {
+  __block bool result = false;
+  runBlockInMainThread(^{
+    if (hotkeyRefs == nil) {
+      hotkeyRefs = [[NSMutableDictionary alloc] init];
+      EventTypeSpec eventType = {kEventClassKeyboard, kEventHotKeyPressed};
+      InstallApplicationEventHandler(NewEventHandlerUPP(hotkeyPressed), 1,
+                                     &eventType, NULL, NULL);
+    }
+    unregisterHotkeyInMainThread(hotkeyId);
+    EventHotKeyID hotkeyID = {'stry', (UInt32)hotkeyId};
+    EventHotKeyRef ref;
+    if (RegisterEventHotKey(key, modifiers, hotkeyID,
+                            GetApplicationEventTarget(), 0, &ref) == noErr) {
+      [hotkeyRefs setObject:[NSValue valueWithPointer:ref]
+                     forKey:[NSNumber numberWithInt:hotkeyId]];
+      result = true;
+    }
+  });
+  return result;
+}
+
+void unregister_hotkey(int hotkeyId) {
+  runBlockInMainThread(^{
+    unregisterHotkeyInMainThread(hotkeyId);
+  });
+}
+
 void quit() {
   runInMainThread(@selector(quit), nil);
 }
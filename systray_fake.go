@@ -0,0 +1,314 @@
+//go:build systray_fake
+
+package systray
+
+import (
+	"sync"
+	"unsafe"
+)
+
+// The systray_fake build tag replaces the native backend with a fake one,
+// which needs neither cgo nor a display, so that code using systray can run
+// in unit tests, e.g.
+//
+//	go test -tags systray_fake ./...
+//
+// The fake backend performs no native call but records them all in memory,
+// see FakeCalls, and SimulateClick and SimulateQuit drive the application as
+// the user would. Each Run or Register starts with an empty menu and call
+// log, so tests may call Run one after another, but not concurrently. Menu
+// item IDs don't start over, like after ResetMenu.
+
+// FakeCall is a call to the native backend, as recorded by the fake backend.
+type FakeCall struct {
+	// Op is the operation, e.g. "AddOrUpdateMenuItem" or "SetIcon".
+	Op string
+	// ID is the ID of the menu item the operation is about, 0 if none.
+	ID uint32
+	// Text is the text argument of the operation if any, e.g. the title of
+	// the menu item.
+	Text string
+}
+
+var (
+	fakeCalls []FakeCall
+	// fakeExit is closed to end the event loop
+	fakeExit chan struct{}
+	muFake   sync.Mutex
+)
+
+// FakeCalls returns the calls to the native backend recorded since the
+// systray was registered, in the order they were made.
+func FakeCalls() []FakeCall {
+	muFake.Lock()
+	defer muFake.Unlock()
+	return append([]FakeCall(nil), fakeCalls...)
+}
+
+// ResetFakeCalls clears the recorded calls.
+func ResetFakeCalls() {
+	muFake.Lock()
+	fakeCalls = nil
+	muFake.Unlock()
+}
+
+// SimulateClick simulates the user clicking the menu item with the given ID,
+// invoking its callbacks the same way a native click does.
+func SimulateClick(id uint32) {
+	recordFakeCall("Click", id, "")
+	systrayMenuItemSelected(id)
+}
+
+// SimulateHotkey simulates the user pressing the hotkey registered for the
+// menu item with the given ID, see MenuItem.RegisterHotkey. It does nothing
+// if the menu item has no hotkey.
+func SimulateHotkey(id uint32) {
+	recordFakeCall("Hotkey", id, "")
+	muHotkeys.Lock()
+	hotkeyID, ok := hotkeys[id]
+	muHotkeys.Unlock()
+	if ok {
+		systrayHotkeyPressed(hotkeyID)
+	}
+}
+
+// SimulateMenuOpen simulates the user opening the sub menu of the menu item
+// with the given ID.
+func SimulateMenuOpen(id uint32) {
+	recordFakeCall("MenuOpen", id, "")
+	systrayMenuOpened(id)
+}
+
+// SimulateMenuClose simulates the user closing the sub menu of the menu item
+// with the given ID.
+func SimulateMenuClose(id uint32) {
+	recordFakeCall("MenuClose", id, "")
+	systrayMenuClosed(id)
+}
+
+// SimulateHover simulates the cursor entering the menu item with the given
+// ID.
+func SimulateHover(id uint32) {
+	recordFakeCall("Hover", id, "")
+	systrayMenuItemHovered(id)
+}
+
+// SimulateThemeChange simulates the OS switching to dark mode if isDark is
+// true, and to light mode otherwise.
+func SimulateThemeChange(isDark bool) {
+	recordFakeCall("ThemeChange", 0, "")
+	systrayThemeChanged(isDark)
+}
+
+// SimulateQuit simulates the platform ending the event loop, e.g. when the
+// user logs out, which makes Run invoke onExit and return.
+func SimulateQuit() {
+	recordFakeCall("SimulateQuit", 0, "")
+	quit()
+}
+
+// recordFakeCall records the call, and logs it to stderr in JSON Lines format
+// when headless, for CI jobs to check the menu.
+func recordFakeCall(op string, id uint32, text string) {
+	call := FakeCall{Op: op, ID: id, Text: text}
+	muFake.Lock()
+	fakeCalls = append(fakeCalls, call)
+	muFake.Unlock()
+	if headless() {
+		writeJSONLine(call)
+	}
+}
+
+func registerSystray() error {
+	muFake.Lock()
+	fakeCalls = nil
+	fakeExit = make(chan struct{})
+	muFake.Unlock()
+	menuItems.Range(func(id, _ interface{}) bool {
+		menuItems.Delete(id)
+		return true
+	})
+	muMenuOrder.Lock()
+	menuOrder = make(map[uint32][]uint32)
+	separators = make(map[uint32]bool)
+	muMenuOrder.Unlock()
+	recordFakeCall("RegisterSystray", 0, "")
+	systrayReady()
+	return nil
+}
+
+func nativeLoop() {
+	muFake.Lock()
+	exit := fakeExit
+	muFake.Unlock()
+	if exit != nil {
+		<-exit
+	}
+	systrayExit()
+}
+
+func quit() {
+	recordFakeCall("Quit", 0, "")
+	muFake.Lock()
+	defer muFake.Unlock()
+	if fakeExit != nil {
+		close(fakeExit)
+		fakeExit = nil
+	}
+}
+
+// forceQuit only records the call, which would terminate the tests.
+func forceQuit() {
+	recordFakeCall("ForceQuit", 0, "")
+}
+
+func setIcon(iconBytes []byte) error {
+	recordFakeCall("SetIcon", 0, "")
+	return nil
+}
+
+// SetTemplateIcon sets the systray icon as a template icon (on macOS), falling back
+// to a regular icon on other platforms.
+// templateIconBytes and regularIconBytes should be the content of .ico for windows and
+// .ico/.jpg/.png for other platforms.
+func SetTemplateIcon(templateIconBytes []byte, regularIconBytes []byte) {
+	SetIcon(regularIconBytes)
+}
+
+// SetTitle sets the text shown next to the tray icon, e.g. to display live
+// metrics such as "CPU 42%" in the menu bar on macOS. It does nothing on
+// Windows, whose notification area has no room for text, nor on Linux, where
+// few indicator hosts show a label.
+func SetTitle(title string) {
+	recordFakeCall("SetTitle", 0, title)
+}
+
+// SetTooltip sets the systray tooltip to display on mouse hover of the tray icon.
+// On Linux, it sets the title of the indicator, which hosts show on hover.
+func SetTooltip(tooltip string) {
+	recordFakeCall("SetTooltip", 0, tooltip)
+}
+
+func setIconBadge(text string) {
+	recordFakeCall("SetIconBadge", 0, text)
+}
+
+// NativeHandle returns the native object behind the tray icon, always nil
+// with the fake backend.
+func NativeHandle() unsafe.Pointer {
+	return nil
+}
+
+func setClipboardText(text string) error {
+	recordFakeCall("SetClipboardText", 0, text)
+	return nil
+}
+
+func openURL(url string) error {
+	recordFakeCall("OpenURL", 0, url)
+	return nil
+}
+
+func setMenuItemProgress(item *MenuItem, title string, progress float64) bool {
+	return false
+}
+
+func setStatusItemPriority(priority int) {
+	recordFakeCall("SetStatusItemPriority", 0, "")
+}
+
+func setIconDimmed(dimmed bool) {
+	if dimmed {
+		recordFakeCall("SetIconDimmed", 0, "")
+	} else {
+		recordFakeCall("SetIconUndimmed", 0, "")
+	}
+}
+
+func requestUserAttention(enabled bool) {
+	recordFakeCall("RequestUserAttention", 0, "")
+}
+
+func canChangeCheckable() bool {
+	return true
+}
+
+func recommendedIconSize() (width, height int) {
+	return 16, 16
+}
+
+func trayIconBounds() (x, y, width, height int, err error) {
+	return 0, 0, 0, 0, ErrBoundsUnavailable
+}
+
+func setTooltipDelay(item *MenuItem) {
+	recordFakeCall("SetTooltipDelay", item.id, "")
+}
+
+func setMenuItemIcon(item *MenuItem, iconBytes []byte) {
+	recordFakeCall("SetMenuItemIcon", item.id, "")
+}
+
+// SetTemplateIcon sets the icon of a menu item as a template icon (on macOS). On Windows and
+// Linux, it falls back to the regular icon bytes.
+// templateIconBytes and regularIconBytes should be the content of .ico for windows and
+// .ico/.jpg/.png for other platforms.
+func (item *MenuItem) SetTemplateIcon(templateIconBytes []byte, regularIconBytes []byte) {
+	item.SetIcon(regularIconBytes)
+}
+
+// nativeTitle returns the title of item, unchanged by its accelerator.
+func nativeTitle(item *MenuItem) string {
+	return item.loadTitle()
+}
+
+func addOrUpdateMenuItem(item *MenuItem) error {
+	recordFakeCall("AddOrUpdateMenuItem", item.id, nativeTitle(item))
+	return nil
+}
+
+func beginBatchUpdate() {
+	recordFakeCall("BeginBatchUpdate", 0, "")
+}
+
+func endBatchUpdate() {
+	recordFakeCall("EndBatchUpdate", 0, "")
+}
+
+func addSeparator(id, parentID uint32) {
+	recordFakeCall("AddSeparator", id, "")
+}
+
+func reorderMenuItems(parentID uint32, order []uint32) {
+	recordFakeCall("ReorderMenuItems", parentID, "")
+}
+
+func hideMenuItem(item *MenuItem) {
+	recordFakeCall("HideMenuItem", item.id, "")
+}
+
+func showMenuItem(item *MenuItem) {
+	recordFakeCall("ShowMenuItem", item.id, "")
+}
+
+func removeMenuItem(item *MenuItem) {
+	recordFakeCall("RemoveMenuItem", item.id, "")
+}
+
+func showNotification(n *notification) error {
+	recordFakeCall("ShowNotification", 0, n.title)
+	return nil
+}
+
+func watchTheme() {
+	recordFakeCall("WatchTheme", 0, "")
+}
+
+func registerHotkey(id uint32, mod Modifier, key Key) error {
+	recordFakeCall("RegisterHotkey", id, "")
+	return nil
+}
+
+func unregisterHotkey(id uint32) {
+	recordFakeCall("UnregisterHotkey", id, "")
+}
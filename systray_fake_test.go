@@ -0,0 +1,1168 @@
+//go:build systray_fake
+
+package systray
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image/color"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestFakeBackend(t *testing.T) {
+	clicked := make(chan struct{}, 1)
+	exited := false
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		Run(func() {
+			item := NewMenuItem("Item", WithOnClickedFunc(func() {
+				clicked <- struct{}{}
+			}))
+			item.SetTitle("Renamed")
+			SimulateClick(item.ID())
+		}, func() {
+			exited = true
+		})
+	}()
+
+	select {
+	case <-clicked:
+	case <-time.After(time.Second):
+		t.Fatal("click callback not invoked")
+	}
+	if !IsRunning() {
+		t.Error("IsRunning false while running")
+	}
+	SimulateQuit()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Run did not return after SimulateQuit")
+	}
+	if !exited {
+		t.Error("onExit not invoked")
+	}
+	if IsRunning() {
+		t.Error("IsRunning true after quitting")
+	}
+
+	var ops []string
+	var titles []string
+	for _, call := range FakeCalls() {
+		ops = append(ops, call.Op)
+		if call.Op == "AddOrUpdateMenuItem" {
+			titles = append(titles, call.Text)
+		}
+	}
+	want := []string{"RegisterSystray", "AddOrUpdateMenuItem", "AddOrUpdateMenuItem", "Click", "SimulateQuit", "Quit"}
+	if len(ops) != len(want) {
+		t.Fatalf("recorded %v, want %v", ops, want)
+	}
+	for i := range want {
+		if ops[i] != want[i] {
+			t.Fatalf("recorded %v, want %v", ops, want)
+		}
+	}
+	if titles[0] != "Item" || titles[1] != "Renamed" {
+		t.Errorf("recorded titles %v", titles)
+	}
+}
+
+func TestSnapshotMenu(t *testing.T) {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		Run(func() {
+			parent := NewMenuItem("Parent", WithTooltip("tip"))
+			NewSeparator()
+			child := NewMenuItem("Child", WithParent(parent), WithDisabled())
+			child.Check()
+			child.Hide()
+
+			b, err := json.Marshal(SnapshotMenu())
+			if err != nil {
+				t.Errorf("unable to marshal snapshot: %v", err)
+			}
+			var got []MenuItemSnapshot
+			if err := json.Unmarshal(b, &got); err != nil {
+				t.Errorf("unable to unmarshal snapshot: %v", err)
+			}
+			want := []MenuItemSnapshot{
+				{ID: parent.ID(), Title: "Parent", Tooltip: "tip", Visible: true},
+				{ID: parent.ID() + 1, Visible: true, IsSeparator: true},
+				{ID: child.ID(), Title: "Child", Disabled: true, Checked: true, ParentID: parent.ID()},
+			}
+			if len(got) != len(want) {
+				t.Errorf("snapshot %+v, want %+v", got, want)
+			} else {
+				for i := range want {
+					if got[i] != want[i] {
+						t.Errorf("snapshot[%d] %+v, want %+v", i, got[i], want[i])
+					}
+				}
+			}
+			Quit()
+		}, nil)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Run did not return after Quit")
+	}
+}
+
+// runFake runs the systray with onReady, quits it once onReady returns, and
+// fails the test if it doesn't quit in time, so that a test stuck waiting in
+// onReady fails instead of hanging.
+func runFake(t *testing.T, onReady func()) {
+	t.Helper()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		Run(func() {
+			defer Quit()
+			onReady()
+		}, nil)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		SimulateQuit()
+		t.Fatal("Run did not return")
+	}
+}
+
+func TestMenuHeaderEnable(t *testing.T) {
+	runFake(t, func() {
+		header := NewMenuHeader("Devices")
+		header.Enable()
+		if !header.IsDisabled() {
+			t.Error("header enabled")
+		}
+	})
+}
+
+func TestClickWorkerPool(t *testing.T) {
+	SetClickWorkerPool(2)
+	defer SetClickWorkerPool(0)
+	release := make(chan struct{})
+	started := make(chan struct{}, 5)
+	runFake(t, func() {
+		item := NewMenuItem("Slow", WithOnClickedFunc(func() {
+			started <- struct{}{}
+			<-release
+		}))
+		for i := 0; i < 5; i++ {
+			SimulateClick(item.ID())
+		}
+		for i := 0; i < 2; i++ {
+			select {
+			case <-started:
+			case <-time.After(time.Second):
+				t.Error("click not handled by a worker")
+			}
+		}
+		if n := ClickQueueLen(); n != 3 {
+			t.Errorf("ClickQueueLen() = %d, want 3", n)
+		}
+		close(release)
+		for i := 0; i < 3; i++ {
+			select {
+			case <-started:
+			case <-time.After(time.Second):
+				t.Error("queued click not handled")
+				return
+			}
+		}
+	})
+}
+
+func TestMaxUpdateRate(t *testing.T) {
+	SetMaxUpdateRate(20)
+	defer SetMaxUpdateRate(0)
+	titles := func() []string {
+		var titles []string
+		for _, call := range FakeCalls() {
+			if call.Op == "AddOrUpdateMenuItem" {
+				titles = append(titles, call.Text)
+			}
+		}
+		return titles
+	}
+	runFake(t, func() {
+		item := NewMenuItem("CPU 0%")
+		for i := 1; i <= 5; i++ {
+			item.SetTitle(fmt.Sprintf("CPU %d%%", i))
+		}
+		deadline := time.Now().Add(time.Second)
+		for len(titles()) < 2 && time.Now().Before(deadline) {
+			time.Sleep(time.Millisecond)
+		}
+		time.Sleep(100 * time.Millisecond)
+		want := []string{"CPU 0%", "CPU 5%"}
+		if got := titles(); !reflect.DeepEqual(got, want) {
+			t.Errorf("updates = %q, want %q", got, want)
+		}
+	})
+}
+
+func TestWaitForReady(t *testing.T) {
+	ready := WaitForReady()
+	runFake(t, func() {
+		select {
+		case <-ready:
+		case <-time.After(time.Second):
+			t.Error("WaitForReady not closed")
+		}
+	})
+	// quitting again once stopped is a no-op
+	Quit()
+}
+
+func TestUpdateAfterRemove(t *testing.T) {
+	var id uint32
+	runFake(t, func() {
+		item := NewMenuItem("Ghost")
+		id = item.ID()
+		item.Remove()
+		item.SetTitle("Still a ghost")
+		item.Check()
+	})
+	if _, ok := GetMenuItemByID(id); ok {
+		t.Error("removed menu item found by ID")
+	}
+	calls := FakeCalls()
+	for i, call := range calls {
+		if call.Op == "RemoveMenuItem" {
+			for _, call := range calls[i:] {
+				if call.Op == "AddOrUpdateMenuItem" {
+					t.Errorf("menu item updated after Remove: %+v", call)
+				}
+			}
+			return
+		}
+	}
+	t.Error("menu item not removed")
+}
+
+func TestMenuItemCheckbox(t *testing.T) {
+	changes := make(chan bool, 2)
+	runFake(t, func() {
+		item := NewMenuItemCheckbox("Wi-Fi", true, func(checked bool) {
+			changes <- checked
+		})
+		SimulateClick(item.ID())
+		SimulateClick(item.ID())
+	})
+	for _, want := range []bool{false, true} {
+		select {
+		case got := <-changes:
+			if got != want {
+				t.Errorf("onChange(%v), want onChange(%v)", got, want)
+			}
+		default:
+			t.Fatal("onChange not called")
+		}
+	}
+}
+
+func TestIconAsPNG(t *testing.T) {
+	small, _ := NewIconFromTemplate(IconShapeCircle, color.RGBA{A: 0xff}, 16)
+	large, _ := NewIconFromTemplate(IconShapeCircle, color.RGBA{A: 0xff}, 32)
+	element := func(typ string, data []byte) []byte {
+		b := make([]byte, 8, 8+len(data))
+		copy(b, typ)
+		binary.BigEndian.PutUint32(b[4:], uint32(8+len(data)))
+		return append(b, data...)
+	}
+	body := append(element("ic04", small), element("ic05", large)...)
+	icns := append(element("icns", nil), body...)
+	binary.BigEndian.PutUint32(icns[4:], uint32(len(icns)))
+	if got, err := iconAsPNG(icns); err != nil || !bytes.Equal(got, large) {
+		t.Errorf("iconAsPNG(icns) = %d bytes, %v, want the 32x32 PNG", len(got), err)
+	}
+	if got, err := iconAsPNG(pngToICO(large)); err != nil || !bytes.Equal(got, large) {
+		t.Errorf("iconAsPNG(ico) = %d bytes, %v, want the embedded PNG", len(got), err)
+	}
+	if _, err := iconAsPNG(element("icns", nil)); err != ErrUnsupportedIconFormat {
+		t.Errorf("iconAsPNG(empty icns) error = %v, want ErrUnsupportedIconFormat", err)
+	}
+}
+
+func TestSwapMenuItems(t *testing.T) {
+	runFake(t, func() {
+		a := NewMenuItem("A")
+		b := NewMenuItem("B")
+		c := NewMenuItem("C")
+		if err := SwapMenuItems(a, c); err != nil {
+			t.Errorf("SwapMenuItems: %v", err)
+		}
+		muMenuOrder.RLock()
+		got := append([]uint32(nil), menuOrder[0]...)
+		muMenuOrder.RUnlock()
+		if want := []uint32{c.ID(), b.ID(), a.ID()}; !reflect.DeepEqual(got, want) {
+			t.Errorf("order = %v, want %v", got, want)
+		}
+		child := NewMenuItem("Child", WithParent(a))
+		if err := SwapMenuItems(child, b); err != ErrNotSameMenu {
+			t.Errorf("SwapMenuItems across menus error = %v, want ErrNotSameMenu", err)
+		}
+	})
+}
+
+func TestCloneMenuItem(t *testing.T) {
+	clicked := make(chan struct{}, 1)
+	runFake(t, func() {
+		src := NewMenuItem("Device", WithTooltip("Connected"), WithCheckable(true), WithOnClickedFunc(func() {
+			clicked <- struct{}{}
+		}))
+		clone := CloneMenuItem(src, WithDisabled())
+		src.SetTitle("Renamed")
+		src.Uncheck()
+		if clone.ID() == src.ID() {
+			t.Error("clone has the ID of its source")
+		}
+		if clone.GetTitle() != "Device" || clone.GetTooltip() != "Connected" || !clone.IsChecked() || !clone.IsDisabled() {
+			t.Errorf("clone = %q %q checked %v disabled %v, want \"Device\" \"Connected\" checked disabled",
+				clone.GetTitle(), clone.GetTooltip(), clone.IsChecked(), clone.IsDisabled())
+		}
+		SimulateClick(clone.ID())
+
+		checkbox := NewMenuItemCheckbox("Wi-Fi", true, nil)
+		checkboxClone := CloneMenuItem(checkbox)
+		SimulateClick(checkboxClone.ID())
+		if !checkbox.IsChecked() || checkboxClone.IsChecked() {
+			t.Errorf("checkbox checked %v, clone checked %v, want the clone toggled only",
+				checkbox.IsChecked(), checkboxClone.IsChecked())
+		}
+	})
+	select {
+	case <-clicked:
+	default:
+		t.Error("click callback of the source not invoked by the clone")
+	}
+}
+
+func TestBuildMenuFromSpec(t *testing.T) {
+	if _, err := BuildMenuFromSpec([]MenuItemSpec{{Title: "Orphan", ParentTitle: "Missing"}}); err == nil {
+		t.Error("BuildMenuFromSpec with a missing parent succeeded")
+	}
+	runFake(t, func() {
+		items, err := BuildMenuFromSpec([]MenuItemSpec{
+			{Title: "Sync", ParentTitle: "Settings", Checked: true},
+			{Title: "Settings"},
+			{Separator: true},
+			{Title: "Quit"},
+		})
+		if err != nil {
+			t.Errorf("BuildMenuFromSpec: %v", err)
+			return
+		}
+		if items[0].Parent() != items[1] || !items[0].IsChecked() {
+			t.Errorf("Sync has parent %v, checked %v, want Settings, checked", items[0].Parent(), items[0].IsChecked())
+		}
+		muMenuOrder.RLock()
+		got := append([]uint32(nil), menuOrder[0]...)
+		muMenuOrder.RUnlock()
+		if want := []uint32{items[1].ID(), items[2].ID(), items[3].ID()}; !reflect.DeepEqual(got, want) {
+			t.Errorf("main menu = %v, want %v", got, want)
+		}
+	})
+}
+
+func TestShutdownTimeout(t *testing.T) {
+	ShutdownTimeout(10 * time.Millisecond)
+	defer ShutdownTimeout(0)
+	forced := func() bool {
+		for _, call := range FakeCalls() {
+			if call.Op == "ForceQuit" {
+				return true
+			}
+		}
+		return false
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		Run(Quit, func() {
+			// blocks until the process would have been terminated
+			deadline := time.Now().Add(5 * time.Second)
+			for !forced() && time.Now().Before(deadline) {
+				time.Sleep(time.Millisecond)
+			}
+		})
+	}()
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("Run did not return")
+	}
+	if !forced() {
+		t.Error("the process was not terminated past the shutdown timeout")
+	}
+}
+
+func TestToggle(t *testing.T) {
+	runFake(t, func() {
+		item := NewMenuItem("Sync", WithCheckable(false))
+		const toggles = 100
+		var checks int32
+		var wg sync.WaitGroup
+		for i := 0; i < toggles; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if item.Toggle() {
+					atomic.AddInt32(&checks, 1)
+				}
+			}()
+		}
+		wg.Wait()
+		if item.IsChecked() || checks != toggles/2 {
+			t.Errorf("checked %v after %d toggles checking it %d times", item.IsChecked(), toggles, checks)
+		}
+	})
+}
+
+func TestSetStateWrappers(t *testing.T) {
+	runFake(t, func() {
+		item := NewMenuItem("Item")
+		item.SetEnabled(false)
+		item.SetChecked(true)
+		item.SetVisible(false)
+		if !item.IsDisabled() || !item.IsChecked() || item.IsVisible() {
+			t.Errorf("disabled %v, checked %v, visible %v, want true, true, false", item.IsDisabled(), item.IsChecked(), item.IsVisible())
+		}
+		item.SetEnabled(true)
+		item.SetChecked(false)
+		item.SetVisible(true)
+		if item.IsDisabled() || item.IsChecked() || !item.IsVisible() {
+			t.Errorf("disabled %v, checked %v, visible %v, want false, false, true", item.IsDisabled(), item.IsChecked(), item.IsVisible())
+		}
+	})
+}
+
+func TestAttentionMode(t *testing.T) {
+	// waitForEnd waits for the blinking to be done and the icon restored
+	waitForEnd := func() bool {
+		muAttention.Lock()
+		done := attentionDone
+		muAttention.Unlock()
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+			return false
+		}
+		muAttention.Lock()
+		defer muAttention.Unlock()
+		return attentionStop == nil
+	}
+	runFake(t, func() {
+		ResetFakeCalls()
+		SetAttentionMode(true, WithAttentionRepeat(1))
+		if !waitForEnd() {
+			t.Error("attention mode did not end after blinking once")
+			return
+		}
+		var ops []string
+		for _, call := range FakeCalls() {
+			ops = append(ops, call.Op)
+		}
+		want := []string{"RequestUserAttention", "SetIconDimmed", "SetIconUndimmed", "SetIconUndimmed", "RequestUserAttention"}
+		if !reflect.DeepEqual(ops, want) {
+			t.Errorf("recorded %v, want %v", ops, want)
+		}
+
+		item := NewMenuItem("Item")
+		SetAttentionMode(true)
+		SimulateClick(item.ID())
+		if !waitForEnd() {
+			t.Error("attention mode did not end on click")
+		}
+	})
+}
+
+func TestDebounce(t *testing.T) {
+	runFake(t, func() {
+		var clicks int32
+		item := NewMenuItem("Sync", WithDebounce(50*time.Millisecond), WithOnClickedFunc(func() {
+			atomic.AddInt32(&clicks, 1)
+		}))
+		for i := 0; i < 5; i++ {
+			SimulateClick(item.ID())
+			time.Sleep(10 * time.Millisecond)
+		}
+		if n := atomic.LoadInt32(&clicks); n != 0 {
+			t.Errorf("callback invoked %d times within the debounce window", n)
+		}
+		time.Sleep(200 * time.Millisecond)
+		if n := atomic.LoadInt32(&clicks); n != 1 {
+			t.Errorf("callback invoked %d times after the debounce window, want once", n)
+		}
+
+		SimulateClick(item.ID())
+		item.Remove()
+		time.Sleep(200 * time.Millisecond)
+		if n := atomic.LoadInt32(&clicks); n != 1 {
+			t.Errorf("callback invoked %d times after Remove, want once", n)
+		}
+	})
+}
+
+func TestThrottle(t *testing.T) {
+	runFake(t, func() {
+		clicked := make(chan struct{}, 10)
+		item := NewMenuItem("Sync", WithThrottle(time.Hour), WithOnClickedFunc(func() {
+			clicked <- struct{}{}
+		}))
+		for i := 0; i < 5; i++ {
+			SimulateClick(item.ID())
+		}
+		select {
+		case <-clicked:
+		case <-time.After(time.Second):
+			t.Error("first click not invoked")
+			return
+		}
+		select {
+		case <-clicked:
+			t.Error("click within the throttle window invoked")
+		case <-time.After(50 * time.Millisecond):
+		}
+	})
+}
+
+// recordingHook records the menu changes it's notified of.
+type recordingHook struct {
+	name   string
+	mu     *sync.Mutex
+	events *[]string
+}
+
+func (h recordingHook) OnItemAdded(item *MenuItem) {
+	h.mu.Lock()
+	*h.events = append(*h.events, fmt.Sprintf("%s added %s", h.name, item.loadTitle()))
+	h.mu.Unlock()
+}
+
+func (h recordingHook) OnItemRemoved(item *MenuItem) {
+	h.mu.Lock()
+	*h.events = append(*h.events, fmt.Sprintf("%s removed %s", h.name, item.loadTitle()))
+	h.mu.Unlock()
+}
+
+func TestMenuChangeHooks(t *testing.T) {
+	var mu sync.Mutex
+	var events []string
+	first := RegisterMenuChangeHook(recordingHook{"first", &mu, &events})
+	second := RegisterMenuChangeHook(recordingHook{"second", &mu, &events})
+	defer first.Unregister()
+	defer second.Unregister()
+	runFake(t, func() {
+		parent := NewMenuItem("Parent")
+		NewMenuItem("Child", WithParent(parent))
+		parent.Remove()
+		second.Unregister()
+		second.Unregister()
+		NewMenuItem("Other")
+	})
+	want := []string{
+		"first added Parent", "second added Parent",
+		"first added Child", "second added Child",
+		"first removed Child", "second removed Child",
+		"first removed Parent", "second removed Parent",
+		"first added Other",
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if !reflect.DeepEqual(events, want) {
+		t.Errorf("hooks notified of %v, want %v", events, want)
+	}
+}
+
+func TestTray(t *testing.T) {
+	other := New()
+	runFake(t, func() {
+		if !Default().IsRunning() || other.IsRunning() {
+			t.Errorf("default Tray running %v, other one %v, want true, false", Default().IsRunning(), other.IsRunning())
+		}
+		if err := other.RunE(nil, nil); !errors.Is(err, ErrTrayRunning) {
+			t.Errorf("running a second Tray returned %v, want ErrTrayRunning", err)
+		}
+		other.Quit()
+		if !IsRunning() {
+			t.Error("quitting a Tray which isn't running quit the default one")
+		}
+	})
+	exited := false
+	other.Run(other.Quit, func() {
+		exited = true
+	})
+	if !exited {
+		t.Error("the other Tray didn't run once the default one exited")
+	}
+}
+
+func TestTooltipDelay(t *testing.T) {
+	runFake(t, func() {
+		ResetFakeCalls()
+		item := NewMenuItem("Status", WithTooltip("All good"), WithTooltipDelay(0))
+		plain := NewMenuItem("Plain", WithTooltip("tip"))
+		item.SetTooltipDelay(100)
+		var ids []uint32
+		for _, call := range FakeCalls() {
+			if call.Op == "SetTooltipDelay" {
+				ids = append(ids, call.ID)
+			}
+		}
+		if want := []uint32{item.ID(), item.ID()}; !reflect.DeepEqual(ids, want) {
+			t.Errorf("tooltip delay set for %v, want %v", ids, want)
+		}
+		if d := plain.loadTooltipDelay(); d >= 0 {
+			t.Errorf("default tooltip delay %d, want negative", d)
+		}
+		if d := CloneMenuItem(item).loadTooltipDelay(); d != 100 {
+			t.Errorf("clone tooltip delay %d, want 100", d)
+		}
+	})
+}
+
+func TestHotkey(t *testing.T) {
+	runFake(t, func() {
+		clicked := make(chan string, 10)
+		items := map[string]*MenuItem{}
+		for _, spec := range []struct {
+			title string
+			opts  []MenuItemOption
+		}{
+			{"enabled", []MenuItemOption{WithID(0x10000)}},
+			{"disabled", []MenuItemOption{WithDisabled()}},
+			{"soft disabled", []MenuItemOption{WithSoftDisable()}},
+			{"hidden", nil},
+		} {
+			title := spec.title
+			item := NewMenuItem(title, append(spec.opts, WithOnClickedFunc(func() {
+				clicked <- title
+			}))...)
+			if err := item.RegisterHotkey(ModCtrl, KeyA+Key(len(items))); err != nil {
+				t.Errorf("RegisterHotkey %s: %v", spec.title, err)
+				return
+			}
+			items[spec.title] = item
+		}
+		items["hidden"].Hide()
+		for _, call := range FakeCalls() {
+			if call.Op == "RegisterHotkey" && call.ID > maxHotkeyID {
+				t.Errorf("hotkey registered with ID %#x, beyond %#x", call.ID, maxHotkeyID)
+			}
+		}
+		for title, item := range items {
+			SimulateHotkey(item.ID())
+			want := title == "enabled" || title == "soft disabled"
+			select {
+			case got := <-clicked:
+				if !want || got != title {
+					t.Errorf("hotkey of %s invoked the callback of %s", title, got)
+				}
+			case <-time.After(100 * time.Millisecond):
+				if want {
+					t.Errorf("hotkey of %s didn't invoke its callback", title)
+				}
+			}
+		}
+
+		item := items["enabled"]
+		item.Remove()
+		if err := item.RegisterHotkey(ModCtrl, KeyZ); !errors.Is(err, ErrMenuItemRemoved) {
+			t.Errorf("RegisterHotkey after Remove returned %v, want ErrMenuItemRemoved", err)
+		}
+		muHotkeys.Lock()
+		_, registered := hotkeys[item.ID()]
+		muHotkeys.Unlock()
+		if registered {
+			t.Error("hotkey still registered after Remove")
+		}
+	})
+}
+
+func TestSetIconErrors(t *testing.T) {
+	valid, err := os.ReadFile("testdata/icon.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	runFake(t, func() {
+		for _, test := range []struct {
+			name      string
+			iconBytes []byte
+			want      error
+		}{
+			{"nil", nil, ErrEmptyIcon},
+			{"empty", []byte{}, ErrEmptyIcon},
+			{"not an image", []byte("not an image"), ErrUnsupportedIconFormat},
+			{"truncated PNG signature", valid[:4], ErrUnsupportedIconFormat},
+			{"PNG", valid, nil},
+		} {
+			ResetFakeCalls()
+			if err := SetIcon(test.iconBytes); !errors.Is(err, test.want) {
+				t.Errorf("SetIcon(%s) returned %v, want %v", test.name, err, test.want)
+			}
+			calls := FakeCalls()
+			if set := len(calls) > 0 && calls[len(calls)-1].Op == "SetIcon"; set != (test.want == nil) {
+				t.Errorf("SetIcon(%s) set the native icon: %v", test.name, set)
+			}
+		}
+	})
+}
+
+func TestResetMenu(t *testing.T) {
+	var last uint32
+	runFake(t, func() {
+		clicked := make(chan struct{}, 1)
+		old := NewMenuItem("Old")
+		NewSeparator()
+		NewMenuItem("Child", WithParent(old))
+		ResetMenu()
+		if got := SnapshotMenu(); len(got) != 0 {
+			t.Errorf("menu after ResetMenu = %+v, want empty", got)
+		}
+		item := NewMenuItem("New", WithOnClickedFunc(func() { clicked <- struct{}{} }))
+		if item.ID() <= old.ID() {
+			t.Errorf("ID after ResetMenu = %d, want greater than %d", item.ID(), old.ID())
+		}
+		muMenuOrder.RLock()
+		got := append([]uint32(nil), menuOrder[0]...)
+		muMenuOrder.RUnlock()
+		if want := []uint32{item.ID()}; !reflect.DeepEqual(got, want) {
+			t.Errorf("order = %v, want %v", got, want)
+		}
+		// a click in flight on a removed menu item doesn't reach the new one
+		SimulateClick(old.ID())
+		SimulateClick(old.ID() + 2)
+		select {
+		case <-clicked:
+			t.Error("click on a removed menu item reached a new one")
+		case <-time.After(50 * time.Millisecond):
+		}
+		SimulateClick(item.ID())
+		select {
+		case <-clicked:
+		case <-time.After(time.Second):
+			t.Error("click on the new menu item not delivered")
+		}
+		last = item.ID()
+	})
+	runFake(t, func() {
+		if id := NewMenuItem("Next run").ID(); id <= last {
+			t.Errorf("ID in the next run = %d, want greater than %d", id, last)
+		}
+	})
+}
+
+func TestBatchUpdate(t *testing.T) {
+	var mu sync.Mutex
+	var events []string
+	hook := RegisterMenuChangeHook(recordingHook{"hook", &mu, &events})
+	defer hook.Unregister()
+	runFake(t, func() {
+		item := NewMenuItem("Before")
+		calls := len(FakeCalls())
+		var added *MenuItem
+		BatchUpdate(func() {
+			item.SetTitle("During")
+			BatchUpdate(func() {
+				added = NewMenuItem("Added")
+			})
+			item.SetTitle("After")
+			if got := FakeCalls()[calls:]; len(got) != 0 {
+				t.Errorf("calls during the batch = %+v, want none", got)
+			}
+			mu.Lock()
+			if want := []string{"hook added Before"}; !reflect.DeepEqual(events, want) {
+				t.Errorf("events during the batch = %v, want %v", events, want)
+			}
+			mu.Unlock()
+		})
+		want := []FakeCall{
+			{Op: "BeginBatchUpdate"},
+			{Op: "AddOrUpdateMenuItem", ID: item.ID(), Text: "After"},
+			{Op: "AddOrUpdateMenuItem", ID: added.ID(), Text: "Added"},
+			{Op: "EndBatchUpdate"},
+		}
+		if got := FakeCalls()[calls:]; !reflect.DeepEqual(got, want) {
+			t.Errorf("calls after the batch = %+v, want %+v", got, want)
+		}
+		mu.Lock()
+		if want := []string{"hook added Before", "hook added Added"}; !reflect.DeepEqual(events, want) {
+			t.Errorf("events after the batch = %v, want %v", events, want)
+		}
+		mu.Unlock()
+		calls = len(FakeCalls())
+		BatchUpdate(func() {})
+		if got := FakeCalls()[calls:]; len(got) != 0 {
+			t.Errorf("calls of an empty batch = %+v, want none", got)
+		}
+	})
+}
+
+func TestClipboardMenuItem(t *testing.T) {
+	runFake(t, func() {
+		item := NewClipboardMenuItem("192.168.1.10", "Copy the address", "192.168.1.10")
+		// clicked right away, as the menu may show before
+		// NewClipboardMenuItem returns
+		SimulateClick(item.ID())
+		deadline := time.Now().Add(time.Second)
+		for item.loadTitle() != copiedMark+"192.168.1.10" {
+			if time.Now().After(deadline) {
+				t.Errorf("title = %q, want the copied mark", item.loadTitle())
+				return
+			}
+			time.Sleep(time.Millisecond)
+		}
+		var copied []string
+		for _, call := range FakeCalls() {
+			if call.Op == "SetClipboardText" {
+				copied = append(copied, call.Text)
+			}
+		}
+		if want := []string{"192.168.1.10"}; !reflect.DeepEqual(copied, want) {
+			t.Errorf("copied %q, want %q", copied, want)
+		}
+		// so that the title restored after the flash isn't recorded by the
+		// next tests
+		item.Remove()
+	})
+}
+
+func TestSubMenu(t *testing.T) {
+	runFake(t, func() {
+		other := NewMenuItem("Other")
+		sub := NewSubMenu("More")
+		help := sub.AddItem("Help", WithParent(other))
+		sub.AddSeparator()
+		about := sub.AddItem("About")
+		var parents []uint32
+		for _, s := range SnapshotMenu() {
+			parents = append(parents, s.ParentID)
+		}
+		if want := []uint32{0, 0, sub.ID(), sub.ID(), sub.ID()}; !reflect.DeepEqual(parents, want) {
+			t.Errorf("parent IDs = %v, want %v", parents, want)
+		}
+		muMenuOrder.RLock()
+		order := append([]uint32(nil), menuOrder[sub.ID()]...)
+		muMenuOrder.RUnlock()
+		if want := []uint32{help.ID(), help.ID() + 1, about.ID()}; !reflect.DeepEqual(order, want) {
+			t.Errorf("sub menu order = %v, want %v", order, want)
+		}
+		sub.Hide()
+		if sub.IsVisible() || !help.IsVisible() {
+			t.Error("Hide didn't hide the header alone")
+		}
+	})
+}
+
+func TestCloneRadioGroupMember(t *testing.T) {
+	runFake(t, func() {
+		var changes []int
+		g := NewMenuItemRadioGroup([]string{"Low", "High"}, 0, func(index int) {
+			changes = append(changes, index)
+		}, WithAccelerator("l"), WithItemStyle(ItemStyle{Bold: true}))
+		icon, err := os.ReadFile("testdata/icon.png")
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		high := g.Items()[1]
+		high.SetIcon(icon)
+		clone := CloneMenuItem(high)
+		SimulateClick(clone.ID())
+		if got := g.Selected(); got != 0 || len(changes) != 0 {
+			t.Errorf("clicking the clone selected %d in the group, changes %v, want 0 and none", got, changes)
+		}
+		if !clone.IsChecked() || high.IsChecked() {
+			t.Errorf("clone checked %v, source checked %v, want the clone checked only", clone.IsChecked(), high.IsChecked())
+		}
+		if !clone.isRadio || clone.accelerator != "l" || clone.style == nil || !clone.style.Bold || !bytes.Equal(clone.icon, high.icon) {
+			t.Errorf("clone radio %v accelerator %q style %+v icon set %v, want those of its source",
+				clone.isRadio, clone.accelerator, clone.style, clone.icon != nil)
+		}
+		if header := CloneMenuItem(NewMenuHeader("Devices")); !header.isHeader || !header.IsDisabled() {
+			t.Error("clone of a header is not a header")
+		}
+	})
+}
+
+func TestMenuOrder(t *testing.T) {
+	runFake(t, func() {
+		order := func() []uint32 {
+			muMenuOrder.RLock()
+			defer muMenuOrder.RUnlock()
+			return append([]uint32(nil), menuOrder[0]...)
+		}
+		a := NewMenuItem("A")
+		c := NewMenuItem("C")
+		b := InsertMenuItemBefore(c, "B")
+		sep := NewSeparator()
+		d := InsertMenuItemAfter(c, "D")
+		other := NewMenuItem("Other")
+		child := InsertMenuItemAfter(NewMenuItem("Child", WithParent(other)), "Inserted", WithParent(a))
+		if child.parentId() != other.ID() {
+			t.Errorf("inserted menu item parent = %d, want the one of its anchor %d", child.parentId(), other.ID())
+		}
+		if want := []uint32{a.ID(), b.ID(), c.ID(), d.ID(), sep.ID(), other.ID()}; !reflect.DeepEqual(order(), want) {
+			t.Errorf("order after Insert = %v, want %v", order(), want)
+		}
+
+		for _, tt := range []struct {
+			name  string
+			move  func() error
+			err   error
+			order []uint32
+		}{
+			{"MoveBefore", func() error { return d.MoveBefore(a) }, nil,
+				[]uint32{d.ID(), a.ID(), b.ID(), c.ID(), sep.ID(), other.ID()}},
+			{"MoveAfter", func() error { return a.MoveAfter(sep) }, nil,
+				[]uint32{d.ID(), b.ID(), c.ID(), sep.ID(), a.ID(), other.ID()}},
+			{"around itself", func() error { return a.MoveAfter(a) }, ErrMoveAroundItself,
+				[]uint32{d.ID(), b.ID(), c.ID(), sep.ID(), a.ID(), other.ID()}},
+			{"to another menu", func() error { return child.MoveBefore(a) }, ErrNotSameMenu,
+				[]uint32{d.ID(), b.ID(), c.ID(), sep.ID(), a.ID(), other.ID()}},
+		} {
+			if err := tt.move(); err != tt.err {
+				t.Errorf("%s error = %v, want %v", tt.name, err, tt.err)
+			}
+			if got := order(); !reflect.DeepEqual(got, tt.order) {
+				t.Errorf("order after %s = %v, want %v", tt.name, got, tt.order)
+			}
+		}
+
+		b.Remove()
+		if err := c.MoveBefore(b); err != ErrMenuItemRemoved {
+			t.Errorf("MoveBefore a removed menu item error = %v, want ErrMenuItemRemoved", err)
+		}
+		if e := InsertMenuItemBefore(b, "E"); !reflect.DeepEqual(order()[len(order())-1:], []uint32{e.ID()}) {
+			t.Errorf("order after inserting before a removed menu item = %v, want %d last", order(), e.ID())
+		}
+	})
+}
+
+func TestWithIDCollision(t *testing.T) {
+	runFake(t, func() {
+		item := NewMenuItem("Stable", WithID(1000))
+		if item.ID() != 1000 {
+			t.Errorf("ID = %d, want 1000", item.ID())
+		}
+		if next := NewMenuItem("Next"); next.ID() <= 1000 {
+			t.Errorf("automatic ID after WithID = %d, want greater than 1000", next.ID())
+		}
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Error("no panic on an ID in use")
+				}
+			}()
+			NewMenuItem("Duplicate", WithID(1000))
+		}()
+		if got, _ := GetMenuItemByID(1000); got != item {
+			t.Errorf("menu item 1000 = %v, want the first one", got)
+		}
+		item.Remove()
+		if reused := NewMenuItem("Reused", WithID(1000)); reused.ID() != 1000 {
+			t.Errorf("ID of a removed menu item not reusable, got %d", reused.ID())
+		}
+	})
+}
+
+func TestRadioGroup(t *testing.T) {
+	runFake(t, func() {
+		var changes []int
+		g := NewMenuItemRadioGroup([]string{"Low", "Medium", "High"}, 1, func(index int) {
+			changes = append(changes, index)
+		})
+		checked := func() []bool {
+			var states []bool
+			for _, item := range g.Items() {
+				states = append(states, item.IsChecked())
+			}
+			return states
+		}
+		items := g.Items()
+		for _, tt := range []struct {
+			name     string
+			act      func()
+			selected int
+			checked  []bool
+			changes  []int
+		}{
+			{"initially", func() {}, 1, []bool{false, true, false}, nil},
+			{"click", func() { SimulateClick(items[2].ID()) }, 2, []bool{false, false, true}, []int{2}},
+			{"click on the selected item", func() { SimulateClick(items[2].ID()) }, 2, []bool{false, false, true}, []int{2}},
+			{"SetSelected", func() { g.SetSelected(0) }, 0, []bool{true, false, false}, []int{2}},
+			{"SetSelected out of range", func() { g.SetSelected(3) }, -1, []bool{false, false, false}, []int{2}},
+		} {
+			tt.act()
+			if got := g.Selected(); got != tt.selected {
+				t.Errorf("%s: selected = %d, want %d", tt.name, got, tt.selected)
+			}
+			if got := checked(); !reflect.DeepEqual(got, tt.checked) {
+				t.Errorf("%s: checked = %v, want %v", tt.name, got, tt.checked)
+			}
+			if !reflect.DeepEqual(changes, tt.changes) {
+				t.Errorf("%s: changes = %v, want %v", tt.name, changes, tt.changes)
+			}
+		}
+	})
+}
+
+func TestMux(t *testing.T) {
+	runFake(t, func() {
+		var mu sync.Mutex
+		var got []string
+		record := func(s string) func() {
+			return func() {
+				mu.Lock()
+				got = append(got, s)
+				mu.Unlock()
+			}
+		}
+		sub := NewMux()
+		a := NewMenuItem("A", WithOnClickedFunc(record("a callback")))
+		b := NewMenuItem("B")
+		c := NewMenuItem("C")
+		Handle(a, record("a handler"))
+		HandleFunc(b, func() { sub.Dispatch(b) })
+		sub.Handle(b, record("b sub handler"))
+		Handle(c, record("c handler"))
+		defer Handle(a, nil)
+		defer Handle(b, nil)
+
+		Handle(c, nil)
+		for _, item := range []*MenuItem{a, b, c} {
+			SimulateClick(item.ID())
+		}
+		sub.Handle(b, nil)
+		SimulateClick(b.ID())
+		mu.Lock()
+		defer mu.Unlock()
+		if want := []string{"a handler", "a callback", "b sub handler"}; !reflect.DeepEqual(got, want) {
+			t.Errorf("dispatched %v, want %v", got, want)
+		}
+	})
+}
+
+func TestClickMiddleware(t *testing.T) {
+	defer func() {
+		muClickMiddlewares.Lock()
+		clickMiddlewares = nil
+		muClickMiddlewares.Unlock()
+	}()
+	var mu sync.Mutex
+	var got []string
+	record := func(s string) {
+		mu.Lock()
+		got = append(got, s)
+		mu.Unlock()
+	}
+	runFake(t, func() {
+		before := NewMenuItem("Before", WithOnClickedFunc(func() { record("before clicked") }))
+		UseClickMiddleware(func(next func(), item *MenuItem) {
+			record("first " + item.loadTitle())
+			next()
+			record("first done")
+		})
+		UseClickMiddleware(func(next func(), item *MenuItem) {
+			record("second " + item.loadTitle())
+			if item.loadTitle() != "Dropped" {
+				next()
+			}
+		})
+		item := NewMenuItem("Item", WithOnClickedFunc(func() { record("item clicked") }))
+		dropped := NewMenuItem("Dropped", WithOnClickedFunc(func() { record("dropped clicked") }))
+		SimulateClick(item.ID())
+		SimulateClick(dropped.ID())
+		SimulateClick(before.ID())
+	})
+	want := []string{
+		"first Item", "second Item", "item clicked", "first done",
+		"first Dropped", "second Dropped", "first done",
+		"before clicked",
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("calls = %v, want %v", got, want)
+	}
+}
+
+func TestBuildMenuFromStruct(t *testing.T) {
+	runFake(t, func() {
+		for _, tt := range []struct {
+			name string
+			v    interface{}
+			err  string
+		}{
+			{"not a pointer", struct{ Quit func() }{}, "needs a pointer to a struct"},
+			{"nil pointer", (*struct{ Quit func() })(nil), "needs a pointer to a struct"},
+			{"pointer to a non struct", new(int), "needs a pointer to a struct"},
+			{"unknown key", &struct {
+				Quit func() `systray:"title=Quit,icon=quit.png"`
+			}{}, `field Quit: unknown tag key "icon"`},
+			{"value for disabled", &struct {
+				Quit func() `systray:"disabled=false"`
+			}{}, `field Quit: unexpected value for disabled: "false"`},
+			{"in a sub menu", &struct {
+				Open     func()
+				Settings struct {
+					Sync func() `systray:"bold"`
+				}
+			}{}, `field Sync: unknown tag key "bold"`},
+		} {
+			err := BuildMenuFromStruct(tt.v)
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("%s: error = %v, want one containing %q", tt.name, err, tt.err)
+			}
+		}
+		if got := SnapshotMenu(); len(got) != 0 {
+			t.Errorf("menu after invalid structs = %+v, want empty", got)
+		}
+
+		var menu struct {
+			Open     func() `systray:"title=Open,tooltip=Open the app"`
+			_        Separator
+			Status   *MenuItem `systray:"title=Connected,disabled"`
+			Settings struct {
+				Sync func()
+			} `systray:"title=Settings"`
+			ignored func()
+			Count   int
+		}
+		if err := BuildMenuFromStruct(&menu); err != nil {
+			t.Error(err)
+			return
+		}
+		var got []string
+		for _, s := range SnapshotMenu() {
+			got = append(got, fmt.Sprintf("%d %q %q disabled %v separator %v", s.ParentID, s.Title, s.Tooltip, s.Disabled, s.IsSeparator))
+		}
+		settings := menu.Status.ID() + 1
+		want := []string{
+			`0 "Open" "Open the app" disabled false separator false`,
+			`0 "" "" disabled false separator true`,
+			`0 "Connected" "" disabled true separator false`,
+			`0 "Settings" "" disabled false separator false`,
+			fmt.Sprintf(`%d "Sync" "" disabled false separator false`, settings),
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("menu = %q, want %q", got, want)
+		}
+	})
+}
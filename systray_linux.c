@@ -1,20 +1,87 @@
+//go:build !systray_fake
+
 #include <errno.h>
 #include <limits.h>
 #include <stdlib.h>
 #include <string.h>
 
-#ifdef USE_LEGACY_APPINDICATOR
+#if defined(USE_DYNAMIC_APPINDICATOR)
+#include "appindicator_dynamic.h"
+#elif defined(USE_LEGACY_APPINDICATOR)
 #include <libappindicator/app-indicator.h>
 #else
 #include <libayatana-appindicator/app-indicator.h>
 #endif
 
+#include <gdk/gdkx.h>
+
 #include "systray.h"
 
 static AppIndicator *global_app_indicator;
 static GtkWidget *global_tray_menu = NULL;
 static GList *global_menu_items = NULL;
 static char temp_file_name[PATH_MAX] = "";
+static char notification_icon_file_name[PATH_MAX] = "";
+static GDBusConnection *notification_connection = NULL;
+static guint32 last_notification_id = 0;
+static GList *global_hotkeys = NULL;
+// the icon set by setIcon, shown with the badge if badge_text is not empty
+static GBytes *current_icon = NULL;
+static char *badge_text = NULL;
+// is the icon shown faded, to blink it while the attention mode is on
+static gboolean icon_dimmed = FALSE;
+static gboolean hotkey_filter_added = FALSE;
+// hotkeys have to be grabbed with the lock modifiers as well, otherwise they
+// don't work while Caps Lock or Num Lock is on
+static const unsigned int lock_masks[] = {0, LockMask, Mod2Mask,
+                                          LockMask | Mod2Mask};
+
+typedef struct {
+    char *title;
+    char *body;
+    GBytes *icon;
+    int iconType;
+    int timeout;
+} NotificationInfo;
+
+typedef struct {
+    int menu_id;
+    GBytes *icon;
+    // declared size of the icon, 0 if not declared
+    int width;
+    int height;
+} MenuItemIconInfo;
+
+typedef struct {
+    int parent_menu_id;
+    int *menu_ids;
+    int count;
+} MenuOrderInfo;
+
+typedef struct {
+    int hotkey_id;
+    KeyCode keycode;
+    unsigned int modifiers;
+} HotkeyNode;
+
+typedef struct {
+    int hotkey_id;
+    unsigned int modifiers;
+    unsigned int keysym;
+    gboolean result;
+    gboolean done;
+    GMutex mutex;
+    GCond cond;
+} HotkeyRequest;
+
+#ifdef SYSTRAY_A11Y
+typedef struct {
+    GString *children;
+    gboolean done;
+    GMutex mutex;
+    GCond cond;
+} AccessibleChildrenRequest;
+#endif
 
 typedef struct {
     GtkWidget *menu_item;
@@ -25,21 +92,80 @@ typedef struct {
 typedef struct {
     int menu_id;
     int parent_menu_id;
+    int position;
     char *title;
     char *tooltip;
+    char *description;
+    char *accelerator;
     short disabled;
     short checked;
     short isCheckable;
+    short isRadio;
+    short isHeader;
+    short hidden;
 } MenuItemInfo;
 
-void registerSystray(void) {
-    gtk_init(0, NULL);
+// the main menu is reported as menu 0
+static void _main_menu_opened(gpointer unused) { systray_menu_opened(0); }
+
+static void _main_menu_closed(gpointer unused) { systray_menu_closed(0); }
+
+// menus move through their items with the arrow keys, and with Tab and
+// Shift-Tab as well, like dialogs, when GTK shows them rather than the host
+// of the indicator, e.g. with the GtkStatusIcon fallback
+static void _bind_tab_keys(void) {
+    GtkBindingSet *binding_set =
+        gtk_binding_set_by_class(g_type_class_ref(GTK_TYPE_MENU));
+    gtk_binding_entry_add_signal(binding_set, GDK_KEY_Tab, 0, "move-current",
+                                 1, GTK_TYPE_MENU_DIRECTION_TYPE,
+                                 GTK_MENU_DIR_NEXT);
+    gtk_binding_entry_add_signal(binding_set, GDK_KEY_KP_Tab, 0,
+                                 "move-current", 1,
+                                 GTK_TYPE_MENU_DIRECTION_TYPE,
+                                 GTK_MENU_DIR_NEXT);
+    gtk_binding_entry_add_signal(binding_set, GDK_KEY_ISO_Left_Tab,
+                                 GDK_SHIFT_MASK, "move-current", 1,
+                                 GTK_TYPE_MENU_DIRECTION_TYPE,
+                                 GTK_MENU_DIR_PREV);
+}
+
+const char *registerSystray(void) {
+    // without DISPLAY, GTK must not try X11 through XWayland: the indicator
+    // only relies on D-Bus, and X11 is only used for hotkeys when available
+    if (getenv("DISPLAY") == NULL && getenv("WAYLAND_DISPLAY") != NULL &&
+        getenv("GDK_BACKEND") == NULL) {
+        gdk_set_allowed_backends("wayland");
+    }
+    if (!gtk_init_check(0, NULL)) {
+        return "initialize GTK, no display may be available";
+    }
+#ifdef USE_DYNAMIC_APPINDICATOR
+    load_app_indicator();
+#endif
+    // the Id of the StatusNotifierItem, which hosts such as KDE Plasma use to
+    // tell apps apart and remember their settings, so it must not be the same
+    // for all the apps using systray
+    const char *id = g_get_prgname();
+    if (id == NULL || strlen(id) == 0) {
+        id = "systray";
+    }
     global_app_indicator = app_indicator_new(
-        "systray", "", APP_INDICATOR_CATEGORY_APPLICATION_STATUS);
+        id, "", APP_INDICATOR_CATEGORY_APPLICATION_STATUS);
+    if (global_app_indicator == NULL) {
+        return "create the app indicator";
+    }
+    // hosts list the item by its Title until SetTooltip is called
+    app_indicator_set_title(global_app_indicator, id);
     app_indicator_set_status(global_app_indicator, APP_INDICATOR_STATUS_ACTIVE);
+    _bind_tab_keys();
     global_tray_menu = gtk_menu_new();
+    g_signal_connect_swapped(G_OBJECT(global_tray_menu), "map",
+                             G_CALLBACK(_main_menu_opened), NULL);
+    g_signal_connect_swapped(G_OBJECT(global_tray_menu), "unmap",
+                             G_CALLBACK(_main_menu_closed), NULL);
     app_indicator_set_menu(global_app_indicator, GTK_MENU(global_tray_menu));
     systray_ready();
+    return NULL;
 }
 
 int nativeLoop(void) {
@@ -48,34 +174,35 @@ int nativeLoop(void) {
     return 0;
 }
 
-void _unlink_temp_file() {
-    if (strlen(temp_file_name) != 0) {
-        int ret = unlink(temp_file_name);
+void _unlink_file(char *file_name) {
+    if (strlen(file_name) != 0) {
+        int ret = unlink(file_name);
         if (ret == -1) {
-            printf("failed to remove temp icon file %s: %s\n", temp_file_name,
+            printf("failed to remove temp icon file %s: %s\n", file_name,
                    strerror(errno));
         }
-        temp_file_name[0] = '\0';
+        file_name[0] = '\0';
     }
 }
 
-// runs in main thread, should always return FALSE to prevent gtk to execute it
-// again
-gboolean do_set_icon(gpointer data) {
-    _unlink_temp_file();
+void _unlink_temp_file() { _unlink_file(temp_file_name); }
+
+// writes bytes to a new temp file, whose path is stored in file_name which
+// should be PATH_MAX long
+gboolean _write_temp_file(GBytes *bytes, char *file_name) {
     char *tmpdir = getenv("TMPDIR");
     if (NULL == tmpdir) {
         tmpdir = "/tmp";
     }
-    strncpy(temp_file_name, tmpdir, PATH_MAX - 1);
-    strncat(temp_file_name, "/systray_XXXXXX", PATH_MAX - 1);
-    temp_file_name[PATH_MAX - 1] = '\0';
+    strncpy(file_name, tmpdir, PATH_MAX - 1);
+    strncat(file_name, "/systray_XXXXXX", PATH_MAX - 1);
+    file_name[PATH_MAX - 1] = '\0';
 
-    GBytes *bytes = (GBytes *)data;
-    int fd = mkstemp(temp_file_name);
+    int fd = mkstemp(file_name);
     if (fd == -1) {
-        printf("failed to create temp icon file %s: %s\n", temp_file_name,
+        printf("failed to create temp icon file %s: %s\n", file_name,
                strerror(errno));
+        file_name[0] = '\0';
         return FALSE;
     }
     gsize size = 0;
@@ -83,19 +210,176 @@ gboolean do_set_icon(gpointer data) {
     ssize_t written = write(fd, icon_data, size);
     close(fd);
     if (written != size) {
-        printf("failed to write temp icon file %s: %s\n", temp_file_name,
+        printf("failed to write temp icon file %s: %s\n", file_name,
                strerror(errno));
         return FALSE;
     }
-    app_indicator_set_icon_full(global_app_indicator, temp_file_name, "");
-    app_indicator_set_attention_icon_full(global_app_indicator, temp_file_name,
-                                          "");
+    return TRUE;
+}
+
+// returns the content of a png image of icon with text drawn in a red
+// circle over its top right corner, or NULL if icon can't be loaded
+GBytes *_draw_badge(GBytes *icon, const char *text) {
+    gsize size;
+    gconstpointer icon_data = g_bytes_get_data(icon, &size);
+    GdkPixbufLoader *loader = gdk_pixbuf_loader_new();
+    gboolean loaded = gdk_pixbuf_loader_write(loader, icon_data, size, NULL);
+    loaded = gdk_pixbuf_loader_close(loader, NULL) && loaded;
+    if (!loaded) {
+        g_object_unref(loader);
+        return NULL;
+    }
+    GdkPixbuf *pixbuf = gdk_pixbuf_loader_get_pixbuf(loader);
+    int width = gdk_pixbuf_get_width(pixbuf);
+    int height = gdk_pixbuf_get_height(pixbuf);
+    cairo_surface_t *surface =
+        cairo_image_surface_create(CAIRO_FORMAT_ARGB32, width, height);
+    cairo_t *cr = cairo_create(surface);
+    gdk_cairo_set_source_pixbuf(cr, pixbuf, 0, 0);
+    cairo_paint(cr);
+    g_object_unref(loader);
+
+    double radius = height * 0.3;
+    double center_x = width - radius, center_y = radius;
+    cairo_arc(cr, center_x, center_y, radius, 0, 2 * G_PI);
+    cairo_set_source_rgb(cr, 0.86, 0.15, 0.15);
+    cairo_fill(cr);
+    cairo_select_font_face(cr, "sans-serif", CAIRO_FONT_SLANT_NORMAL,
+                           CAIRO_FONT_WEIGHT_BOLD);
+    cairo_set_font_size(cr, radius * (strlen(text) > 1 ? 1.2 : 1.6));
+    cairo_text_extents_t extents;
+    cairo_text_extents(cr, text, &extents);
+    cairo_move_to(cr, center_x - extents.width / 2 - extents.x_bearing,
+                  center_y - extents.height / 2 - extents.y_bearing);
+    cairo_set_source_rgb(cr, 1, 1, 1);
+    cairo_show_text(cr, text);
+    cairo_destroy(cr);
+
+    GdkPixbuf *badged =
+        gdk_pixbuf_get_from_surface(surface, 0, 0, width, height);
+    cairo_surface_destroy(surface);
+    gchar *buffer;
+    gboolean saved =
+        gdk_pixbuf_save_to_buffer(badged, &buffer, &size, "png", NULL, NULL);
+    g_object_unref(badged);
+    if (!saved) {
+        return NULL;
+    }
+    return g_bytes_new_take(buffer, size);
+}
+
+// returns the content of a png image of icon, faded, or NULL if icon can't be
+// loaded
+GBytes *_draw_dimmed(GBytes *icon) {
+    gsize size;
+    gconstpointer icon_data = g_bytes_get_data(icon, &size);
+    GdkPixbufLoader *loader = gdk_pixbuf_loader_new();
+    gboolean loaded = gdk_pixbuf_loader_write(loader, icon_data, size, NULL);
+    loaded = gdk_pixbuf_loader_close(loader, NULL) && loaded;
+    if (!loaded) {
+        g_object_unref(loader);
+        return NULL;
+    }
+    GdkPixbuf *pixbuf = gdk_pixbuf_loader_get_pixbuf(loader);
+    int width = gdk_pixbuf_get_width(pixbuf);
+    int height = gdk_pixbuf_get_height(pixbuf);
+    cairo_surface_t *surface =
+        cairo_image_surface_create(CAIRO_FORMAT_ARGB32, width, height);
+    cairo_t *cr = cairo_create(surface);
+    gdk_cairo_set_source_pixbuf(cr, pixbuf, 0, 0);
+    cairo_paint_with_alpha(cr, 0.25);
+    cairo_destroy(cr);
+    g_object_unref(loader);
+
+    GdkPixbuf *dimmed =
+        gdk_pixbuf_get_from_surface(surface, 0, 0, width, height);
+    cairo_surface_destroy(surface);
+    gchar *buffer;
+    gboolean saved =
+        gdk_pixbuf_save_to_buffer(dimmed, &buffer, &size, "png", NULL, NULL);
+    g_object_unref(dimmed);
+    if (!saved) {
+        return NULL;
+    }
+    return g_bytes_new_take(buffer, size);
+}
+
+// runs in main thread
+void _show_icon() {
+    if (current_icon == NULL) {
+        return;
+    }
+    GBytes *bytes = NULL;
+    if (badge_text != NULL && strlen(badge_text) > 0) {
+        bytes = _draw_badge(current_icon, badge_text);
+    }
+    if (bytes == NULL) {
+        bytes = g_bytes_ref(current_icon);
+    }
+    if (icon_dimmed) {
+        GBytes *dimmed = _draw_dimmed(bytes);
+        if (dimmed != NULL) {
+            g_bytes_unref(bytes);
+            bytes = dimmed;
+        }
+    }
+    _unlink_temp_file();
+    if (_write_temp_file(bytes, temp_file_name)) {
+        app_indicator_set_icon_full(global_app_indicator, temp_file_name, "");
+        app_indicator_set_attention_icon_full(global_app_indicator,
+                                              temp_file_name, "");
+    }
     g_bytes_unref(bytes);
+}
+
+// runs in main thread, should always return FALSE to prevent gtk to execute it
+// again
+gboolean do_set_icon(gpointer data) {
+    if (current_icon != NULL) {
+        g_bytes_unref(current_icon);
+    }
+    current_icon = (GBytes *)data;
+    _show_icon();
+    return FALSE;
+}
+
+// runs in main thread, should always return FALSE to prevent gtk to execute it
+// again
+gboolean do_set_icon_badge(gpointer data) {
+    free(badge_text);
+    badge_text = (char *)data;
+    _show_icon();
+    return FALSE;
+}
+
+// runs in main thread, should always return FALSE to prevent gtk to execute it
+// again
+gboolean do_set_icon_dimmed(gpointer data) {
+    icon_dimmed = GPOINTER_TO_INT(data);
+    _show_icon();
+    return FALSE;
+}
+
+// runs in main thread, should always return FALSE to prevent gtk to execute it
+// again
+gboolean do_set_clipboard_text(gpointer data) {
+    char *text = (char *)data;
+    GtkClipboard *clipboard = gtk_clipboard_get(GDK_SELECTION_CLIPBOARD);
+    gtk_clipboard_set_text(clipboard, text, -1);
+    // keep the text available after the process exits, where supported
+    gtk_clipboard_store(clipboard);
+    free(text);
     return FALSE;
 }
 
 void _systray_menu_item_selected(int *id) { systray_menu_item_selected(*id); }
 
+void _systray_menu_opened(int *id) { systray_menu_opened(*id); }
+
+void _systray_menu_closed(int *id) { systray_menu_closed(*id); }
+
+void _systray_menu_item_hovered(int *id) { systray_menu_item_hovered(*id); }
+
 GtkMenuItem *find_menu_by_id(int id) {
     GList *it;
     for (it = global_menu_items; it != NULL; it = it->next) {
@@ -107,6 +391,46 @@ GtkMenuItem *find_menu_by_id(int id) {
     return NULL;
 }
 
+// returns the menu with the given parent, the main menu if parent_id is 0,
+// creating the sub menu of the parent if it doesn't have one yet
+GtkWidget *_menu_of(int parent_id) {
+    if (parent_id == 0) {
+        return global_tray_menu;
+    }
+    GtkMenuItem *parentMenuItem = find_menu_by_id(parent_id);
+    GtkWidget *parentMenu = gtk_menu_item_get_submenu(parentMenuItem);
+    if (parentMenu == NULL) {
+        parentMenu = gtk_menu_new();
+        gtk_menu_item_set_submenu(parentMenuItem, parentMenu);
+        int *id = malloc(sizeof(int));
+        *id = parent_id;
+        g_signal_connect_swapped(G_OBJECT(parentMenu), "map",
+                                 G_CALLBACK(_systray_menu_opened), id);
+        g_signal_connect_swapped(G_OBJECT(parentMenu), "unmap",
+                                 G_CALLBACK(_systray_menu_closed), id);
+    }
+    return parentMenu;
+}
+
+// keeps track of a menu item or separator, returning its node in
+// global_menu_items
+GList *_add_menu_item_node(int menu_id, GtkWidget *menu_item,
+                           long signalHandlerId) {
+    MenuItemNode *new_item = malloc(sizeof(MenuItemNode));
+    new_item->menu_id = menu_id;
+    new_item->signalHandlerId = signalHandlerId;
+    new_item->menu_item = menu_item;
+    GList *new_node = malloc(sizeof(GList));
+    new_node->data = new_item;
+    new_node->prev = NULL;
+    new_node->next = global_menu_items;
+    if (global_menu_items != NULL) {
+        global_menu_items->prev = new_node;
+    }
+    global_menu_items = new_node;
+    return new_node;
+}
+
 // runs in main thread, should always return FALSE to prevent gtk to execute it
 // again
 gboolean do_add_or_update_menu_item(gpointer data) {
@@ -140,56 +464,150 @@ gboolean do_add_or_update_menu_item(gpointer data) {
             menu_item = gtk_check_menu_item_new_with_label(mii->title);
             gtk_check_menu_item_set_active(GTK_CHECK_MENU_ITEM(menu_item),
                                            mii->checked == 1);
+            gtk_check_menu_item_set_draw_as_radio(
+                GTK_CHECK_MENU_ITEM(menu_item), mii->isRadio == 1);
         } else {
-            menu_item = gtk_menu_item_new_with_label(mii->title);
+            // GtkImageMenuItem is deprecated, but it's the only menu item with
+            // an icon that the indicator exports
+            G_GNUC_BEGIN_IGNORE_DEPRECATIONS
+            menu_item = gtk_image_menu_item_new_with_label(mii->title);
+            G_GNUC_END_IGNORE_DEPRECATIONS
         }
         int *id = malloc(sizeof(int));
         *id = mii->menu_id;
         long signalHandlerId = g_signal_connect_swapped(
             G_OBJECT(menu_item), "activate",
             G_CALLBACK(_systray_menu_item_selected), id);
+        // only emitted when GTK renders the menu itself
+        g_signal_connect_swapped(G_OBJECT(menu_item), "select",
+                                 G_CALLBACK(_systray_menu_item_hovered), id);
 
-        if (mii->parent_menu_id == 0) {
-            gtk_menu_shell_append(GTK_MENU_SHELL(global_tray_menu), menu_item);
-        } else {
-            GtkMenuItem *parentMenuItem = find_menu_by_id(mii->parent_menu_id);
-            GtkWidget *parentMenu = gtk_menu_item_get_submenu(parentMenuItem);
-
-            if (parentMenu == NULL) {
-                parentMenu = gtk_menu_new();
-                gtk_menu_item_set_submenu(parentMenuItem, parentMenu);
-            }
-
-            gtk_menu_shell_append(GTK_MENU_SHELL(parentMenu), menu_item);
-        }
+        gtk_menu_shell_insert(GTK_MENU_SHELL(_menu_of(mii->parent_menu_id)),
+                              menu_item, mii->position);
 
-        MenuItemNode *new_item = malloc(sizeof(MenuItemNode));
-        new_item->menu_id = mii->menu_id;
-        new_item->signalHandlerId = signalHandlerId;
-        new_item->menu_item = menu_item;
-        GList *new_node = malloc(sizeof(GList));
-        new_node->data = new_item;
-        new_node->next = global_menu_items;
-        if (global_menu_items != NULL) {
-            global_menu_items->prev = new_node;
-        }
-        global_menu_items = new_node;
-        it = new_node;
+        it = _add_menu_item_node(mii->menu_id, menu_item, signalHandlerId);
     }
     GtkWidget *menu_item = GTK_WIDGET(((MenuItemNode *)(it->data))->menu_item);
+    // the title has the accelerator marked with an underscore
+    gtk_menu_item_set_use_underline(GTK_MENU_ITEM(menu_item),
+                                    strlen(mii->accelerator) > 0);
     gtk_widget_set_sensitive(menu_item, mii->disabled != 1);
-    gtk_widget_show(menu_item);
+    // the accessible-description property, announced through AT-SPI
+    atk_object_set_description(gtk_widget_get_accessible(menu_item),
+                               mii->description);
+    GtkWidget *label = gtk_bin_get_child(GTK_BIN(menu_item));
+    if (mii->isHeader == 1 && GTK_IS_LABEL(label)) {
+        gchar *markup = g_markup_printf_escaped("<b>%s</b>", mii->title);
+        gtk_label_set_markup(GTK_LABEL(label), markup);
+        g_free(markup);
+    } else if (mii->disabled == 2 && GTK_IS_LABEL(label)) {
+        // soft disabled menu items stay sensitive to get their clicks, so
+        // their label is grayed out instead
+        gchar *markup = g_markup_printf_escaped(
+            "<span alpha=\"50%%\">%s</span>", mii->title);
+        if (strlen(mii->accelerator) > 0) {
+            gtk_label_set_markup_with_mnemonic(GTK_LABEL(label), markup);
+        } else {
+            gtk_label_set_markup(GTK_LABEL(label), markup);
+        }
+        g_free(markup);
+    } else if (GTK_IS_LABEL(label)) {
+        // back to the plain title once enabled again
+        gtk_label_set_use_markup(GTK_LABEL(label), FALSE);
+    }
+    // menu items are created hidden, and updating a hidden one mustn't show
+    // it, see show_menu_item
+    if (mii->hidden != 1) {
+        gtk_widget_show(menu_item);
+    }
 
     free(mii->title);
     free(mii->tooltip);
+    free(mii->description);
+    free(mii->accelerator);
     free(mii);
     return FALSE;
 }
 
+// runs in main thread, should always return FALSE to prevent gtk to execute it
+// again
+gboolean do_set_menu_item_icon(gpointer data) {
+    MenuItemIconInfo *info = (MenuItemIconInfo *)data;
+    GtkMenuItem *menu_item = find_menu_by_id(info->menu_id);
+    G_GNUC_BEGIN_IGNORE_DEPRECATIONS
+    if (menu_item != NULL && GTK_IS_IMAGE_MENU_ITEM(menu_item)) {
+        gsize size;
+        gconstpointer icon_data = g_bytes_get_data(info->icon, &size);
+        GdkPixbufLoader *loader = gdk_pixbuf_loader_new();
+        gboolean loaded =
+            gdk_pixbuf_loader_write(loader, icon_data, size, NULL);
+        loaded = gdk_pixbuf_loader_close(loader, NULL) && loaded;
+        if (loaded) {
+            int width = info->width, height = info->height;
+            if (width <= 0 || height <= 0) {
+                gtk_icon_size_lookup(GTK_ICON_SIZE_MENU, &width, &height);
+            }
+            GdkPixbuf *pixbuf = gdk_pixbuf_loader_get_pixbuf(loader);
+            if (gdk_pixbuf_get_width(pixbuf) == width &&
+                gdk_pixbuf_get_height(pixbuf) == height) {
+                // already the right size, don't blur it by scaling
+                g_object_ref(pixbuf);
+            } else {
+                pixbuf = gdk_pixbuf_scale_simple(pixbuf, width, height,
+                                                 GDK_INTERP_BILINEAR);
+            }
+            GtkWidget *image = gtk_image_new_from_pixbuf(pixbuf);
+            g_object_unref(pixbuf);
+            gtk_image_menu_item_set_image(GTK_IMAGE_MENU_ITEM(menu_item),
+                                          image);
+            gtk_image_menu_item_set_always_show_image(
+                GTK_IMAGE_MENU_ITEM(menu_item), TRUE);
+        } else {
+            printf("failed to load icon of menu item %d\n", info->menu_id);
+        }
+        g_object_unref(loader);
+    }
+    G_GNUC_END_IGNORE_DEPRECATIONS
+    g_bytes_unref(info->icon);
+    free(info);
+    return FALSE;
+}
+
 gboolean do_add_separator(gpointer data) {
+    MenuItemInfo *mii = (MenuItemInfo *)data;
     GtkWidget *separator = gtk_separator_menu_item_new();
-    gtk_menu_shell_append(GTK_MENU_SHELL(global_tray_menu), separator);
+    gtk_menu_shell_append(GTK_MENU_SHELL(_menu_of(mii->parent_menu_id)),
+                          separator);
     gtk_widget_show(separator);
+    // tracked like menu items, to be able to move it
+    _add_menu_item_node(mii->menu_id, separator, 0);
+    free(mii);
+    return FALSE;
+}
+
+// runs in main thread, should always return FALSE to prevent gtk to execute it
+// again
+gboolean do_reorder_menu_items(gpointer data) {
+    MenuOrderInfo *moi = (MenuOrderInfo *)data;
+    GtkWidget *menu = global_tray_menu;
+    if (moi->parent_menu_id != 0) {
+        GtkMenuItem *parentMenuItem = find_menu_by_id(moi->parent_menu_id);
+        menu = parentMenuItem == NULL
+                   ? NULL
+                   : gtk_menu_item_get_submenu(parentMenuItem);
+    }
+    if (menu != NULL) {
+        int i;
+        for (i = 0; i < moi->count; i++) {
+            GtkMenuItem *menu_item = find_menu_by_id(moi->menu_ids[i]);
+            if (menu_item != NULL) {
+                gtk_menu_reorder_child(GTK_MENU(menu), GTK_WIDGET(menu_item),
+                                       i);
+            }
+        }
+    }
+    free(moi->menu_ids);
+    free(moi);
     return FALSE;
 }
 
@@ -223,10 +641,265 @@ gboolean do_show_menu_item(gpointer data) {
     return FALSE;
 }
 
+// runs in main thread, should always return FALSE to prevent gtk to execute it
+// again
+gboolean do_remove_menu_item(gpointer data) {
+    MenuItemInfo *mii = (MenuItemInfo *)data;
+    GList *it;
+    for (it = global_menu_items; it != NULL; it = it->next) {
+        MenuItemNode *item = (MenuItemNode *)(it->data);
+        if (item->menu_id == mii->menu_id) {
+            gtk_widget_destroy(GTK_WIDGET(item->menu_item));
+            if (it->prev != NULL) {
+                it->prev->next = it->next;
+            } else {
+                global_menu_items = it->next;
+            }
+            if (it->next != NULL) {
+                it->next->prev = it->prev;
+            }
+            free(item);
+            free(it);
+            break;
+        }
+    }
+    free(mii);
+    return FALSE;
+}
+
+void _notification_action_invoked(GDBusConnection *connection,
+                                  const gchar *sender_name,
+                                  const gchar *object_path,
+                                  const gchar *interface_name,
+                                  const gchar *signal_name,
+                                  GVariant *parameters, gpointer user_data) {
+    guint32 id;
+    const gchar *action_key;
+    g_variant_get(parameters, "(u&s)", &id, &action_key);
+    if (id == last_notification_id) {
+        systray_notification_clicked();
+    }
+}
+
+void _notification_sent(GObject *source, GAsyncResult *res, gpointer data) {
+    GError *error = NULL;
+    GVariant *ret = g_dbus_connection_call_finish(G_DBUS_CONNECTION(source),
+                                                  res, &error);
+    if (ret == NULL) {
+        printf("failed to show notification: %s\n", error->message);
+        g_error_free(error);
+        return;
+    }
+    g_variant_get(ret, "(u)", &last_notification_id);
+    g_variant_unref(ret);
+}
+
+// runs in main thread, should always return FALSE to prevent gtk to execute it
+// again
+gboolean do_show_notification(gpointer data) {
+    NotificationInfo *ni = (NotificationInfo *)data;
+    GError *error = NULL;
+    if (notification_connection == NULL) {
+        notification_connection =
+            g_bus_get_sync(G_BUS_TYPE_SESSION, NULL, &error);
+        if (notification_connection == NULL) {
+            printf("failed to connect to session bus: %s\n", error->message);
+            g_error_free(error);
+            goto out;
+        }
+        g_dbus_connection_signal_subscribe(
+            notification_connection, "org.freedesktop.Notifications",
+            "org.freedesktop.Notifications", "ActionInvoked",
+            "/org/freedesktop/Notifications", NULL, G_DBUS_SIGNAL_FLAGS_NONE,
+            _notification_action_invoked, NULL, NULL);
+    }
+
+    const char *app_icon = "";
+    switch (ni->iconType) {
+    case 1:
+        app_icon = "dialog-information";
+        break;
+    case 2:
+        app_icon = "dialog-warning";
+        break;
+    case 3:
+        app_icon = "dialog-error";
+        break;
+    }
+    _unlink_file(notification_icon_file_name);
+    if (ni->icon != NULL &&
+        _write_temp_file(ni->icon, notification_icon_file_name)) {
+        app_icon = notification_icon_file_name;
+    }
+
+    GVariantBuilder actions;
+    g_variant_builder_init(&actions, G_VARIANT_TYPE("as"));
+    // the default action is invoked when the notification is clicked
+    g_variant_builder_add(&actions, "s", "default");
+    g_variant_builder_add(&actions, "s", "");
+    GVariantBuilder hints;
+    g_variant_builder_init(&hints, G_VARIANT_TYPE("a{sv}"));
+    // critical urgency for errors, normal otherwise
+    g_variant_builder_add(&hints, "{sv}", "urgency",
+                          g_variant_new_byte(ni->iconType == 3 ? 2 : 1));
+
+    g_dbus_connection_call(
+        notification_connection, "org.freedesktop.Notifications",
+        "/org/freedesktop/Notifications", "org.freedesktop.Notifications",
+        "Notify",
+        g_variant_new("(susssasa{sv}i)", "systray", 0, app_icon, ni->title,
+                      ni->body, &actions, &hints, ni->timeout),
+        G_VARIANT_TYPE("(u)"), G_DBUS_CALL_FLAGS_NONE, -1, NULL,
+        _notification_sent, NULL);
+
+out:
+    if (ni->icon != NULL) {
+        g_bytes_unref(ni->icon);
+    }
+    free(ni->title);
+    free(ni->body);
+    free(ni);
+    return FALSE;
+}
+
+GdkFilterReturn _hotkey_filter(GdkXEvent *gdk_xevent, GdkEvent *event,
+                               gpointer data) {
+    XEvent *xevent = (XEvent *)gdk_xevent;
+    if (xevent->type != KeyPress) {
+        return GDK_FILTER_CONTINUE;
+    }
+    unsigned int modifiers = xevent->xkey.state & ~(LockMask | Mod2Mask);
+    GList *it;
+    for (it = global_hotkeys; it != NULL; it = it->next) {
+        HotkeyNode *hotkey = (HotkeyNode *)(it->data);
+        if (hotkey->keycode == xevent->xkey.keycode &&
+            hotkey->modifiers == modifiers) {
+            systray_hotkey_pressed(hotkey->hotkey_id);
+            return GDK_FILTER_REMOVE;
+        }
+    }
+    return GDK_FILTER_CONTINUE;
+}
+
+void _theme_changed(GtkSettings *settings) {
+    gboolean prefer_dark = FALSE;
+    gchar *theme_name = NULL;
+    g_object_get(settings, "gtk-application-prefer-dark-theme", &prefer_dark,
+                 "gtk-theme-name", &theme_name, NULL);
+    // most dark themes are only told by their name, e.g. Adwaita-dark
+    gboolean dark = prefer_dark;
+    if (theme_name != NULL) {
+        gchar *lower_name = g_ascii_strdown(theme_name, -1);
+        dark = dark || g_str_has_suffix(lower_name, "-dark") ||
+               g_str_has_suffix(lower_name, "_dark");
+        g_free(lower_name);
+        g_free(theme_name);
+    }
+    systray_theme_changed(dark);
+}
+
+// runs in main thread, should always return FALSE to prevent gtk to execute it
+// again
+gboolean do_watch_theme(gpointer data) {
+    GtkSettings *settings = gtk_settings_get_default();
+    if (settings == NULL) {
+        return FALSE;
+    }
+    g_signal_connect_swapped(settings,
+                             "notify::gtk-application-prefer-dark-theme",
+                             G_CALLBACK(_theme_changed), settings);
+    g_signal_connect_swapped(settings, "notify::gtk-theme-name",
+                             G_CALLBACK(_theme_changed), settings);
+    _theme_changed(settings);
+    return FALSE;
+}
+
+void _ungrab_hotkey(Display *xdisplay, KeyCode keycode,
+                    unsigned int modifiers) {
+    Window root = DefaultRootWindow(xdisplay);
+    int i;
+    for (i = 0; i < G_N_ELEMENTS(lock_masks); i++) {
+        XUngrabKey(xdisplay, keycode, modifiers | lock_masks[i], root);
+    }
+}
+
+// runs in main thread
+void _unregister_hotkey(int hotkey_id) {
+    GList *it;
+    for (it = global_hotkeys; it != NULL; it = it->next) {
+        HotkeyNode *hotkey = (HotkeyNode *)(it->data);
+        if (hotkey->hotkey_id == hotkey_id) {
+            _ungrab_hotkey(GDK_DISPLAY_XDISPLAY(gdk_display_get_default()),
+                           hotkey->keycode, hotkey->modifiers);
+            global_hotkeys = g_list_delete_link(global_hotkeys, it);
+            free(hotkey);
+            break;
+        }
+    }
+}
+
+// runs in main thread, should always return FALSE to prevent gtk to execute it
+// again
+gboolean do_register_hotkey(gpointer data) {
+    HotkeyRequest *req = (HotkeyRequest *)data;
+    gboolean result = FALSE;
+    GdkDisplay *display = gdk_display_get_default();
+    // global hotkeys are only available on X11
+    if (display != NULL && GDK_IS_X11_DISPLAY(display)) {
+        _unregister_hotkey(req->hotkey_id);
+        Display *xdisplay = GDK_DISPLAY_XDISPLAY(display);
+        KeyCode keycode = XKeysymToKeycode(xdisplay, req->keysym);
+        if (keycode != 0) {
+            Window root = DefaultRootWindow(xdisplay);
+            int i;
+            gdk_x11_display_error_trap_push(display);
+            for (i = 0; i < G_N_ELEMENTS(lock_masks); i++) {
+                XGrabKey(xdisplay, keycode, req->modifiers | lock_masks[i],
+                         root, False, GrabModeAsync, GrabModeAsync);
+            }
+            if (gdk_x11_display_error_trap_pop(display) == 0) {
+                if (!hotkey_filter_added) {
+                    gdk_window_add_filter(gdk_get_default_root_window(),
+                                          _hotkey_filter, NULL);
+                    hotkey_filter_added = TRUE;
+                }
+                HotkeyNode *hotkey = malloc(sizeof(HotkeyNode));
+                hotkey->hotkey_id = req->hotkey_id;
+                hotkey->keycode = keycode;
+                hotkey->modifiers = req->modifiers;
+                global_hotkeys = g_list_prepend(global_hotkeys, hotkey);
+                result = TRUE;
+            } else {
+                // most likely grabbed by another application already
+                gdk_x11_display_error_trap_push(display);
+                _ungrab_hotkey(xdisplay, keycode, req->modifiers);
+                gdk_x11_display_error_trap_pop_ignored(display);
+            }
+        }
+    }
+
+    g_mutex_lock(&req->mutex);
+    req->result = result;
+    req->done = TRUE;
+    g_cond_signal(&req->cond);
+    g_mutex_unlock(&req->mutex);
+    return FALSE;
+}
+
+// runs in main thread, should always return FALSE to prevent gtk to execute it
+// again
+gboolean do_unregister_hotkey(gpointer data) {
+    int *hotkey_id = (int *)data;
+    _unregister_hotkey(*hotkey_id);
+    free(hotkey_id);
+    return FALSE;
+}
+
 // runs in main thread, should always return FALSE to prevent gtk to execute it
 // again
 gboolean do_quit(gpointer data) {
     _unlink_temp_file();
+    _unlink_file(notification_icon_file_name);
     // app indicator doesn't provide a way to remove it, hide it as a workaround
     app_indicator_set_status(global_app_indicator,
                              APP_INDICATOR_STATUS_PASSIVE);
@@ -234,42 +907,99 @@ gboolean do_quit(gpointer data) {
     return FALSE;
 }
 
-void setIcon(const char *iconBytes, int length, bool template) {
-    GBytes *bytes = g_bytes_new_static(iconBytes, length);
+bool setIcon(const char *iconBytes, int length, bool template, int width,
+             int height) {
+    // indicator hosts scale the icon themselves
+    // copy the bytes as the Go memory is not guaranteed to outlive this call
+    GBytes *bytes = g_bytes_new(iconBytes, length);
     g_idle_add(do_set_icon, bytes);
+    return true;
+}
+
+void setIconBadge(char *ctext) { g_idle_add(do_set_icon_badge, ctext); }
+
+void set_icon_dimmed(bool dimmed) {
+    g_idle_add(do_set_icon_dimmed, GINT_TO_POINTER(dimmed));
+}
+
+// runs in main thread, should always return FALSE to prevent gtk to execute it
+// again
+gboolean do_request_user_attention(gpointer data) {
+    // emits NewStatus, hosts such as KDE Plasma then show the
+    // AttentionIconName, which blinks along with the icon
+    app_indicator_set_status(global_app_indicator,
+                             GPOINTER_TO_INT(data)
+                                 ? APP_INDICATOR_STATUS_ATTENTION
+                                 : APP_INDICATOR_STATUS_ACTIVE);
+    return FALSE;
 }
 
-void setTitle(char *ctitle) {
-    app_indicator_set_title(global_app_indicator, ctitle);
-    app_indicator_set_label(global_app_indicator, ctitle, "");
-    free(ctitle);
+void request_user_attention(bool enabled) {
+    g_idle_add(do_request_user_attention, GINT_TO_POINTER(enabled));
 }
 
-void setTooltip(char *ctooltip) { free(ctooltip); }
+void *native_handle(void) { return global_app_indicator; }
+
+bool set_clipboard_text(char *ctext) {
+    g_idle_add(do_set_clipboard_text, ctext);
+    return true;
+}
+
+void setTooltip(char *ctooltip) {
+    // StatusNotifierItem hosts show the title on hover
+    app_indicator_set_title(global_app_indicator, ctooltip);
+    free(ctooltip);
+}
 
 void setMenuItemIcon(const char *iconBytes, int length, int menuId,
-                     bool template) {}
+                     bool template, int width, int height) {
+    MenuItemIconInfo *info = malloc(sizeof(MenuItemIconInfo));
+    info->menu_id = menuId;
+    info->icon = g_bytes_new(iconBytes, length);
+    info->width = width;
+    info->height = height;
+    g_idle_add(do_set_menu_item_icon, info);
+}
 
-void add_or_update_menu_item(int menu_id, int parent_menu_id, char *title,
-                             char *tooltip, short disabled, short checked,
-                             short isCheckable) {
+void add_or_update_menu_item(int menu_id, int parent_menu_id, int position,
+                             char *title, char *tooltip, char *description,
+                             char *accelerator, short disabled, short checked,
+                             short isCheckable, short isRadio, short isHeader,
+                             short hidden) {
     MenuItemInfo *mii = malloc(sizeof(MenuItemInfo));
     mii->menu_id = menu_id;
     mii->parent_menu_id = parent_menu_id;
+    mii->position = position;
     mii->title = title;
     mii->tooltip = tooltip;
+    mii->description = description;
+    mii->accelerator = accelerator;
     mii->disabled = disabled;
     mii->checked = checked;
     mii->isCheckable = isCheckable;
+    mii->isRadio = isRadio;
+    mii->isHeader = isHeader;
+    mii->hidden = hidden;
     g_idle_add(do_add_or_update_menu_item, mii);
 }
 
-void add_separator(int menu_id) {
+void add_separator(int menu_id, int parent_menu_id) {
     MenuItemInfo *mii = malloc(sizeof(MenuItemInfo));
     mii->menu_id = menu_id;
+    mii->parent_menu_id = parent_menu_id;
     g_idle_add(do_add_separator, mii);
 }
 
+void reorder_menu_items(int parent_menu_id, int *menu_ids, int count) {
+    MenuOrderInfo *moi = malloc(sizeof(MenuOrderInfo));
+    moi->parent_menu_id = parent_menu_id;
+    // copy the IDs as the Go memory is not guaranteed to outlive this call
+    moi->menu_ids = malloc(count * sizeof(int));
+    memcpy(moi->menu_ids, menu_ids, count * sizeof(int));
+    moi->count = count;
+    g_idle_add(do_reorder_menu_items, moi);
+}
+
 void hide_menu_item(int menu_id) {
     MenuItemInfo *mii = malloc(sizeof(MenuItemInfo));
     mii->menu_id = menu_id;
@@ -282,4 +1012,106 @@ void show_menu_item(int menu_id) {
     g_idle_add(do_show_menu_item, mii);
 }
 
+void remove_menu_item(int menu_id) {
+    MenuItemInfo *mii = malloc(sizeof(MenuItemInfo));
+    mii->menu_id = menu_id;
+    g_idle_add(do_remove_menu_item, mii);
+}
+
+void showNotification(char *title, char *body, const char *iconBytes,
+                      int iconLength, int iconType, int timeout) {
+    NotificationInfo *ni = malloc(sizeof(NotificationInfo));
+    ni->title = title;
+    ni->body = body;
+    ni->icon = NULL;
+    if (iconLength > 0) {
+        ni->icon = g_bytes_new(iconBytes, iconLength);
+    }
+    ni->iconType = iconType;
+    // -1 lets the notification server decide
+    ni->timeout = timeout > 0 ? timeout : -1;
+    g_idle_add(do_show_notification, ni);
+}
+
+void watch_theme() { g_idle_add(do_watch_theme, NULL); }
+
+bool register_hotkey(int hotkey_id, unsigned int modifiers, unsigned int key) {
+    HotkeyRequest req;
+    req.hotkey_id = hotkey_id;
+    req.modifiers = modifiers;
+    req.keysym = key;
+    req.result = FALSE;
+    req.done = FALSE;
+    g_mutex_init(&req.mutex);
+    g_cond_init(&req.cond);
+    // wait for the result, unless already in main thread
+    if (g_main_context_is_owner(g_main_context_default())) {
+        do_register_hotkey(&req);
+    } else {
+        g_idle_add(do_register_hotkey, &req);
+        g_mutex_lock(&req.mutex);
+        while (!req.done) {
+            g_cond_wait(&req.cond, &req.mutex);
+        }
+        g_mutex_unlock(&req.mutex);
+    }
+    g_mutex_clear(&req.mutex);
+    g_cond_clear(&req.cond);
+    return req.result;
+}
+
+#ifdef SYSTRAY_A11Y
+// runs in main thread, should always return FALSE to prevent gtk to execute it
+// again
+gboolean do_accessible_menu_children(gpointer data) {
+    AccessibleChildrenRequest *req = (AccessibleChildrenRequest *)data;
+    // the tree the AT-SPI2 bridge exports
+    AtkObject *menu = gtk_widget_get_accessible(global_tray_menu);
+    int n = atk_object_get_n_accessible_children(menu);
+    for (int i = 0; i < n; i++) {
+        AtkObject *child = atk_object_ref_accessible_child(menu, i);
+        int index = atk_object_get_parent(child) == menu
+                        ? atk_object_get_index_in_parent(child)
+                        : -1;
+        const gchar *name = atk_object_get_name(child);
+        g_string_append_printf(req->children, "%d\t%s\n", index,
+                               name != NULL ? name : "");
+        g_object_unref(child);
+    }
+
+    g_mutex_lock(&req->mutex);
+    req->done = TRUE;
+    g_cond_signal(&req->cond);
+    g_mutex_unlock(&req->mutex);
+    return FALSE;
+}
+
+char *accessible_menu_children(void) {
+    AccessibleChildrenRequest req;
+    req.children = g_string_new(NULL);
+    req.done = FALSE;
+    g_mutex_init(&req.mutex);
+    g_cond_init(&req.cond);
+    // queued after the pending menu updates
+    g_idle_add(do_accessible_menu_children, &req);
+    g_mutex_lock(&req.mutex);
+    while (!req.done) {
+        g_cond_wait(&req.cond, &req.mutex);
+    }
+    g_mutex_unlock(&req.mutex);
+    g_mutex_clear(&req.mutex);
+    g_cond_clear(&req.cond);
+    // allocated with malloc, as the caller frees it with free
+    char *children = strdup(req.children->str);
+    g_string_free(req.children, TRUE);
+    return children;
+}
+#endif
+
+void unregister_hotkey(int hotkey_id) {
+    int *id = malloc(sizeof(int));
+    *id = hotkey_id;
+    g_idle_add(do_unregister_hotkey, id);
+}
+
 void quit() { g_idle_add(do_quit, NULL); }
@@ -1,5 +1,18 @@
+//go:build !systray_fake
+
 package systray
 
+/*
+#include <stdlib.h>
+#include "systray.h"
+*/
+import "C"
+
+import (
+	"os/exec"
+	"unsafe"
+)
+
 // SetTemplateIcon sets the systray icon as a template icon (on macOS), falling back
 // to a regular icon on other platforms.
 // templateIconBytes and iconBytes should be the content of .ico for windows and
@@ -8,14 +21,92 @@ func SetTemplateIcon(templateIconBytes []byte, regularIconBytes []byte) {
 	SetIcon(regularIconBytes)
 }
 
-// SetIcon sets the icon of a menu item. Only works on macOS and Windows.
-// iconBytes should be the content of .ico/.jpg/.png
-func (item *menuItem) SetIcon(iconBytes []byte) {
+// nativeIconBytes converts .icns data, which GdkPixbuf can't load, and .ico
+// data, of which it may load a smaller image, to PNG.
+func nativeIconBytes(iconBytes []byte) ([]byte, error) {
+	return iconAsPNG(iconBytes)
+}
+
+func setMenuItemIcon(item *MenuItem, iconBytes []byte) {
+	iconBytes, err := nativeIconBytes(iconBytes)
+	if err != nil {
+		return
+	}
+	cstr := (*C.char)(unsafe.Pointer(&iconBytes[0]))
+	C.setMenuItemIcon(cstr, (C.int)(len(iconBytes)), C.int(item.id), false, C.int(item.iconWidth), C.int(item.iconHeight))
 }
 
-// SetTemplateIcon sets the icon of a menu item as a template icon (on macOS). On Windows, it
-// falls back to the regular icon bytes and on Linux it does nothing.
+// SetTemplateIcon sets the icon of a menu item as a template icon (on macOS). On Windows and
+// Linux, it falls back to the regular icon bytes.
 // templateIconBytes and regularIconBytes should be the content of .ico for windows and
 // .ico/.jpg/.png for other platforms.
-func (item *menuItem) SetTemplateIcon(templateIconBytes []byte, regularIconBytes []byte) {
+func (item *MenuItem) SetTemplateIcon(templateIconBytes []byte, regularIconBytes []byte) {
+	item.SetIcon(regularIconBytes)
+}
+
+func openURL(url string) error {
+	return startCommand(exec.Command("xdg-open", url))
+}
+
+func setMenuItemProgress(item *MenuItem, title string, progress float64) bool {
+	// GTK menu items can embed a progress bar, but it doesn't go through the
+	// DBus menu of indicator hosts
+	return false
+}
+
+func setStatusItemPriority(priority int) {
+	// indicator hosts order the items themselves
+}
+
+func setIconDimmed(dimmed bool) {
+	C.set_icon_dimmed(C.bool(dimmed))
+}
+
+func requestUserAttention(enabled bool) {
+	C.request_user_attention(C.bool(enabled))
+}
+
+// canChangeCheckable is false as checkable menu items are GtkCheckMenuItems,
+// unlike the other menu items.
+func canChangeCheckable() bool {
+	return false
+}
+
+// recommendedIconSize is the usual size of the icons of indicators, hosts
+// scaling them to fit their panel anyway.
+func recommendedIconSize() (width, height int) {
+	return 22, 22
+}
+
+func trayIconBounds() (x, y, width, height int, err error) {
+	return 0, 0, 0, 0, ErrBoundsUnavailable
+}
+
+// SetTitle sets the text shown next to the tray icon, e.g. to display live
+// metrics such as "CPU 42%" in the menu bar on macOS. It does nothing on
+// Windows, whose notification area has no room for text, nor on Linux, where
+// few indicator hosts show a label.
+func SetTitle(title string) {
+	// do nothing
+}
+
+func setTooltipDelay(item *MenuItem) {
+	// the indicator host renders the menu, and GTK 3 ignores the
+	// gtk-tooltip-timeout setting since 3.10
+}
+
+func beginBatchUpdate() {
+	// GTK redraws the menu once per frame whatever the number of changes
+}
+
+func endBatchUpdate() {
+}
+
+// nativeTitle returns the title of item, with its accelerator marked.
+func nativeTitle(item *MenuItem) string {
+	title := item.loadTitle()
+	if item.accelerator == "" {
+		return title
+	}
+	return mnemonicTitle(title, item.accelerator, "_")
 }
@@ -0,0 +1,43 @@
+//go:build linux && !systray_fake && systray_a11y
+
+package systray
+
+/*
+#cgo linux CFLAGS: -DSYSTRAY_A11Y
+
+#include <stdlib.h>
+#include "systray.h"
+*/
+import "C"
+
+import (
+	"strconv"
+	"strings"
+	"unsafe"
+)
+
+// accessibleChild is a child of the main menu in the accessibility tree.
+type accessibleChild struct {
+	// index is the index of the child in its accessible parent, -1 if that's
+	// not the main menu
+	index int
+	name  string
+}
+
+// accessibleMenuChildren returns the children of the main menu in the
+// accessibility tree that GTK exports through AT-SPI2, once the pending menu
+// updates are made, for tests. It must not be called from the event loop.
+func accessibleMenuChildren() []accessibleChild {
+	cChildren := C.accessible_menu_children()
+	defer C.free(unsafe.Pointer(cChildren))
+	var children []accessibleChild
+	for _, line := range strings.Split(strings.TrimSuffix(C.GoString(cChildren), "\n"), "\n") {
+		if line == "" {
+			continue
+		}
+		fields := strings.SplitN(line, "\t", 2)
+		index, _ := strconv.Atoi(fields[0])
+		children = append(children, accessibleChild{index: index, name: fields[1]})
+	}
+	return children
+}
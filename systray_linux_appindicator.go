@@ -1,9 +1,9 @@
-//go:build linux && legacy_appindicator
+//go:build linux && legacy_appindicator && !dynamic_appindicator && !systray_fake
 
 package systray
 
 /*
-#cgo linux pkg-config: appindicator3-0.1
+#cgo linux pkg-config: appindicator3-0.1 x11
 #cgo linux CFLAGS: -DUSE_LEGACY_APPINDICATOR
 
 #include "systray.h"
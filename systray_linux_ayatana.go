@@ -1,9 +1,9 @@
-//go:build linux && !legacy_appindicator
+//go:build linux && !legacy_appindicator && !dynamic_appindicator && !systray_fake
 
 package systray
 
 /*
-#cgo linux pkg-config: ayatana-appindicator3-0.1
+#cgo linux pkg-config: ayatana-appindicator3-0.1 x11
 
 #include "systray.h"
 */
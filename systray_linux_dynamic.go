@@ -0,0 +1,12 @@
+//go:build linux && dynamic_appindicator && !systray_fake
+
+package systray
+
+/*
+#cgo linux pkg-config: gtk+-3.0 x11
+#cgo linux CFLAGS: -DUSE_DYNAMIC_APPINDICATOR
+#cgo linux LDFLAGS: -ldl
+
+#include "systray.h"
+*/
+import "C"
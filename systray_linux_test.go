@@ -0,0 +1,31 @@
+//go:build linux && !systray_fake && systray_a11y
+
+package systray
+
+import (
+	"reflect"
+	"runtime"
+	"testing"
+)
+
+// TestAccessibilityTree checks that the menu items are chained in the
+// accessibility tree in menu order. It needs a display, and the AT-SPI2 bus
+// to be meaningful, so it's only built with the systray_a11y tag:
+//
+//	go test -tags systray_a11y -run TestAccessibilityTree
+func TestAccessibilityTree(t *testing.T) {
+	runtime.LockOSThread()
+	var got []accessibleChild
+	Run(func() {
+		defer Quit()
+		NewMenuItem("First")
+		NewSeparator()
+		last := NewMenuItem("Last")
+		InsertMenuItemBefore(last, "Second")
+		got = accessibleMenuChildren()
+	}, nil)
+	want := []accessibleChild{{0, "First"}, {1, ""}, {2, "Second"}, {3, "Last"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("accessible children = %+v, want %+v", got, want)
+	}
+}
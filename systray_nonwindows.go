@@ -1,4 +1,4 @@
-//go:build !windows
+//go:build !windows && !systray_fake
 
 package systray
 
@@ -6,11 +6,18 @@ package systray
 import "C"
 
 import (
+	"syscall"
 	"unsafe"
 )
 
-func registerSystray() {
-	C.registerSystray()
+func registerSystray() error {
+	if headless() {
+		return &InitError{Op: "run headless", Err: errHeadlessUnsupported}
+	}
+	if op := C.registerSystray(); op != nil {
+		return &InitError{Op: C.GoString(op)}
+	}
+	return nil
 }
 
 func nativeLoop() {
@@ -21,69 +28,164 @@ func quit() {
 	C.quit()
 }
 
-// SetIcon sets the systray icon.
-// iconBytes should be the content of .ico for windows and .ico/.jpg/.png
-// for other platforms.
-func SetIcon(iconBytes []byte) {
+// forceQuit terminates the process right away, as the event loop is stuck.
+func forceQuit() {
+	syscall.Exit(1)
+}
+
+func setIcon(iconBytes []byte) error {
+	iconBytes, err := nativeIconBytes(iconBytes)
+	if err != nil {
+		return err
+	}
 	cstr := (*C.char)(unsafe.Pointer(&iconBytes[0]))
-	C.setIcon(cstr, (C.int)(len(iconBytes)), false)
+	width, height := trayIconSize()
+	if !C.setIcon(cstr, (C.int)(len(iconBytes)), false, C.int(width), C.int(height)) {
+		return ErrIconRejected
+	}
+	return nil
 }
 
-// SetTitle sets the systray title, only available on Mac and Linux.
-func SetTitle(title string) {
-	C.setTitle(C.CString(title))
+// NativeHandle returns the native object behind the tray icon, as an escape
+// hatch for interop with native code, nil if the systray isn't registered. It
+// is the NSStatusItem* on macOS, not retained, and the AppIndicator* on
+// Linux, or the GtkStatusIcon* when the dynamic_appindicator build falls back
+// to it. On Windows, it's the HWND of the window owning the notification icon.
+func NativeHandle() unsafe.Pointer {
+	return C.native_handle()
 }
 
-// SetTooltip sets the systray tooltip to display on mouse hover of the tray icon,
-// only available on Mac and Windows.
+func setClipboardText(text string) error {
+	if !C.set_clipboard_text(C.CString(text)) {
+		return ErrClipboard
+	}
+	return nil
+}
+
+// SetTooltip sets the systray tooltip to display on mouse hover of the tray icon.
+// On Linux, it sets the title of the indicator, which hosts show on hover.
 func SetTooltip(tooltip string) {
 	C.setTooltip(C.CString(tooltip))
 }
 
-func addOrUpdateMenuItem(item *menuItem) {
+func setIconBadge(text string) {
+	C.setIconBadge(C.CString(text))
+}
+
+// addOrUpdateMenuItem never fails as the update is made asynchronously in the
+// main thread.
+func addOrUpdateMenuItem(item *MenuItem) error {
 	var disabled C.short
-	if item.disabled {
+	if item.IsDisabled() && item.softDisabled && !item.isHeader {
+		// grayed out but still clickable
+		disabled = 2
+	} else if item.IsDisabled() || item.isHeader {
 		disabled = 1
 	}
 	var checked C.short
-	if item.checked {
+	if item.IsChecked() {
 		checked = 1
 	}
 	var isCheckable C.short
-	if item.isCheckable {
+	if item.IsCheckable() {
 		isCheckable = 1
 	}
-	var parentID uint32 = 0
-	if item.parent != nil {
-		parentID = item.parent.id
+	var isRadio C.short
+	if item.isRadio {
+		isRadio = 1
 	}
+	var isHeader C.short
+	if item.isHeader {
+		isHeader = 1
+	}
+	var hidden C.short
+	if !item.IsVisible() {
+		hidden = 1
+	}
+	parentID := item.parentId()
 	C.add_or_update_menu_item(
 		C.int(item.id),
 		C.int(parentID),
-		C.CString(item.title),
-		C.CString(item.tooltip),
+		C.int(menuOrderIndex(parentID, item.id)),
+		C.CString(nativeTitle(item)),
+		C.CString(item.loadTooltip()),
+		C.CString(item.loadDescription()),
+		C.CString(item.accelerator),
 		disabled,
 		checked,
 		isCheckable,
+		isRadio,
+		isHeader,
+		hidden,
 	)
+	return nil
+}
+
+func addSeparator(id, parentID uint32) {
+	C.add_separator(C.int(id), C.int(parentID))
 }
 
-func addSeparator(id uint32) {
-	C.add_separator(C.int(id))
+func reorderMenuItems(parentID uint32, order []uint32) {
+	if len(order) == 0 {
+		return
+	}
+	ids := make([]C.int, len(order))
+	for i, id := range order {
+		ids[i] = C.int(id)
+	}
+	C.reorder_menu_items(C.int(parentID), &ids[0], C.int(len(ids)))
 }
 
-func hideMenuItem(item *menuItem) {
+func hideMenuItem(item *MenuItem) {
 	C.hide_menu_item(
 		C.int(item.id),
 	)
 }
 
-func showMenuItem(item *menuItem) {
+func showMenuItem(item *MenuItem) {
 	C.show_menu_item(
 		C.int(item.id),
 	)
 }
 
+func removeMenuItem(item *MenuItem) {
+	C.remove_menu_item(
+		C.int(item.id),
+	)
+}
+
+func showNotification(n *notification) error {
+	var iconBytes *C.char
+	if len(n.icon) > 0 {
+		iconBytes = (*C.char)(unsafe.Pointer(&n.icon[0]))
+	}
+	C.showNotification(
+		C.CString(n.title),
+		C.CString(n.body),
+		iconBytes,
+		C.int(len(n.icon)),
+		C.int(n.iconType),
+		C.int(n.timeout.Milliseconds()),
+	)
+	return nil
+}
+
+func watchTheme() {
+	C.watch_theme()
+}
+
+func registerHotkey(id uint32, mod Modifier, key Key) error {
+	mods, code := nativeHotkey(mod, key)
+	if !C.register_hotkey(C.int(id), C.uint(mods), C.uint(code)) {
+		return ErrHotkeyUnavailable
+	}
+	return nil
+}
+
+func unregisterHotkey(id uint32) {
+	C.unregister_hotkey(C.int(id))
+}
+
 //export systray_ready
 func systray_ready() {
 	systrayReady()
@@ -98,3 +200,33 @@ func systray_on_exit() {
 func systray_menu_item_selected(cID C.int) {
 	systrayMenuItemSelected(uint32(cID))
 }
+
+//export systray_hotkey_pressed
+func systray_hotkey_pressed(cID C.int) {
+	systrayHotkeyPressed(uint32(cID))
+}
+
+//export systray_menu_opened
+func systray_menu_opened(cID C.int) {
+	systrayMenuOpened(uint32(cID))
+}
+
+//export systray_menu_closed
+func systray_menu_closed(cID C.int) {
+	systrayMenuClosed(uint32(cID))
+}
+
+//export systray_menu_item_hovered
+func systray_menu_item_hovered(cID C.int) {
+	systrayMenuItemHovered(uint32(cID))
+}
+
+//export systray_theme_changed
+func systray_theme_changed(isDark C.int) {
+	systrayThemeChanged(isDark != 0)
+}
+
+//export systray_notification_clicked
+func systray_notification_clicked() {
+	systrayNotificationClicked()
+}
@@ -1,12 +1,15 @@
-//go:build windows
+//go:build windows && !systray_fake
 
 package systray
 
 import (
 	"crypto/md5"
 	"encoding/hex"
+	"errors"
+	"fmt"
 	"io/ioutil"
 	"os"
+	"os/exec"
 	"path/filepath"
 	"sort"
 	"sync"
@@ -14,52 +17,83 @@ import (
 	"unsafe"
 
 	"golang.org/x/sys/windows"
+	"golang.org/x/sys/windows/registry"
+
+	"github.com/bingliu221/systray/internal/keys"
 )
 
 // Helpful sources: https://github.com/golang/exp/blob/master/shiny/driver/internal/win32
 
 var (
-	g32                     = windows.NewLazySystemDLL("Gdi32.dll")
-	pCreateCompatibleBitmap = g32.NewProc("CreateCompatibleBitmap")
-	pCreateCompatibleDC     = g32.NewProc("CreateCompatibleDC")
-	pDeleteDC               = g32.NewProc("DeleteDC")
-	pSelectObject           = g32.NewProc("SelectObject")
+	g32                 = windows.NewLazySystemDLL("Gdi32.dll")
+	pCreateBitmap       = g32.NewProc("CreateBitmap")
+	pCreateCompatibleDC = g32.NewProc("CreateCompatibleDC")
+	pCreateDIBSection   = g32.NewProc("CreateDIBSection")
+	pCreateFont         = g32.NewProc("CreateFontW")
+	pCreateSolidBrush   = g32.NewProc("CreateSolidBrush")
+	pDeleteDC           = g32.NewProc("DeleteDC")
+	pDeleteObject       = g32.NewProc("DeleteObject")
+	pEllipse            = g32.NewProc("Ellipse")
+	pGetStockObject     = g32.NewProc("GetStockObject")
+	pSelectObject       = g32.NewProc("SelectObject")
+	pSetBkMode          = g32.NewProc("SetBkMode")
+	pSetTextColor       = g32.NewProc("SetTextColor")
 
 	k32              = windows.NewLazySystemDLL("Kernel32.dll")
 	pGetModuleHandle = k32.NewProc("GetModuleHandleW")
+	pGlobalAlloc     = k32.NewProc("GlobalAlloc")
+	pGlobalFree      = k32.NewProc("GlobalFree")
+	pGlobalLock      = k32.NewProc("GlobalLock")
+	pGlobalUnlock    = k32.NewProc("GlobalUnlock")
+	pRtlMoveMemory   = k32.NewProc("RtlMoveMemory")
 
 	s32              = windows.NewLazySystemDLL("Shell32.dll")
 	pShellNotifyIcon = s32.NewProc("Shell_NotifyIconW")
 
 	u32                    = windows.NewLazySystemDLL("User32.dll")
+	pCloseClipboard        = u32.NewProc("CloseClipboard")
+	pCreateIconIndirect    = u32.NewProc("CreateIconIndirect")
 	pCreateMenu            = u32.NewProc("CreateMenu")
 	pCreatePopupMenu       = u32.NewProc("CreatePopupMenu")
 	pCreateWindowEx        = u32.NewProc("CreateWindowExW")
 	pDefWindowProc         = u32.NewProc("DefWindowProcW")
+	pDeleteMenu            = u32.NewProc("DeleteMenu")
+	pDestroyIcon           = u32.NewProc("DestroyIcon")
+	pDestroyMenu           = u32.NewProc("DestroyMenu")
 	pRemoveMenu            = u32.NewProc("RemoveMenu")
 	pDestroyWindow         = u32.NewProc("DestroyWindow")
 	pDispatchMessage       = u32.NewProc("DispatchMessageW")
 	pDrawIconEx            = u32.NewProc("DrawIconEx")
+	pDrawText              = u32.NewProc("DrawTextW")
+	pEmptyClipboard        = u32.NewProc("EmptyClipboard")
 	pGetCursorPos          = u32.NewProc("GetCursorPos")
 	pGetDC                 = u32.NewProc("GetDC")
+	pGetDoubleClickTime    = u32.NewProc("GetDoubleClickTime")
 	pGetMessage            = u32.NewProc("GetMessageW")
 	pGetSystemMetrics      = u32.NewProc("GetSystemMetrics")
 	pInsertMenuItem        = u32.NewProc("InsertMenuItemW")
+	pKillTimer             = u32.NewProc("KillTimer")
 	pLoadCursor            = u32.NewProc("LoadCursorW")
 	pLoadIcon              = u32.NewProc("LoadIconW")
 	pLoadImage             = u32.NewProc("LoadImageW")
+	pOpenClipboard         = u32.NewProc("OpenClipboard")
 	pPostMessage           = u32.NewProc("PostMessageW")
 	pPostQuitMessage       = u32.NewProc("PostQuitMessage")
 	pRegisterClass         = u32.NewProc("RegisterClassExW")
+	pRegisterHotKey        = u32.NewProc("RegisterHotKey")
 	pRegisterWindowMessage = u32.NewProc("RegisterWindowMessageW")
 	pReleaseDC             = u32.NewProc("ReleaseDC")
+	pSendMessage           = u32.NewProc("SendMessageW")
+	pSetClipboardData      = u32.NewProc("SetClipboardData")
 	pSetForegroundWindow   = u32.NewProc("SetForegroundWindow")
 	pSetMenuInfo           = u32.NewProc("SetMenuInfo")
 	pSetMenuItemInfo       = u32.NewProc("SetMenuItemInfoW")
+	pSetTimer              = u32.NewProc("SetTimer")
 	pShowWindow            = u32.NewProc("ShowWindow")
 	pTrackPopupMenu        = u32.NewProc("TrackPopupMenu")
 	pTranslateMessage      = u32.NewProc("TranslateMessage")
 	pUnregisterClass       = u32.NewProc("UnregisterClassW")
+	pUnregisterHotKey      = u32.NewProc("UnregisterHotKey")
 	pUpdateWindow          = u32.NewProc("UpdateWindow")
 )
 
@@ -111,7 +145,7 @@ type notifyIconData struct {
 	Tip                        [128]uint16
 	State, StateMask           uint32
 	Info                       [256]uint16
-	Timeout, Version           uint32
+	Timeout                    uint32 // in a union with uVersion
 	InfoTitle                  [64]uint16
 	InfoFlags                  uint32
 	GuidItem                   windows.GUID
@@ -166,6 +200,32 @@ type menuItemInfo struct {
 	BMPItem                     windows.Handle
 }
 
+// Contains information about the dimensions and color format of a DIB.
+// https://docs.microsoft.com/en-us/windows/win32/api/wingdi/ns-wingdi-bitmapinfoheader
+type bitmapInfoHeader struct {
+	Size                         uint32
+	Width, Height                int32
+	Planes, BitCount             uint16
+	Compression, SizeImage       uint32
+	XPelsPerMeter, YPelsPerMeter int32
+	ClrUsed, ClrImportant        uint32
+}
+
+// Contains information about an icon or a cursor.
+// https://docs.microsoft.com/en-us/windows/win32/api/winuser/ns-winuser-iconinfo
+type iconInfo struct {
+	Icon                    int32
+	XHotspot, YHotspot      uint32
+	MaskBitmap, ColorBitmap windows.Handle
+}
+
+// The RECT structure defines a rectangle by the coordinates of its
+// upper-left and lower-right corners.
+// https://docs.microsoft.com/en-us/windows/win32/api/windef/ns-windef-rect
+type rect struct {
+	Left, Top, Right, Bottom int32
+}
+
 // The POINT structure defines the x- and y- coordinates of a point.
 // https://msdn.microsoft.com/en-us/library/windows/desktop/dd162805(v=vs.85).aspx
 type point struct {
@@ -195,32 +255,264 @@ type winTray struct {
 	muMenuItemIcons sync.RWMutex
 	visibleItems    map[uint32][]uint32
 	muVisibleItems  sync.RWMutex
+	// ownerDrawn keeps track of the title and style of the menu items, to
+	// draw them from the window procedure, and styledItems counts those with
+	// a custom style, which make the whole menu owner drawn.
+	ownerDrawn   map[uint32]ownerDrawnItem
+	styledItems  int
+	muOwnerDrawn sync.RWMutex
+	// describedMenus keeps track of the menus annotated with the descriptions
+	// of their items. Only accessed from the window procedure.
+	describedMenus map[windows.Handle]bool
+	// inMenuLoop is set while the menu shows, the updates of menu items from
+	// other threads being held back in pendingUpdates until it closes.
+	inMenuLoop       bool
+	pendingUpdates   map[uint32]bool
+	muPendingUpdates sync.Mutex
 
 	nid   *notifyIconData
 	muNID sync.RWMutex
 	wcex  *wndClassEx
+	// baseIcon is the icon loaded by setIcon. When badgeText is not empty,
+	// the tray shows badgeIcon instead, which is baseIcon with the badge
+	// drawn over it. They are guarded by muNID.
+	baseIcon, badgeIcon windows.Handle
+	badgeText           string
+	// baseIconOwned is set when baseIcon was created by SetIconImage rather
+	// than loaded from a file and cached, to destroy it once replaced
+	baseIconOwned bool
+	// iconBlanked blanks the icon, to blink it while the attention mode is
+	// on, guarded by muNID
+	iconBlanked bool
 
 	wmSystrayMessage,
-	wmTaskbarCreated uint32
+	wmTaskbarCreated,
+	wmRegisterHotkey,
+	wmUnregisterHotkey uint32
+
+	// ignoreLButtonUp is set after a double click, to skip the button up
+	// message following it. Only accessed from the window procedure.
+	ignoreLButtonUp bool
+	// tooltip shows the tooltips of the menu items
+	tooltip menuTooltip
 }
 
+// clickTimerID identifies the timer which delays single clicks on the tray
+// icon until it's known they aren't part of a double click.
+const clickTimerID = 1
+
 // Loads an image from file and shows it in tray.
 // Shell_NotifyIcon: https://msdn.microsoft.com/en-us/library/windows/desktop/bb762159(v=vs.85).aspx
 func (t *winTray) setIcon(src string) error {
-	const NIF_ICON = 0x00000002
+	t.muNID.RLock()
+	initialized := t.nid != nil
+	t.muNID.RUnlock()
+	if !initialized {
+		return errTrayNotInitialized
+	}
 
-	h, err := t.loadIconFrom(src)
+	width, height := trayIconSize()
+	h, err := t.loadIconFrom(src, width, height)
 	if err != nil {
 		return err
 	}
 
+	return t.setBaseIcon(h, false)
+}
+
+// Shows h in tray, destroying the previous icon if owned. owned tells whether
+// h is to be destroyed once replaced in turn.
+func (t *winTray) setBaseIcon(h windows.Handle, owned bool) error {
+	t.muNID.Lock()
+	defer t.muNID.Unlock()
+	previous, previousOwned := t.baseIcon, t.baseIconOwned
+	t.baseIcon, t.baseIconOwned = h, owned
+	err := t.showIcon()
+	if previousOwned && previous != h {
+		pDestroyIcon.Call(uintptr(previous))
+	}
+	return err
+}
+
+// Sets the text of the badge drawn over the tray icon, an empty text removing
+// the badge.
+func (t *winTray) setBadge(text string) error {
+	t.muNID.Lock()
+	defer t.muNID.Unlock()
+	t.badgeText = text
+	if t.nid == nil {
+		return errTrayNotInitialized
+	}
+	if t.baseIcon == 0 {
+		// the badge is drawn once the icon is set
+		return nil
+	}
+	return t.showIcon()
+}
+
+// Blanks the tray icon if blanked is true, or shows it again otherwise.
+func (t *winTray) setIconBlanked(blanked bool) error {
 	t.muNID.Lock()
 	defer t.muNID.Unlock()
-	t.nid.Icon = h
+	t.iconBlanked = blanked
+	if t.nid == nil {
+		return errTrayNotInitialized
+	}
+	if t.baseIcon == 0 {
+		return nil
+	}
+	return t.showIcon()
+}
+
+// Shows baseIcon in tray, with the badge drawn over it if any. The caller
+// must hold muNID.
+func (t *winTray) showIcon() error {
+	const NIF_ICON = 0x00000002
+
+	icon := t.baseIcon
+	var badgeIcon windows.Handle
+	if t.badgeText != "" {
+		var err error
+		badgeIcon, err = t.drawBadge(t.baseIcon, t.badgeText)
+		if err != nil {
+			return err
+		}
+		icon = badgeIcon
+	}
+	if t.iconBlanked {
+		// the icon has no transparency to fade it, leave its slot empty
+		icon = 0
+	}
+	t.nid.Icon = icon
 	t.nid.Flags |= NIF_ICON
 	t.nid.Size = uint32(unsafe.Sizeof(*t.nid))
+	err := t.nid.modify()
 
-	return t.nid.modify()
+	// the shell keeps its own copy of the icon
+	if t.badgeIcon != 0 {
+		pDestroyIcon.Call(uintptr(t.badgeIcon))
+	}
+	t.badgeIcon = badgeIcon
+	return err
+}
+
+// Draws text in a red circle over the top right corner of hIcon, returning
+// the result as a new icon of the size of the notification area icons.
+func (t *winTray) drawBadge(hIcon windows.Handle, text string) (windows.Handle, error) {
+	const (
+		SM_CXSMICON    = 49
+		SM_CYSMICON    = 50
+		DI_NORMAL      = 0x3
+		DIB_RGB_COLORS = 0
+		NULL_PEN       = 8
+		TRANSPARENT    = 1
+		FW_BOLD        = 700
+		DT_CENTER      = 0x1
+		DT_VCENTER     = 0x4
+		DT_SINGLELINE  = 0x20
+	)
+	// COLORREF values are 0x00bbggrr
+	const (
+		badgeColor = 0x002626DC
+		textColor  = 0x00FFFFFF
+	)
+	hDC, _, err := pGetDC.Call(uintptr(0))
+	if hDC == 0 {
+		return 0, err
+	}
+	defer pReleaseDC.Call(uintptr(0), hDC)
+	hMemDC, _, err := pCreateCompatibleDC.Call(hDC)
+	if hMemDC == 0 {
+		return 0, err
+	}
+	defer pDeleteDC.Call(hMemDC)
+	cx, _, _ := pGetSystemMetrics.Call(SM_CXSMICON)
+	cy, _, _ := pGetSystemMetrics.Call(SM_CYSMICON)
+
+	// a top-down 32 bits DIB, to get access to the alpha channel
+	bih := bitmapInfoHeader{
+		Width:    int32(cx),
+		Height:   -int32(cy),
+		Planes:   1,
+		BitCount: 32,
+	}
+	bih.Size = uint32(unsafe.Sizeof(bih))
+	var bits unsafe.Pointer
+	hBmp, _, err := pCreateDIBSection.Call(hMemDC, uintptr(unsafe.Pointer(&bih)), DIB_RGB_COLORS, uintptr(unsafe.Pointer(&bits)), 0, 0)
+	if hBmp == 0 {
+		return 0, err
+	}
+	defer pDeleteObject.Call(hBmp)
+	hOriginalBmp, _, _ := pSelectObject.Call(hMemDC, hBmp)
+	res, _, err := pDrawIconEx.Call(hMemDC, 0, 0, uintptr(hIcon), cx, cy, 0, uintptr(0), DI_NORMAL)
+	if res == 0 {
+		pSelectObject.Call(hMemDC, hOriginalBmp)
+		return 0, err
+	}
+
+	diameter := cy * 3 / 5
+	badge := rect{
+		Left:   int32(cx - diameter),
+		Right:  int32(cx),
+		Bottom: int32(diameter),
+	}
+	hBrush, _, _ := pCreateSolidBrush.Call(badgeColor)
+	hOriginalBrush, _, _ := pSelectObject.Call(hMemDC, hBrush)
+	hNullPen, _, _ := pGetStockObject.Call(NULL_PEN)
+	hOriginalPen, _, _ := pSelectObject.Call(hMemDC, hNullPen)
+	// without pen, the right and bottom edges are excluded
+	pEllipse.Call(hMemDC, uintptr(badge.Left), uintptr(badge.Top), uintptr(badge.Right+1), uintptr(badge.Bottom+1))
+	pSelectObject.Call(hMemDC, hOriginalPen)
+	pSelectObject.Call(hMemDC, hOriginalBrush)
+	pDeleteObject.Call(hBrush)
+
+	fontHeight := diameter
+	if len(text) > 1 {
+		fontHeight = diameter * 3 / 4
+	}
+	faceName, _ := windows.UTF16PtrFromString("Segoe UI")
+	hFont, _, _ := pCreateFont.Call(fontHeight, 0, 0, 0, FW_BOLD, 0, 0, 0, 0, 0, 0, 0, 0, uintptr(unsafe.Pointer(faceName)))
+	hOriginalFont, _, _ := pSelectObject.Call(hMemDC, hFont)
+	pSetBkMode.Call(hMemDC, TRANSPARENT)
+	pSetTextColor.Call(hMemDC, textColor)
+	textPtr, err := windows.UTF16PtrFromString(text)
+	if err == nil {
+		pDrawText.Call(hMemDC, uintptr(unsafe.Pointer(textPtr)), ^uintptr(0), uintptr(unsafe.Pointer(&badge)), DT_CENTER|DT_VCENTER|DT_SINGLELINE)
+	}
+	pSelectObject.Call(hMemDC, hOriginalFont)
+	pDeleteObject.Call(hFont)
+	pSelectObject.Call(hMemDC, hOriginalBmp)
+
+	// GDI leaves the alpha channel of what it draws to 0, which is fully
+	// transparent, so make the badge opaque
+	pixels := unsafe.Slice((*uint32)(bits), cx*cy)
+	r := float64(diameter) / 2
+	centerX, centerY := float64(cx)-r, r
+	for y := 0; y < int(diameter); y++ {
+		for x := int(cx - diameter); x < int(cx); x++ {
+			dx, dy := float64(x)+0.5-centerX, float64(y)+0.5-centerY
+			if dx*dx+dy*dy <= r*r {
+				pixels[y*int(cx)+x] |= 0xFF000000
+			}
+		}
+	}
+
+	// the mask is ignored for icons with an alpha channel, but still required
+	hMask, _, err := pCreateBitmap.Call(cx, cy, 1, 1, 0)
+	if hMask == 0 {
+		return 0, err
+	}
+	defer pDeleteObject.Call(hMask)
+	ii := iconInfo{
+		Icon:        1,
+		MaskBitmap:  windows.Handle(hMask),
+		ColorBitmap: windows.Handle(hBmp),
+	}
+	res, _, err = pCreateIconIndirect.Call(uintptr(unsafe.Pointer(&ii)))
+	if res == 0 {
+		return 0, err
+	}
+	return windows.Handle(res), nil
 }
 
 // Sets tooltip on icon.
@@ -234,26 +526,79 @@ func (t *winTray) setTooltip(src string) error {
 
 	t.muNID.Lock()
 	defer t.muNID.Unlock()
+	if t.nid == nil {
+		return errTrayNotInitialized
+	}
 	copy(t.nid.Tip[:], b[:])
+	// keep the tip NUL terminated even if it's truncated
+	t.nid.Tip[len(t.nid.Tip)-1] = 0
 	t.nid.Flags |= NIF_TIP
 	t.nid.Size = uint32(unsafe.Sizeof(*t.nid))
 
 	return t.nid.modify()
 }
 
+// Shows a balloon notification from the tray icon.
+// Shell_NotifyIcon: https://msdn.microsoft.com/en-us/library/windows/desktop/bb762159(v=vs.85).aspx
+func (t *winTray) showNotification(title, body string, infoFlags uint32, balloonIcon windows.Handle, timeout uint32) error {
+	const NIF_INFO = 0x00000010
+	titleU, err := windows.UTF16FromString(title)
+	if err != nil {
+		return err
+	}
+	bodyU, err := windows.UTF16FromString(body)
+	if err != nil {
+		return err
+	}
+
+	t.muNID.Lock()
+	defer t.muNID.Unlock()
+	if t.nid == nil {
+		return errTrayNotInitialized
+	}
+	// work on a copy so that the notification isn't shown again whenever the
+	// tray icon is modified
+	nid := *t.nid
+	nid.Flags = NIF_INFO
+	copy(nid.InfoTitle[:], titleU)
+	nid.InfoTitle[len(nid.InfoTitle)-1] = 0
+	copy(nid.Info[:], bodyU)
+	nid.Info[len(nid.Info)-1] = 0
+	nid.InfoFlags = infoFlags
+	nid.BalloonIcon = balloonIcon
+	nid.Timeout = timeout
+	nid.Size = uint32(unsafe.Sizeof(nid))
+
+	return nid.modify()
+}
+
 var wt winTray
 
+var errTrayNotInitialized = errors.New("systray: tray icon is not initialized")
+
 // WindowProc callback function that processes messages sent to a window.
 // https://msdn.microsoft.com/en-us/library/windows/desktop/ms633573(v=vs.85).aspx
 func (t *winTray) wndProc(hWnd windows.Handle, message uint32, wParam, lParam uintptr) (lResult uintptr) {
 	const (
-		WM_RBUTTONUP  = 0x0205
-		WM_LBUTTONUP  = 0x0202
-		WM_COMMAND    = 0x0111
-		WM_ENDSESSION = 0x0016
-		WM_CLOSE      = 0x0010
-		WM_DESTROY    = 0x0002
+		WM_RBUTTONUP       = 0x0205
+		WM_LBUTTONUP       = 0x0202
+		WM_LBUTTONDBLCLK   = 0x0203
+		WM_TIMER           = 0x0113
+		WM_INITMENUPOPUP   = 0x0117
+		WM_ENTERMENULOOP   = 0x0211
+		WM_EXITMENULOOP    = 0x0212
+		WM_UNINITMENUPOPUP = 0x0125
+		WM_MENUSELECT      = 0x011F
+		WM_MEASUREITEM     = 0x002C
+		WM_DRAWITEM        = 0x002B
+		WM_HOTKEY          = 0x0312
+		WM_COMMAND         = 0x0111
+		WM_ENDSESSION      = 0x0016
+		WM_CLOSE           = 0x0010
+		WM_DESTROY         = 0x0002
 	)
+	// https://docs.microsoft.com/en-us/windows/win32/api/shellapi/nf-shellapi-shell_notifyiconw
+	const NIN_BALLOONUSERCLICK = 0x0400 + 5 // WM_USER + 5
 	switch message {
 	case WM_COMMAND:
 		menuItemId := int32(wParam)
@@ -261,6 +606,80 @@ func (t *winTray) wndProc(hWnd windows.Handle, message uint32, wParam, lParam ui
 		if menuItemId != -1 {
 			systrayMenuItemSelected(uint32(wParam))
 		}
+	case WM_HOTKEY:
+		systrayHotkeyPressed(uint32(wParam))
+	case WM_ENTERMENULOOP:
+		t.muPendingUpdates.Lock()
+		t.inMenuLoop = true
+		t.muPendingUpdates.Unlock()
+	case WM_EXITMENULOOP:
+		t.tooltip.hide(t)
+		t.applyPendingUpdates()
+	case WM_INITMENUPOPUP:
+		// sent before the sub menu shows, so that it can still be modified.
+		// wParam is the sub menu, the main menu being reported as menu 0.
+		t.describeMenuItems(windows.Handle(wParam))
+		if menuItemId, ok := t.menuItemOf(windows.Handle(wParam)); ok {
+			systrayMenuOpened(menuItemId)
+		} else if t.isMainMenu(windows.Handle(wParam)) {
+			systrayMenuOpened(0)
+		}
+	case WM_UNINITMENUPOPUP:
+		if menuItemId, ok := t.menuItemOf(windows.Handle(wParam)); ok {
+			systrayMenuClosed(menuItemId)
+		} else if t.isMainMenu(windows.Handle(wParam)) {
+			systrayMenuClosed(0)
+		}
+	case WM_MEASUREITEM:
+		if t.measureItem(lParam) {
+			lResult = 1
+		}
+	case WM_DRAWITEM:
+		if t.drawItem(lParam) {
+			lResult = 1
+		}
+	case WM_MENUSELECT:
+		// https://docs.microsoft.com/en-us/windows/win32/menurc/wm-menuselect
+		// the low word of wParam is the menu item ID, or its position for
+		// menu items with a sub menu. lParam is the menu.
+		const MF_POPUP = 0x00000010
+		flags := uint32(wParam>>16) & 0xFFFF
+		if flags == 0xFFFF && lParam == 0 {
+			// the menu closed
+			t.tooltip.hide(t)
+			break
+		}
+		menuItemId := uint32(wParam & 0xFFFF)
+		if flags&MF_POPUP != 0 {
+			var ok bool
+			if menuItemId, ok = t.menuItemAt(windows.Handle(lParam), int(menuItemId)); !ok {
+				break
+			}
+		}
+		t.tooltip.hover(t, menuItemId)
+		systrayMenuItemHovered(menuItemId)
+	case t.wmRegisterHotkey:
+		// hotkeys can only be registered by the thread which created the
+		// window. wParam is the hotkey ID, lParam the virtual-key code in the
+		// high word and the modifiers in the low word.
+		pUnregisterHotKey.Call(uintptr(t.window), wParam)
+		res, _, err := pRegisterHotKey.Call(uintptr(t.window), wParam, lParam&0xFFFF, lParam>>16)
+		if res == 0 {
+			lResult = uintptr(err.(syscall.Errno))
+			if lResult == 0 {
+				lResult = 1
+			}
+		}
+	case t.wmUnregisterHotkey:
+		pUnregisterHotKey.Call(uintptr(t.window), wParam)
+	case WM_TIMER:
+		switch wParam {
+		case clickTimerID:
+			pKillTimer.Call(uintptr(t.window), clickTimerID)
+			t.leftClicked()
+		case tooltipTimerID:
+			t.tooltip.show(t)
+		}
 	case WM_CLOSE:
 		pDestroyWindow.Call(uintptr(t.window))
 		t.wcex.unregister()
@@ -277,8 +696,26 @@ func (t *winTray) wndProc(hWnd windows.Handle, message uint32, wParam, lParam ui
 		systrayExit()
 	case t.wmSystrayMessage:
 		switch lParam {
-		case WM_RBUTTONUP, WM_LBUTTONUP:
-			t.showMenu()
+		case WM_LBUTTONUP:
+			if t.ignoreLButtonUp {
+				t.ignoreLButtonUp = false
+			} else if hasTrayDoubleClick() {
+				doubleClickTime, _, _ := pGetDoubleClickTime.Call()
+				pSetTimer.Call(uintptr(t.window), clickTimerID, doubleClickTime, 0)
+			} else {
+				t.leftClicked()
+			}
+		case WM_LBUTTONDBLCLK:
+			pKillTimer.Call(uintptr(t.window), clickTimerID)
+			if trayDoubleClicked() {
+				t.ignoreLButtonUp = true
+			}
+		case WM_RBUTTONUP:
+			if !trayRightClicked() {
+				t.showMenu()
+			}
+		case NIN_BALLOONUSERCLICK:
+			systrayNotificationClicked()
 		}
 	case t.wmTaskbarCreated: // on explorer.exe restarts
 		t.muNID.Lock()
@@ -297,6 +734,48 @@ func (t *winTray) wndProc(hWnd windows.Handle, message uint32, wParam, lParam ui
 	return
 }
 
+// Returns the ID of the menu item whose sub menu is menu.
+func (t *winTray) menuItemOf(menu windows.Handle) (uint32, bool) {
+	t.muMenus.RLock()
+	defer t.muMenus.RUnlock()
+	for menuItemId, m := range t.menus {
+		if m == menu && menuItemId != 0 {
+			return menuItemId, true
+		}
+	}
+	return 0, false
+}
+
+func (t *winTray) isMainMenu(menu windows.Handle) bool {
+	t.muMenus.RLock()
+	defer t.muMenus.RUnlock()
+	return menu == t.menus[0]
+}
+
+// Returns the ID of the menu item at position in menu.
+func (t *winTray) menuItemAt(menu windows.Handle, position int) (uint32, bool) {
+	var parent uint32
+	if !t.isMainMenu(menu) {
+		var ok bool
+		if parent, ok = t.menuItemOf(menu); !ok {
+			return 0, false
+		}
+	}
+	t.muVisibleItems.RLock()
+	defer t.muVisibleItems.RUnlock()
+	visibleItems := t.visibleItems[parent]
+	if position < 0 || position >= len(visibleItems) {
+		return 0, false
+	}
+	return visibleItems[position], true
+}
+
+func (t *winTray) leftClicked() {
+	if !trayLeftClicked() {
+		t.showMenu()
+	}
+}
+
 func (t *winTray) initInstance() error {
 	const IDI_APPLICATION = 32512
 	const IDC_ARROW = 32512 // Standard arrow
@@ -330,10 +809,17 @@ func (t *winTray) initInstance() error {
 	)
 
 	t.wmSystrayMessage = WM_USER + 1
+	t.wmRegisterHotkey = WM_USER + 2
+	t.wmUnregisterHotkey = WM_USER + 3
 	t.visibleItems = make(map[uint32][]uint32)
 	t.menus = make(map[uint32]windows.Handle)
 	t.menuOf = make(map[uint32]windows.Handle)
 	t.menuItemIcons = make(map[uint32]windows.Handle)
+	t.ownerDrawn = make(map[uint32]ownerDrawnItem)
+	t.styledItems = 0
+	t.tooltip = menuTooltip{}
+	t.describedMenus = make(map[windows.Handle]bool)
+	t.pendingUpdates = make(map[uint32]bool)
 
 	taskbarEventNamePtr, _ := windows.UTF16PtrFromString("TaskbarCreated")
 	// https://msdn.microsoft.com/en-us/library/windows/desktop/ms644947
@@ -488,7 +974,7 @@ func (t *winTray) convertToSubMenu(menuItemId uint32) (windows.Handle, error) {
 	return menu, nil
 }
 
-func (t *winTray) addOrUpdateMenuItem(menuItemId uint32, parentId uint32, title string, disabled, checked bool) error {
+func (t *winTray) addOrUpdateMenuItem(menuItemId uint32, parentId uint32, title string, disabled, checked, radio, header bool) error {
 	// https://msdn.microsoft.com/en-us/library/windows/desktop/ms647578(v=vs.85).aspx
 	const (
 		MIIM_FTYPE   = 0x00000100
@@ -498,10 +984,15 @@ func (t *winTray) addOrUpdateMenuItem(menuItemId uint32, parentId uint32, title
 		MIIM_ID      = 0x00000002
 		MIIM_STATE   = 0x00000001
 	)
-	const MFT_STRING = 0x00000000
+	const (
+		MFT_STRING     = 0x00000000
+		MFT_OWNERDRAW  = 0x00000100
+		MFT_RADIOCHECK = 0x00000200
+	)
 	const (
 		MFS_CHECKED  = 0x00000008
 		MFS_DISABLED = 0x00000003
+		MFS_DEFAULT  = 0x00001000
 	)
 	titlePtr, err := windows.UTF16PtrFromString(title)
 	if err != nil {
@@ -516,12 +1007,22 @@ func (t *winTray) addOrUpdateMenuItem(menuItemId uint32, parentId uint32, title
 		Cch:      uint32(len(title)),
 	}
 	mi.Size = uint32(unsafe.Sizeof(mi))
+	if radio {
+		mi.Type |= MFT_RADIOCHECK
+	}
+	if t.isOwnerDrawn(menuItemId) {
+		mi.Type |= MFT_OWNERDRAW
+	}
 	if disabled {
 		mi.State |= MFS_DISABLED
 	}
 	if checked {
 		mi.State |= MFS_CHECKED
 	}
+	if header {
+		// the default item is shown in bold
+		mi.State |= MFS_DISABLED | MFS_DEFAULT
+	}
 	t.muMenuItemIcons.RLock()
 	hIcon := t.menuItemIcons[menuItemId]
 	t.muMenuItemIcons.RUnlock()
@@ -598,13 +1099,24 @@ func (t *winTray) addSeparatorMenuItem(menuItemId, parentId uint32) error {
 
 	mi.Size = uint32(unsafe.Sizeof(mi))
 
-	t.addToVisibleItems(parentId, menuItemId)
-	position := t.getVisibleItemIndex(parentId, menuItemId)
 	t.muMenus.RLock()
-	menu := uintptr(t.menus[parentId])
+	menu, exists := t.menus[parentId]
 	t.muMenus.RUnlock()
+	if !exists {
+		var err error
+		menu, err = t.convertToSubMenu(parentId)
+		if err != nil {
+			return err
+		}
+		t.muMenus.Lock()
+		t.menus[parentId] = menu
+		t.muMenus.Unlock()
+	}
+
+	t.addToVisibleItems(parentId, menuItemId)
+	position := t.getVisibleItemIndex(parentId, menuItemId)
 	res, _, err := pInsertMenuItem.Call(
-		menu,
+		uintptr(menu),
 		uintptr(position),
 		1,
 		uintptr(unsafe.Pointer(&mi)),
@@ -637,6 +1149,51 @@ func (t *winTray) hideMenuItem(menuItemId, parentId uint32) error {
 	return nil
 }
 
+func (t *winTray) removeMenuItem(menuItemId, parentId uint32) error {
+	// https://docs.microsoft.com/en-us/windows/win32/api/winuser/nf-winuser-deletemenu
+	const MF_BYCOMMAND = 0x00000000
+	const ERROR_SUCCESS syscall.Errno = 0
+
+	t.muMenus.RLock()
+	menu := uintptr(t.menus[parentId])
+	submenu, hasSubmenu := t.menus[menuItemId]
+	t.muMenus.RUnlock()
+	if t.getVisibleItemIndex(parentId, menuItemId) != -1 {
+		// DeleteMenu destroys the submenu of the menu item as well
+		res, _, err := pDeleteMenu.Call(
+			menu,
+			uintptr(menuItemId),
+			MF_BYCOMMAND,
+		)
+		if res == 0 && err.(syscall.Errno) != ERROR_SUCCESS {
+			return err
+		}
+		t.delFromVisibleItems(parentId, menuItemId)
+	} else if hasSubmenu {
+		// a hidden menu item is no longer attached to its menu, so its
+		// submenu has to be destroyed explicitly
+		pDestroyMenu.Call(uintptr(submenu))
+	}
+
+	t.muMenus.Lock()
+	delete(t.menus, menuItemId)
+	t.muMenus.Unlock()
+	t.muMenuOf.Lock()
+	delete(t.menuOf, menuItemId)
+	t.muMenuOf.Unlock()
+	t.muMenuItemIcons.Lock()
+	if hBitmap, exists := t.menuItemIcons[menuItemId]; exists {
+		pDeleteObject.Call(uintptr(hBitmap))
+		delete(t.menuItemIcons, menuItemId)
+	}
+	t.muMenuItemIcons.Unlock()
+	t.muVisibleItems.Lock()
+	delete(t.visibleItems, menuItemId)
+	t.muVisibleItems.Unlock()
+
+	return nil
+}
+
 func (t *winTray) showMenu() error {
 	const (
 		TPM_BOTTOMALIGN = 0x0020
@@ -649,6 +1206,8 @@ func (t *winTray) showMenu() error {
 	}
 	pSetForegroundWindow.Call(uintptr(t.window))
 
+	unhook := hookMenuKeys()
+	defer unhook()
 	res, _, err = pTrackPopupMenu.Call(
 		uintptr(t.menus[0]),
 		TPM_BOTTOMALIGN|TPM_LEFTALIGN,
@@ -684,11 +1243,26 @@ func (t *winTray) addToVisibleItems(parent, val uint32) {
 		t.visibleItems[parent] = []uint32{val}
 	} else {
 		newvisible := append(visibleItems, val)
-		sort.Slice(newvisible, func(i, j int) bool { return newvisible[i] < newvisible[j] })
+		sort.Slice(newvisible, func(i, j int) bool { return menuItemLess(parent, newvisible[i], newvisible[j]) })
 		t.visibleItems[parent] = newvisible
 	}
 }
 
+// menuItemLess tells if menu item a shows before b in the menu of parent.
+// Menu items unknown to the menu are placed last, ordered by ID.
+func menuItemLess(parent, a, b uint32) bool {
+	ia, ib := menuOrderIndex(parent, a), menuOrderIndex(parent, b)
+	switch {
+	case ia == -1 && ib == -1:
+		return a < b
+	case ia == -1:
+		return false
+	case ib == -1:
+		return true
+	}
+	return ia < ib
+}
+
 func (t *winTray) getVisibleItemIndex(parent, val uint32) int {
 	t.muVisibleItems.RLock()
 	defer t.muVisibleItems.RUnlock()
@@ -700,17 +1274,31 @@ func (t *winTray) getVisibleItemIndex(parent, val uint32) int {
 	return -1
 }
 
-// Loads an image from file to be shown in tray or menu item.
+// Loads an image from file to be shown in tray or menu item, of the given
+// size, or of the default size if width and height are 0.
 // LoadImage: https://msdn.microsoft.com/en-us/library/windows/desktop/ms648045(v=vs.85).aspx
-func (t *winTray) loadIconFrom(src string) (windows.Handle, error) {
+func (t *winTray) loadIconFrom(src string, width, height int) (windows.Handle, error) {
 	const IMAGE_ICON = 1               // Loads an icon
 	const LR_LOADFROMFILE = 0x00000010 // Loads the stand-alone image from the file
 	const LR_DEFAULTSIZE = 0x00000040  // Loads default-size icon for windows(SM_CXICON x SM_CYICON) if cx, cy are set to zero
 
+	flags := uintptr(LR_LOADFROMFILE)
+	key := src
+	if width > 0 && height > 0 {
+		key = fmt.Sprintf("%s@%dx%d", src, width, height)
+	} else {
+		width, height = 0, 0
+		flags |= LR_DEFAULTSIZE
+	}
+
 	// Save and reuse handles of loaded images
 	t.muLoadedImages.RLock()
-	h, ok := t.loadedImages[src]
+	h, ok := t.loadedImages[key]
+	initialized := t.loadedImages != nil
 	t.muLoadedImages.RUnlock()
+	if !initialized {
+		return 0, errTrayNotInitialized
+	}
 	if !ok {
 		srcPtr, err := windows.UTF16PtrFromString(src)
 		if err != nil {
@@ -720,25 +1308,28 @@ func (t *winTray) loadIconFrom(src string) (windows.Handle, error) {
 			0,
 			uintptr(unsafe.Pointer(srcPtr)),
 			IMAGE_ICON,
-			0,
-			0,
-			LR_LOADFROMFILE|LR_DEFAULTSIZE,
+			uintptr(width),
+			uintptr(height),
+			flags,
 		)
 		if res == 0 {
 			return 0, err
 		}
 		h = windows.Handle(res)
 		t.muLoadedImages.Lock()
-		t.loadedImages[src] = h
+		t.loadedImages[key] = h
 		t.muLoadedImages.Unlock()
 	}
 	return h, nil
 }
 
-func (t *winTray) iconToBitmap(hIcon windows.Handle) (windows.Handle, error) {
+// iconToBitmap draws hIcon into a bitmap of the given size, or of the size of
+// small icons if width and height are 0.
+func (t *winTray) iconToBitmap(hIcon windows.Handle, width, height int) (windows.Handle, error) {
 	const SM_CXSMICON = 49
 	const SM_CYSMICON = 50
 	const DI_NORMAL = 0x3
+	const DIB_RGB_COLORS = 0
 	hDC, _, err := pGetDC.Call(uintptr(0))
 	if hDC == 0 {
 		return 0, err
@@ -749,9 +1340,23 @@ func (t *winTray) iconToBitmap(hIcon windows.Handle) (windows.Handle, error) {
 		return 0, err
 	}
 	defer pDeleteDC.Call(hMemDC)
-	cx, _, _ := pGetSystemMetrics.Call(SM_CXSMICON)
-	cy, _, _ := pGetSystemMetrics.Call(SM_CYSMICON)
-	hMemBmp, _, err := pCreateCompatibleBitmap.Call(hDC, cx, cy)
+	cx, cy := uintptr(width), uintptr(height)
+	if width <= 0 || height <= 0 {
+		cx, _, _ = pGetSystemMetrics.Call(SM_CXSMICON)
+		cy, _, _ = pGetSystemMetrics.Call(SM_CYSMICON)
+	}
+	// a 32 bits DIB rather than a bitmap compatible with the screen, which
+	// has no alpha channel and would turn transparent pixels black. Menus
+	// support bitmaps with an alpha channel, kept by DrawIconEx.
+	bih := bitmapInfoHeader{
+		Width:    int32(cx),
+		Height:   -int32(cy),
+		Planes:   1,
+		BitCount: 32,
+	}
+	bih.Size = uint32(unsafe.Sizeof(bih))
+	var bits unsafe.Pointer
+	hMemBmp, _, err := pCreateDIBSection.Call(hMemDC, uintptr(unsafe.Pointer(&bih)), DIB_RGB_COLORS, uintptr(unsafe.Pointer(&bits)), 0, 0)
 	if hMemBmp == 0 {
 		return 0, err
 	}
@@ -764,18 +1369,20 @@ func (t *winTray) iconToBitmap(hIcon windows.Handle) (windows.Handle, error) {
 	return windows.Handle(hMemBmp), nil
 }
 
-func registerSystray() {
+func registerSystray() error {
+	if headless() {
+		return &InitError{Op: "run headless", Err: errHeadlessUnsupported}
+	}
 	if err := wt.initInstance(); err != nil {
-		// log.Errorf("Unable to init instance: %v", err)
-		return
+		return &InitError{Op: "create the window of the tray icon", Err: err}
 	}
 
 	if err := wt.createMenu(); err != nil {
-		// log.Errorf("Unable to create menu: %v", err)
-		return
+		return &InitError{Op: "create the menu", Err: err}
 	}
 
 	systrayReady()
+	return nil
 }
 
 func nativeLoop() {
@@ -819,7 +1426,25 @@ func quit() {
 	)
 }
 
+// forceQuit terminates the process right away, as the event loop is stuck.
+func forceQuit() {
+	windows.ExitProcess(1)
+}
+
 func iconBytesToFilePath(iconBytes []byte) (string, error) {
+	if detectIconFormat(iconBytes) == iconFormatICNS {
+		// LoadImage doesn't load .icns files, whose largest image is
+		// converted
+		var err error
+		if iconBytes, err = iconAsPNG(iconBytes); err != nil {
+			return "", err
+		}
+	}
+	if detectIconFormat(iconBytes) == iconFormatPNG {
+		// LoadImage only loads .ico files, which may embed a PNG, keeping
+		// its alpha channel
+		iconBytes = pngToICO(iconBytes)
+	}
 	bh := md5.Sum(iconBytes)
 	dataHash := hex.EncodeToString(bh[:])
 	iconFilePath := filepath.Join(os.TempDir(), "systray_temp_icon_"+dataHash)
@@ -832,17 +1457,17 @@ func iconBytesToFilePath(iconBytes []byte) (string, error) {
 	return iconFilePath, nil
 }
 
-// SetIcon sets the systray icon.
-// iconBytes should be the content of .ico for windows and .ico/.jpg/.png
-// for other platforms.
-func SetIcon(iconBytes []byte) {
+func setIcon(iconBytes []byte) error {
 	iconFilePath, err := iconBytesToFilePath(iconBytes)
 	if err != nil {
-		// log.Errorf("Unable to write icon data to temp file: %v", err)
-		return
+		return err
 	}
-	if err := wt.setIcon(iconFilePath); err != nil {
-		// log.Errorf("Unable to set icon: %v", err)
+	return wt.setIcon(iconFilePath)
+}
+
+func setIconBadge(text string) {
+	if err := wt.setBadge(text); err != nil {
+		// log.Errorf("Unable to set icon badge: %v", err)
 		return
 	}
 }
@@ -855,34 +1480,82 @@ func SetTemplateIcon(templateIconBytes []byte, regularIconBytes []byte) {
 	SetIcon(regularIconBytes)
 }
 
-// SetTitle sets the systray title, only available on Mac and Linux.
+// SetTitle sets the text shown next to the tray icon, e.g. to display live
+// metrics such as "CPU 42%" in the menu bar on macOS. It does nothing on
+// Windows, whose notification area has no room for text, nor on Linux, where
+// few indicator hosts show a label.
 func SetTitle(title string) {
 	// do nothing
 }
 
-func (item *menuItem) parentId() uint32 {
-	if item.parent != nil {
-		return uint32(item.parent.id)
+func openURL(url string) error {
+	return startCommand(exec.Command("rundll32", "url.dll,FileProtocolHandler", url))
+}
+
+func setMenuItemProgress(item *MenuItem, title string, progress float64) bool {
+	// win32 menus have no inline progress control
+	return false
+}
+
+func setStatusItemPriority(priority int) {
+	// the user orders the notification icons
+}
+
+func setIconDimmed(dimmed bool) {
+	if err := wt.setIconBlanked(dimmed); err != nil {
+		// log.Errorf("Unable to blink icon: %v", err)
+		return
 	}
-	return 0
 }
 
-// SetIcon sets the icon of a menu item. Only works on macOS and Windows.
-// iconBytes should be the content of .ico/.jpg/.png
-func (item *menuItem) SetIcon(iconBytes []byte) {
+func requestUserAttention(enabled bool) {
+	// FlashWindowEx only flashes taskbar buttons, which the hidden window of
+	// the notification icon doesn't have
+}
+
+// canChangeCheckable is true as all menu items are checkable on Windows.
+func canChangeCheckable() bool {
+	return true
+}
+
+// recommendedIconSize is the size of small icons, which the notification area
+// shows, at the DPI of the primary display.
+func recommendedIconSize() (width, height int) {
+	const (
+		SM_CXSMICON = 49
+		SM_CYSMICON = 50
+	)
+	cx, _, _ := pGetSystemMetrics.Call(SM_CXSMICON)
+	cy, _, _ := pGetSystemMetrics.Call(SM_CYSMICON)
+	return int(cx), int(cy)
+}
+
+func setTooltipDelay(item *MenuItem) {
+	// read by the window procedure when the menu item is pointed to
+}
+
+func beginBatchUpdate() {
+	wt.setMenuRedraw(false)
+}
+
+func endBatchUpdate() {
+	wt.setMenuRedraw(true)
+}
+
+func setMenuItemIcon(item *MenuItem, iconBytes []byte) {
 	iconFilePath, err := iconBytesToFilePath(iconBytes)
 	if err != nil {
 		// log.Errorf("Unable to write icon data to temp file: %v", err)
 		return
 	}
 
-	h, err := wt.loadIconFrom(iconFilePath)
+	h, err := wt.loadIconFrom(iconFilePath, item.iconWidth, item.iconHeight)
 	if err != nil {
 		// log.Errorf("Unable to load icon from temp file: %v", err)
 		return
 	}
 
-	h, err = wt.iconToBitmap(h)
+	h, err = wt.iconToBitmap(h, item.iconWidth, item.iconHeight)
 	if err != nil {
 		// log.Errorf("Unable to convert icon to bitmap: %v", err)
 		return
@@ -891,15 +1564,11 @@ func (item *menuItem) SetIcon(iconBytes []byte) {
 	wt.menuItemIcons[uint32(item.id)] = h
 	wt.muMenuItemIcons.Unlock()
 
-	err = wt.addOrUpdateMenuItem(uint32(item.id), item.parentId(), item.title, item.disabled, item.checked)
-	if err != nil {
-		// log.Errorf("Unable to addOrUpdateMenuItem: %v", err)
-		return
-	}
+	item.addOrUpdate()
 }
 
-// SetTooltip sets the systray tooltip to display on mouse hover of the tray icon,
-// only available on Mac and Windows.
+// SetTooltip sets the systray tooltip to display on mouse hover of the tray icon.
+// On Linux, it sets the title of the indicator, which hosts show on hover.
 func SetTooltip(tooltip string) {
 	if err := wt.setTooltip(tooltip); err != nil {
 		// log.Errorf("Unable to set tooltip: %v", err)
@@ -907,31 +1576,77 @@ func SetTooltip(tooltip string) {
 	}
 }
 
-func addOrUpdateMenuItem(item *menuItem) {
-	err := wt.addOrUpdateMenuItem(uint32(item.id), item.parentId(), item.title, item.disabled, item.checked)
-	if err != nil {
-		// log.Errorf("Unable to addOrUpdateMenuItem: %v", err)
-		return
+// nativeTitle returns the title of item, with its accelerator marked.
+func nativeTitle(item *MenuItem) string {
+	title := item.loadTitle()
+	if item.accelerator == "" {
+		return title
 	}
+	return mnemonicTitle(title, item.accelerator, "&")
 }
 
-// SetTemplateIcon sets the icon of a menu item as a template icon (on macOS). On Windows, it
-// falls back to the regular icon bytes and on Linux it does nothing.
+func addOrUpdateMenuItem(item *MenuItem) error {
+	if !item.IsVisible() {
+		// updating would insert the menu item back, it's updated when shown
+		return nil
+	}
+	if wt.holdUpdate(item.id) {
+		return nil
+	}
+	disabled := item.IsDisabled()
+	// soft disabled menu items are drawn grayed out, as disabling them would
+	// drop their clicks
+	if wt.setOwnerDrawn(item.id, nativeTitle(item), item.style, disabled && item.softDisabled) {
+		defer updateOtherMenuItems(item.id)
+	}
+	return wt.addOrUpdateMenuItem(uint32(item.id), item.parentId(), nativeTitle(item), disabled && !item.softDisabled, item.IsChecked(), item.isRadio, item.isHeader)
+}
+
+// SetTemplateIcon sets the icon of a menu item as a template icon (on macOS). On Windows and
+// Linux, it falls back to the regular icon bytes.
 // templateIconBytes and regularIconBytes should be the content of .ico for windows and
 // .ico/.jpg/.png for other platforms.
-func (item *menuItem) SetTemplateIcon(templateIconBytes []byte, regularIconBytes []byte) {
+func (item *MenuItem) SetTemplateIcon(templateIconBytes []byte, regularIconBytes []byte) {
 	item.SetIcon(regularIconBytes)
 }
 
-func addSeparator(id uint32) {
-	err := wt.addSeparatorMenuItem(id, 0)
+func addSeparator(id, parentID uint32) {
+	err := wt.addSeparatorMenuItem(id, parentID)
 	if err != nil {
 		// log.Errorf("Unable to addSeparator: %v", err)
 		return
 	}
 }
 
-func hideMenuItem(item *menuItem) {
+func reorderMenuItems(parentId uint32, order []uint32) {
+	// hide the visible menu items and show them again, as they are inserted
+	// in the order of menuOrder
+	var visible []uint32
+	for _, id := range order {
+		if wt.getVisibleItemIndex(parentId, id) == -1 {
+			continue
+		}
+		if err := wt.hideMenuItem(id, parentId); err != nil {
+			// log.Errorf("Unable to hideMenuItem: %v", err)
+			continue
+		}
+		visible = append(visible, id)
+	}
+	for _, id := range visible {
+		item, ok := GetMenuItemByID(id)
+		if !ok {
+			continue
+		}
+		if !item.isSeparator {
+			item.addOrUpdate()
+		} else if err := wt.addSeparatorMenuItem(id, parentId); err != nil {
+			// log.Errorf("Unable to addSeparator: %v", err)
+			return
+		}
+	}
+}
+
+func hideMenuItem(item *MenuItem) {
 	err := wt.hideMenuItem(uint32(item.id), item.parentId())
 	if err != nil {
 		// log.Errorf("Unable to hideMenuItem: %v", err)
@@ -939,6 +1654,175 @@ func hideMenuItem(item *menuItem) {
 	}
 }
 
-func showMenuItem(item *menuItem) {
-	addOrUpdateMenuItem(item)
+func showMenuItem(item *MenuItem) {
+	if !item.isSeparator {
+		item.addOrUpdate()
+		return
+	}
+	if wt.getVisibleItemIndex(item.parentId(), item.id) == -1 {
+		err := wt.addSeparatorMenuItem(item.id, item.parentId())
+		if err != nil {
+			// log.Errorf("Unable to show separator: %v", err)
+			return
+		}
+	}
+}
+
+// updateOtherMenuItems updates the menu items but the one with the given ID,
+// once the menu switched owner draw mode.
+func updateOtherMenuItems(menuItemId uint32) {
+	menuItems.Range(func(_, v interface{}) bool {
+		if item := v.(*MenuItem); item.id != menuItemId {
+			item.addOrUpdate()
+		}
+		return true
+	})
+}
+
+func removeMenuItem(item *MenuItem) {
+	if wt.forgetOwnerDrawn(item.id) {
+		updateOtherMenuItems(item.id)
+	}
+	err := wt.removeMenuItem(uint32(item.id), item.parentId())
+	if err != nil {
+		// log.Errorf("Unable to removeMenuItem: %v", err)
+		return
+	}
+}
+
+// NativeHandle returns the native object behind the tray icon, as an escape
+// hatch for interop with native code, nil if the systray isn't registered. It
+// is the HWND of the window owning the notification icon on Windows, to
+// convert to windows.HWND through uintptr. On macOS, it's the NSStatusItem*,
+// not retained, and the AppIndicator* on Linux.
+func NativeHandle() unsafe.Pointer {
+	// the HWND isn't a Go pointer, reinterpret it rather than converting it
+	// from uintptr, which go vet flags
+	return *(*unsafe.Pointer)(unsafe.Pointer(&wt.window))
+}
+
+func setClipboardText(text string) error {
+	// https://docs.microsoft.com/en-us/windows/win32/dataxchg/using-the-clipboard
+	const (
+		CF_UNICODETEXT = 13
+		GMEM_MOVEABLE  = 0x0002
+	)
+	data, err := windows.UTF16FromString(text)
+	if err != nil {
+		return err
+	}
+	res, _, err := pOpenClipboard.Call(uintptr(wt.window))
+	if res == 0 {
+		return err
+	}
+	defer pCloseClipboard.Call()
+	res, _, err = pEmptyClipboard.Call()
+	if res == 0 {
+		return err
+	}
+
+	size := uintptr(len(data)) * unsafe.Sizeof(data[0])
+	hMem, _, err := pGlobalAlloc.Call(GMEM_MOVEABLE, size)
+	if hMem == 0 {
+		return err
+	}
+	dst, _, err := pGlobalLock.Call(hMem)
+	if dst == 0 {
+		pGlobalFree.Call(hMem)
+		return err
+	}
+	pRtlMoveMemory.Call(dst, uintptr(unsafe.Pointer(&data[0])), size)
+	pGlobalUnlock.Call(hMem)
+
+	// the system owns the memory once the data is set
+	res, _, err = pSetClipboardData.Call(CF_UNICODETEXT, hMem)
+	if res == 0 {
+		pGlobalFree.Call(hMem)
+		return err
+	}
+	return nil
+}
+
+func showNotification(n *notification) error {
+	// https://docs.microsoft.com/en-us/windows/win32/api/shellapi/ns-shellapi-notifyicondataw
+	const (
+		NIIF_NONE       = 0x00000000
+		NIIF_INFO       = 0x00000001
+		NIIF_WARNING    = 0x00000002
+		NIIF_ERROR      = 0x00000003
+		NIIF_USER       = 0x00000004
+		NIIF_LARGE_ICON = 0x00000020
+	)
+	var infoFlags uint32
+	var balloonIcon windows.Handle
+	switch n.iconType {
+	case NotificationIconInfo:
+		infoFlags = NIIF_INFO
+	case NotificationIconWarning:
+		infoFlags = NIIF_WARNING
+	case NotificationIconError:
+		infoFlags = NIIF_ERROR
+	default:
+		infoFlags = NIIF_NONE
+	}
+	if len(n.icon) > 0 {
+		iconFilePath, err := iconBytesToFilePath(n.icon)
+		if err != nil {
+			return err
+		}
+		// loaded in the default size, which is the large icon size
+		balloonIcon, err = wt.loadIconFrom(iconFilePath, 0, 0)
+		if err != nil {
+			return err
+		}
+		infoFlags = NIIF_USER | NIIF_LARGE_ICON
+	}
+	return wt.showNotification(n.title, n.body, infoFlags, balloonIcon, uint32(n.timeout.Milliseconds()))
+}
+
+func watchTheme() {
+	go func() {
+		k, err := registry.OpenKey(registry.CURRENT_USER, `Software\Microsoft\Windows\CurrentVersion\Themes\Personalize`, registry.QUERY_VALUE|registry.NOTIFY)
+		if err != nil {
+			// log.Errorf("Unable to open the theme registry key: %v", err)
+			return
+		}
+		defer k.Close()
+		for {
+			// the value doesn't exist before Windows 10 1903, which is light
+			lightTheme, _, err := k.GetIntegerValue("SystemUsesLightTheme")
+			systrayThemeChanged(err == nil && lightTheme == 0)
+			if err := windows.RegNotifyChangeKeyValue(windows.Handle(k), false, windows.REG_NOTIFY_CHANGE_LAST_SET, 0, false); err != nil {
+				// log.Errorf("Unable to watch the theme registry key: %v", err)
+				return
+			}
+		}
+	}()
+}
+
+func registerHotkey(id uint32, mod Modifier, key Key) error {
+	if wt.window == 0 {
+		return errTrayNotInitialized
+	}
+	mods, vk := keys.Win32(mod, key)
+	// SendMessage waits for the window procedure to process the message
+	res, _, _ := pSendMessage.Call(
+		uintptr(wt.window),
+		uintptr(wt.wmRegisterHotkey),
+		uintptr(id),
+		uintptr(vk<<16|mods),
+	)
+	if res != 0 {
+		return fmt.Errorf("%w: %v", ErrHotkeyUnavailable, syscall.Errno(res))
+	}
+	return nil
+}
+
+func unregisterHotkey(id uint32) {
+	pSendMessage.Call(
+		uintptr(wt.window),
+		uintptr(wt.wmUnregisterHotkey),
+		uintptr(id),
+		0,
+	)
 }
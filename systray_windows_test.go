@@ -1,4 +1,4 @@
-//go:build windows
+//go:build windows && !systray_fake
 
 package systray
 
@@ -43,11 +43,11 @@ func TestBaseWindowsTray(t *testing.T) {
 	}
 
 	var id uint32 = 0
-	err := wt.addOrUpdateMenuItem(atomic.AddUint32(&id, 1), 0, "Simple enabled", false, false)
+	err := wt.addOrUpdateMenuItem(atomic.AddUint32(&id, 1), 0, "Simple enabled", false, false, false, false)
 	if err != nil {
 		t.Errorf("mergeMenuItem failed: %s", err)
 	}
-	err = wt.addOrUpdateMenuItem(atomic.AddUint32(&id, 1), 0, "Simple disabled", true, false)
+	err = wt.addOrUpdateMenuItem(atomic.AddUint32(&id, 1), 0, "Simple disabled", true, false, false, false)
 	if err != nil {
 		t.Errorf("mergeMenuItem failed: %s", err)
 	}
@@ -55,11 +55,11 @@ func TestBaseWindowsTray(t *testing.T) {
 	if err != nil {
 		t.Errorf("addSeparatorMenuItem failed: %s", err)
 	}
-	err = wt.addOrUpdateMenuItem(atomic.AddUint32(&id, 1), 0, "Simple checked enabled", false, true)
+	err = wt.addOrUpdateMenuItem(atomic.AddUint32(&id, 1), 0, "Simple checked enabled", false, true, false, false)
 	if err != nil {
 		t.Errorf("mergeMenuItem failed: %s", err)
 	}
-	err = wt.addOrUpdateMenuItem(atomic.AddUint32(&id, 1), 0, "Simple checked disabled", true, true)
+	err = wt.addOrUpdateMenuItem(atomic.AddUint32(&id, 1), 0, "Simple checked disabled", true, true, false, false)
 	if err != nil {
 		t.Errorf("mergeMenuItem failed: %s", err)
 	}
@@ -74,11 +74,19 @@ func TestBaseWindowsTray(t *testing.T) {
 		t.Error("hideMenuItem failed: must return error on invalid item id")
 	}
 
-	err = wt.addOrUpdateMenuItem(2, 0, "Simple disabled update", true, false)
+	err = wt.addOrUpdateMenuItem(2, 0, "Simple disabled update", true, false, false, false)
 	if err != nil {
 		t.Errorf("mergeMenuItem failed: %s", err)
 	}
 
+	err = wt.removeMenuItem(4, 0)
+	if err != nil {
+		t.Errorf("removeMenuItem failed: %s", err)
+	}
+	if wt.getVisibleItemIndex(0, 4) != -1 {
+		t.Error("removeMenuItem failed: item must not be visible after removal")
+	}
+
 	time.AfterFunc(1*time.Second, quit)
 
 	m := struct {
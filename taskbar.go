@@ -0,0 +1,38 @@
+package systray
+
+// TaskbarProgressState is the state of the progress shown on the taskbar
+// button on Windows, see SetTaskbarProgressState.
+type TaskbarProgressState int
+
+// The values are the TBPFLAG of ITaskbarList3::SetProgressState.
+const (
+	// TaskbarNoProgress hides the progress.
+	TaskbarNoProgress TaskbarProgressState = 0
+	// TaskbarProgressIndeterminate shows a progress cycling endlessly.
+	TaskbarProgressIndeterminate TaskbarProgressState = 0x1
+	// TaskbarProgressNormal shows the progress in green.
+	TaskbarProgressNormal TaskbarProgressState = 0x2
+	// TaskbarProgressError shows the progress in red.
+	TaskbarProgressError TaskbarProgressState = 0x4
+	// TaskbarProgressPaused shows the progress in yellow.
+	TaskbarProgressPaused TaskbarProgressState = 0x8
+)
+
+// SetTaskbarProgress shows pct, from 0.0 to 1.0, as a progress overlaid on the
+// taskbar button of the systray window on Windows 7 and later. Note that the
+// window only has a taskbar button if the application gives it one. It's a
+// no-op on other platforms.
+func SetTaskbarProgress(pct float64) {
+	if pct < 0 {
+		pct = 0
+	} else if pct > 1 {
+		pct = 1
+	}
+	setTaskbarProgress(pct)
+}
+
+// SetTaskbarProgressState sets the state of the progress shown by
+// SetTaskbarProgress on Windows. It's a no-op on other platforms.
+func SetTaskbarProgressState(state TaskbarProgressState) {
+	setTaskbarProgressState(state)
+}
@@ -0,0 +1,9 @@
+//go:build !windows || systray_fake
+
+package systray
+
+func setTaskbarProgress(pct float64) {
+}
+
+func setTaskbarProgressState(state TaskbarProgressState) {
+}
@@ -0,0 +1,107 @@
+//go:build windows && !systray_fake
+
+package systray
+
+import (
+	"runtime"
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+var (
+	ole32             = windows.NewLazySystemDLL("Ole32.dll")
+	pCoCreateInstance = ole32.NewProc("CoCreateInstance")
+
+	clsidTaskbarList = windows.GUID{Data1: 0x56fdf344, Data2: 0xfd6d, Data3: 0x11d0, Data4: [8]byte{0x95, 0x8a, 0x00, 0x60, 0x97, 0xc9, 0xa0, 0x90}}
+	iidITaskbarList3 = windows.GUID{Data1: 0xea1afb91, Data2: 0x9e28, Data3: 0x4b86, Data4: [8]byte{0x90, 0xe9, 0x9e, 0x9f, 0x8a, 0x5e, 0xef, 0xaf}}
+)
+
+// Indexes of the methods of ITaskbarList3 in its vtable, after those of
+// IUnknown, ITaskbarList and ITaskbarList2.
+// https://docs.microsoft.com/en-us/windows/win32/api/shobjidl_core/nn-shobjidl_core-itaskbarlist3
+const (
+	taskbarListRelease          = 2
+	taskbarListHrInit           = 3
+	taskbarListSetProgressValue = 9
+	taskbarListSetProgressState = 10
+)
+
+// progressTotal is the total passed to SetProgressValue, pct being scaled to
+// it.
+const progressTotal = 10000
+
+// taskbarList3 is an ITaskbarList3 COM object, seen by its vtable.
+type taskbarList3 struct {
+	vtable *[taskbarListSetProgressState + 1]uintptr
+}
+
+func (l *taskbarList3) call(method int, args ...uintptr) uintptr {
+	ret, _, _ := syscall.SyscallN(l.vtable[method], append([]uintptr{uintptr(unsafe.Pointer(l))}, args...)...)
+	return ret
+}
+
+// ulonglong splits v into as many arguments as a ULONGLONG takes.
+func ulonglong(v uint64) []uintptr {
+	if unsafe.Sizeof(uintptr(0)) == 4 {
+		return []uintptr{uintptr(v), uintptr(v >> 32)}
+	}
+	return []uintptr{uintptr(v)}
+}
+
+// withTaskbarList calls fn with an initialized ITaskbarList3. The interface
+// is created for each call, in a thread of its own COM apartment, rather than
+// kept in the thread of the event loop.
+func withTaskbarList(fn func(l *taskbarList3)) error {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	const (
+		COINIT_APARTMENTTHREADED = 0x2
+		CLSCTX_INPROC_SERVER     = 0x1
+	)
+	if err := windows.CoInitializeEx(0, COINIT_APARTMENTTHREADED); err == nil {
+		defer windows.CoUninitialize()
+	}
+
+	var l *taskbarList3
+	hr, _, _ := pCoCreateInstance.Call(
+		uintptr(unsafe.Pointer(&clsidTaskbarList)),
+		0,
+		CLSCTX_INPROC_SERVER,
+		uintptr(unsafe.Pointer(&iidITaskbarList3)),
+		uintptr(unsafe.Pointer(&l)),
+	)
+	if int32(hr) < 0 {
+		return syscall.Errno(hr)
+	}
+	defer l.call(taskbarListRelease)
+	if hr := l.call(taskbarListHrInit); int32(hr) < 0 {
+		return syscall.Errno(hr)
+	}
+	fn(l)
+	return nil
+}
+
+func setTaskbarProgress(pct float64) {
+	err := withTaskbarList(func(l *taskbarList3) {
+		args := []uintptr{uintptr(wt.window)}
+		args = append(args, ulonglong(uint64(pct*progressTotal))...)
+		args = append(args, ulonglong(progressTotal)...)
+		l.call(taskbarListSetProgressValue, args...)
+	})
+	if err != nil {
+		// log.Errorf("Unable to set taskbar progress: %v", err)
+		return
+	}
+}
+
+func setTaskbarProgressState(state TaskbarProgressState) {
+	err := withTaskbarList(func(l *taskbarList3) {
+		l.call(taskbarListSetProgressState, uintptr(wt.window), uintptr(state))
+	})
+	if err != nil {
+		// log.Errorf("Unable to set taskbar progress state: %v", err)
+		return
+	}
+}
@@ -0,0 +1,146 @@
+//go:build systray_fake
+
+// Package testing records the menu an application builds into a JSON file,
+// and replays such recordings to check that the menu is still built the same
+// way, e.g. in golden file tests detecting unintended changes of the menu
+// structure:
+//
+//	func TestMenu(t *testing.T) {
+//		go systray.Run(onReady, onExit)
+//		defer systray.Quit()
+//		if err := systraytesting.Replay("testdata/menu.json"); err != nil {
+//			t.Error(err)
+//		}
+//	}
+//
+// It relies on the fake backend of systray, so tests using it have to be
+// built with the systray_fake build tag. Only the calls making up the menu
+// and the clicks on it are recorded, see Record. Menu item IDs are recorded
+// in order of appearance, 1 for the first menu item of the recording, 2 for
+// the next one and so on, as the IDs assigned automatically keep increasing
+// from one run of the systray to the next.
+package testing
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/bingliu221/systray"
+)
+
+// ReplayTimeout is how long Replay waits for the application to make each
+// call of the recording, as menus may be built from other goroutines.
+var ReplayTimeout = time.Second
+
+// recordedOps are the operations kept in recordings.
+var recordedOps = map[string]bool{
+	"AddOrUpdateMenuItem": true,
+	"HideMenuItem":        true,
+	"ShowMenuItem":        true,
+	"AddSeparator":        true,
+	"Click":               true,
+}
+
+// Record writes the menu items added, updated, hidden and shown, the
+// separators added and the clicks simulated with systray.SimulateClick since
+// the systray was registered to a JSON file at path.
+func Record(path string) error {
+	calls, _ := recordedCalls()
+	b, err := json.MarshalIndent(calls, "", "\t")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(b, '\n'), 0o644)
+}
+
+// Replay reads the recording at path, written by Record, and checks that the
+// application makes the same calls in the same order, simulating the
+// recorded clicks once the calls preceding them were made, and that it makes
+// no other call by then. It waits for the systray to run first, so it can be
+// invoked right after starting Run in another goroutine, but before any click
+// is simulated otherwise.
+func Replay(path string) error {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	deadline := time.Now().Add(ReplayTimeout)
+	for !systray.IsRunning() {
+		if time.Now().After(deadline) {
+			return fmt.Errorf("testing: systray not running after %v", ReplayTimeout)
+		}
+		time.Sleep(time.Millisecond)
+	}
+	var want []systray.FakeCall
+	if err := json.Unmarshal(b, &want); err != nil {
+		return fmt.Errorf("testing: invalid recording %s: %w", path, err)
+	}
+	for i, call := range want {
+		if call.Op != "Click" {
+			continue
+		}
+		ids, err := waitCalls(want[:i])
+		if err != nil {
+			return err
+		}
+		// the menu item clicked appears in the calls preceding the click,
+		// unless the recording was edited
+		if call.ID == 0 || int(call.ID) > len(ids) {
+			return fmt.Errorf("testing: click %d on unknown menu item %d", i, call.ID)
+		}
+		systray.SimulateClick(ids[call.ID-1])
+	}
+	if _, err := waitCalls(want); err != nil {
+		return err
+	}
+	if got, _ := recordedCalls(); len(got) > len(want) {
+		return fmt.Errorf("testing: unexpected call %d %+v", len(want), got[len(want)])
+	}
+	return nil
+}
+
+// waitCalls waits for the recorded calls to start with want, returning an
+// error if they don't or if not enough calls are made in time. It returns
+// the actual IDs of the menu items, see recordedCalls.
+func waitCalls(want []systray.FakeCall) ([]uint32, error) {
+	deadline := time.Now().Add(ReplayTimeout)
+	for {
+		got, ids := recordedCalls()
+		for i := 0; i < len(got) && i < len(want); i++ {
+			if got[i] != want[i] {
+				return nil, fmt.Errorf("testing: call %d is %+v, want %+v", i, got[i], want[i])
+			}
+		}
+		if len(got) >= len(want) {
+			return ids, nil
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("testing: call %d %+v not made after %v", len(got), want[len(got)], ReplayTimeout)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// recordedCalls returns the calls kept in recordings, with the menu item IDs
+// replaced by their order of appearance, and the actual IDs in that order.
+func recordedCalls() ([]systray.FakeCall, []uint32) {
+	var calls []systray.FakeCall
+	var ids []uint32
+	order := make(map[uint32]uint32)
+	for _, call := range systray.FakeCalls() {
+		if !recordedOps[call.Op] {
+			continue
+		}
+		if call.ID != 0 {
+			if order[call.ID] == 0 {
+				ids = append(ids, call.ID)
+				order[call.ID] = uint32(len(ids))
+			}
+			call.ID = order[call.ID]
+		}
+		calls = append(calls, call)
+	}
+	return calls, ids
+}
@@ -0,0 +1,63 @@
+//go:build systray_fake
+
+package testing_test
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/bingliu221/systray"
+	systraytesting "github.com/bingliu221/systray/testing"
+)
+
+// first is the first menu item added by run, set once ready is closed.
+var first *systray.MenuItem
+
+// run runs the systray with a menu titled title until stop is called.
+func run(title string) (ready <-chan struct{}, stop func()) {
+	readyCh := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		systray.Run(func() {
+			var hidden *systray.MenuItem
+			first = systray.NewMenuItem(title, systray.WithOnClickedFunc(func() {
+				hidden.Show()
+			}))
+			systray.NewSeparator()
+			hidden = systray.NewMenuItem("Hidden")
+			hidden.Hide()
+			close(readyCh)
+		}, nil)
+	}()
+	return readyCh, func() {
+		systray.SimulateQuit()
+		<-done
+	}
+}
+
+func TestRecordReplay(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "menu.json")
+	ready, stop := run("Item")
+	<-ready
+	systray.SimulateClick(first.ID())
+	if err := systraytesting.Replay(path); err == nil {
+		t.Error("Replay succeeded without recording")
+	}
+	if err := systraytesting.Record(path); err != nil {
+		t.Fatal(err)
+	}
+	stop()
+
+	_, stop = run("Item")
+	if err := systraytesting.Replay(path); err != nil {
+		t.Error(err)
+	}
+	stop()
+
+	_, stop = run("Renamed")
+	if err := systraytesting.Replay(path); err == nil {
+		t.Error("Replay succeeded with a different menu")
+	}
+	stop()
+}
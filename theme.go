@@ -0,0 +1,45 @@
+package systray
+
+import (
+	"sync"
+)
+
+var (
+	onThemeChanged func(isDark bool)
+	// themeKnown tells if the platform reported the theme yet, themeDark if
+	// it's dark
+	themeKnown, themeDark bool
+	muTheme               sync.Mutex
+	watchThemeOnce        sync.Once
+)
+
+// SetOnThemeChangedFunc sets the callback function to call with true when the
+// OS switches to dark mode and false when it switches to light mode, e.g. to
+// switch to an icon variant which stays visible. It's called once with the
+// current theme as soon as it's known. It watches the effective appearance
+// of the application on macOS, the SystemUsesLightTheme registry value on
+// Windows, and the dark theme preference or theme name of GTK on Linux. It
+// should be called once the systray is ready, e.g. in onReady.
+func SetOnThemeChangedFunc(callback func(isDark bool)) {
+	muTheme.Lock()
+	onThemeChanged = callback
+	known, isDark := themeKnown, themeDark
+	muTheme.Unlock()
+
+	watchThemeOnce.Do(watchTheme)
+	if known && callback != nil {
+		callback(isDark)
+	}
+}
+
+func systrayThemeChanged(isDark bool) {
+	muTheme.Lock()
+	changed := !themeKnown || themeDark != isDark
+	themeKnown, themeDark = true, isDark
+	callback := onThemeChanged
+	muTheme.Unlock()
+
+	if changed && callback != nil {
+		callback(isDark)
+	}
+}
@@ -0,0 +1,63 @@
+package systray
+
+import (
+	"fmt"
+	"time"
+)
+
+// TimerOption configures a timer menu item, see NewTimerMenuItem.
+type TimerOption func(*timerOptions)
+
+type timerOptions struct {
+	prefix string
+}
+
+// WithTimerPrefix sets the text shown before the remaining time in the title
+// of a timer menu item, e.g. "Next check in ". It defaults to the title
+// followed by a space.
+func WithTimerPrefix(prefix string) TimerOption {
+	return func(o *timerOptions) {
+		o.prefix = prefix
+	}
+}
+
+// NewTimerMenuItem adds a menu item which counts down from duration, showing
+// the remaining time as mm:ss after its prefix, see WithTimerPrefix. Once the
+// time is up, its title is set back to title and onExpire, if not nil, is
+// called. The countdown stops for good, without calling onExpire, as soon as
+// the menu item is hidden or removed.
+func NewTimerMenuItem(title string, duration time.Duration, onExpire func(), opts ...TimerOption) *MenuItem {
+	o := timerOptions{prefix: title + " "}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	deadline := time.Now().Add(duration)
+	item := NewMenuItem(o.prefix + formatCountdown(duration))
+	go func() {
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+		for range ticker.C {
+			if item.isRemoved() || !item.IsVisible() {
+				return
+			}
+			remaining := time.Until(deadline)
+			if remaining <= 0 {
+				item.SetTitle(title)
+				if onExpire != nil {
+					onExpire()
+				}
+				return
+			}
+			item.SetTitle(o.prefix + formatCountdown(remaining))
+		}
+	}()
+	return item
+}
+
+// formatCountdown formats d as mm:ss, rounding up to the second so that 00:00
+// is only reached when the time is up. Minutes go beyond 59 for an hour or
+// more.
+func formatCountdown(d time.Duration) string {
+	secs := int((d + time.Second - 1) / time.Second)
+	return fmt.Sprintf("%02d:%02d", secs/60, secs%60)
+}
@@ -0,0 +1,172 @@
+//go:build windows && !systray_fake
+
+package systray
+
+import (
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+var (
+	c32                   = windows.NewLazySystemDLL("ComCtl32.dll")
+	pInitCommonControlsEx = c32.NewProc("InitCommonControlsEx")
+)
+
+// tooltipTimerID identifies the timer which delays showing the tooltip of the
+// menu item pointed to.
+const tooltipTimerID = 2
+
+// menuTooltip shows the tooltips of the menu items, which Windows menus don't
+// show themselves. It's a tracking tooltip, see TTF_TRACK, so that it shows
+// when the window procedure decides, after the delay of the menu item, rather
+// than after the delay of the tooltip control. Only accessed from the window
+// procedure.
+type menuTooltip struct {
+	// window is the tooltip control, 0 until a tooltip is first shown
+	window windows.Handle
+	// pending is the ID of the menu item whose tooltip shows once the timer
+	// fires, 0 if none
+	pending uint32
+	// shown is set while the tooltip shows
+	shown bool
+}
+
+// https://docs.microsoft.com/en-us/windows/win32/api/commctrl/ns-commctrl-tttoolinfow
+type toolInfo struct {
+	Size     uint32
+	Flags    uint32
+	Window   windows.Handle
+	ID       uintptr
+	Rect     rect
+	Instance windows.Handle
+	Text     *uint16
+	Param    uintptr
+	// lpReserved is left out, as version 5 of the common controls, used
+	// without a manifest, rejects the larger structure
+}
+
+// https://docs.microsoft.com/en-us/windows/win32/controls/bumper-tooltip-control-reference-messages
+const (
+	TTM_TRACKACTIVATE   = 0x0400 + 17
+	TTM_TRACKPOSITION   = 0x0400 + 18
+	TTM_SETMAXTIPWIDTH  = 0x0400 + 24
+	TTM_ADDTOOLW        = 0x0400 + 50
+	TTM_UPDATETIPTEXTW  = 0x0400 + 57
+	TTF_TRACK           = 0x0020
+	TTF_ABSOLUTE        = 0x0080
+	menuTooltipToolID   = 1
+	menuTooltipMaxWidth = 400
+)
+
+// hover schedules showing the tooltip of the menu item, if it has one, after
+// its delay, hiding the one showing.
+func (mt *menuTooltip) hover(t *winTray, menuItemId uint32) {
+	mt.hide(t)
+	item, ok := GetMenuItemByID(menuItemId)
+	if !ok || item.loadTooltip() == "" {
+		return
+	}
+	delay := item.loadTooltipDelay()
+	if delay < 0 {
+		// the initial delay of tooltip controls by default
+		doubleClickTime, _, _ := pGetDoubleClickTime.Call()
+		delay = int(doubleClickTime)
+	}
+	mt.pending = menuItemId
+	pSetTimer.Call(uintptr(t.window), tooltipTimerID, uintptr(delay), 0)
+}
+
+// show shows the tooltip of the pending menu item below the cursor.
+func (mt *menuTooltip) show(t *winTray) {
+	pKillTimer.Call(uintptr(t.window), tooltipTimerID)
+	item, ok := GetMenuItemByID(mt.pending)
+	mt.pending = 0
+	if !ok {
+		return
+	}
+	text, err := windows.UTF16PtrFromString(item.loadTooltip())
+	if err != nil || !mt.create(t) {
+		return
+	}
+	ti := mt.toolInfo(t)
+	ti.Text = text
+	pSendMessage.Call(uintptr(mt.window), TTM_UPDATETIPTEXTW, 0, uintptr(unsafe.Pointer(&ti)))
+
+	const SM_CYCURSOR = 14
+	var p point
+	pGetCursorPos.Call(uintptr(unsafe.Pointer(&p)))
+	cursorHeight, _, _ := pGetSystemMetrics.Call(SM_CYCURSOR)
+	p.Y += int32(cursorHeight) / 2
+	pSendMessage.Call(uintptr(mt.window), TTM_TRACKPOSITION, 0, uintptr(uint16(p.X))|uintptr(uint16(p.Y))<<16)
+	pSendMessage.Call(uintptr(mt.window), TTM_TRACKACTIVATE, 1, uintptr(unsafe.Pointer(&ti)))
+	mt.shown = true
+}
+
+// hide hides the tooltip showing and cancels the pending one.
+func (mt *menuTooltip) hide(t *winTray) {
+	if mt.pending != 0 {
+		pKillTimer.Call(uintptr(t.window), tooltipTimerID)
+		mt.pending = 0
+	}
+	if mt.shown {
+		ti := mt.toolInfo(t)
+		pSendMessage.Call(uintptr(mt.window), TTM_TRACKACTIVATE, 0, uintptr(unsafe.Pointer(&ti)))
+		mt.shown = false
+	}
+}
+
+// create creates the tooltip control unless it was already, returning whether
+// it exists. It's owned by the window of the tray icon, which destroys it.
+func (mt *menuTooltip) create(t *winTray) bool {
+	if mt.window != 0 {
+		return true
+	}
+	// https://docs.microsoft.com/en-us/windows/win32/api/commctrl/ns-commctrl-initcommoncontrolsex
+	const ICC_BAR_CLASSES = 0x00000004
+	icc := struct{ Size, ICC uint32 }{8, ICC_BAR_CLASSES}
+	pInitCommonControlsEx.Call(uintptr(unsafe.Pointer(&icc)))
+
+	const (
+		WS_EX_TOPMOST = 0x00000008
+		WS_POPUP      = 0x80000000
+		TTS_ALWAYSTIP = 0x01
+		TTS_NOPREFIX  = 0x02
+		CW_USEDEFAULT = 0x80000000
+	)
+	className, _ := windows.UTF16PtrFromString("tooltips_class32")
+	window, _, _ := pCreateWindowEx.Call(
+		WS_EX_TOPMOST,
+		uintptr(unsafe.Pointer(className)),
+		0,
+		WS_POPUP|TTS_ALWAYSTIP|TTS_NOPREFIX,
+		CW_USEDEFAULT,
+		CW_USEDEFAULT,
+		CW_USEDEFAULT,
+		CW_USEDEFAULT,
+		uintptr(t.window),
+		0,
+		uintptr(t.instance),
+		0,
+	)
+	if window == 0 {
+		return false
+	}
+	mt.window = windows.Handle(window)
+	ti := mt.toolInfo(t)
+	empty, _ := windows.UTF16PtrFromString("")
+	ti.Text = empty
+	pSendMessage.Call(uintptr(mt.window), TTM_ADDTOOLW, 0, uintptr(unsafe.Pointer(&ti)))
+	// wraps long tooltips rather than showing them on a single line
+	pSendMessage.Call(uintptr(mt.window), TTM_SETMAXTIPWIDTH, 0, menuTooltipMaxWidth)
+	return true
+}
+
+func (mt *menuTooltip) toolInfo(t *winTray) toolInfo {
+	return toolInfo{
+		Size:   uint32(unsafe.Sizeof(toolInfo{})),
+		Flags:  TTF_TRACK | TTF_ABSOLUTE,
+		Window: t.window,
+		ID:     menuTooltipToolID,
+	}
+}
@@ -0,0 +1,187 @@
+package systray
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// Tray is a tray icon and its menu, with methods mirroring the package level
+// functions, which act on the default Tray, see Default.
+//
+// The native backends only support one tray icon per process for now, so a
+// single Tray may be running at a time: running another one fails with
+// ErrTrayRunning until the first one exited. The methods other than the Run
+// and Register ones act on the tray icon and menu of the running Tray, so
+// that code can be written against a *Tray rather than the package globals
+// ahead of multiple icons support.
+type Tray struct {
+	// _ makes each Tray distinct, as pointers to zero-size values may be
+	// equal
+	_ byte
+}
+
+// ErrTrayRunning is returned, wrapped in an *InitError, when running a Tray
+// while another one is running.
+var ErrTrayRunning = errors.New("systray: another Tray is running")
+
+var (
+	// activeTray is the running Tray, nil if none
+	activeTray   *Tray
+	muActiveTray sync.Mutex
+	defaultTray  = New()
+)
+
+// New creates a Tray, which shows nothing until it's run.
+func New() *Tray {
+	return &Tray{}
+}
+
+// Default returns the Tray the package level functions act on.
+func Default() *Tray {
+	return defaultTray
+}
+
+// Run is the Tray counterpart of the package level Run.
+func (t *Tray) Run(onReady func(), onExit func(), opts ...Option) {
+	initOrPanic(t.RunE(onReady, onExit, opts...))
+}
+
+// RunE is the Tray counterpart of the package level RunE.
+func (t *Tray) RunE(onReady func(), onExit func(), opts ...Option) error {
+	if err := t.RegisterE(onReady, onExit, opts...); err != nil {
+		return err
+	}
+	nativeLoop()
+	if err := takeLateInitError(); err != nil {
+		// onExit isn't invoked then, which would have deactivated t
+		t.deactivate()
+		return err
+	}
+	return nil
+}
+
+// RunWithContext is the Tray counterpart of the package level
+// RunWithContext.
+func (t *Tray) RunWithContext(ctx context.Context, onReady func(), onExit func(), opts ...Option) {
+	loopExited := make(chan struct{})
+	defer close(loopExited)
+	t.Run(func() {
+		// only watch ctx after the systray is ready, so that Quit is never
+		// called against a half initialized GUI
+		go func() {
+			select {
+			case <-ctx.Done():
+				t.Quit()
+			case <-loopExited:
+			}
+		}()
+		if onReady != nil {
+			onReady()
+		}
+	}, onExit, opts...)
+}
+
+// Register is the Tray counterpart of the package level Register.
+func (t *Tray) Register(onReady func(), onExit func(), opts ...Option) {
+	initOrPanic(t.RegisterE(onReady, onExit, opts...))
+}
+
+// RegisterE is the Tray counterpart of the package level RegisterE.
+func (t *Tray) RegisterE(onReady func(), onExit func(), opts ...Option) error {
+	if !t.activate() {
+		return &InitError{Op: "run the Tray", Err: ErrTrayRunning}
+	}
+	exit := func() {
+		// before onExit, which ExitTimeout may give up on, so that another
+		// Tray can run once t exited
+		t.deactivate()
+		if onExit != nil {
+			onExit()
+		}
+	}
+	if err := register(onReady, exit, opts...); err != nil {
+		t.deactivate()
+		return err
+	}
+	return nil
+}
+
+// Quit quits the Tray if it's running.
+func (t *Tray) Quit() {
+	if t.isActive() {
+		Quit()
+	}
+}
+
+// IsRunning reports whether the Tray is ready, see the package level
+// IsRunning.
+func (t *Tray) IsRunning() bool {
+	return t.isActive() && IsRunning()
+}
+
+// SetIcon is the Tray counterpart of the package level SetIcon.
+func (t *Tray) SetIcon(iconBytes []byte) error {
+	return SetIcon(iconBytes)
+}
+
+// SetTemplateIcon is the Tray counterpart of the package level
+// SetTemplateIcon.
+func (t *Tray) SetTemplateIcon(templateIconBytes []byte, regularIconBytes []byte) {
+	SetTemplateIcon(templateIconBytes, regularIconBytes)
+}
+
+// SetTitle is the Tray counterpart of the package level SetTitle.
+func (t *Tray) SetTitle(title string) {
+	SetTitle(title)
+}
+
+// SetTooltip is the Tray counterpart of the package level SetTooltip.
+func (t *Tray) SetTooltip(tooltip string) {
+	SetTooltip(tooltip)
+}
+
+// NewMenuItem is the Tray counterpart of the package level NewMenuItem.
+func (t *Tray) NewMenuItem(title string, opts ...MenuItemOption) *MenuItem {
+	return NewMenuItem(title, opts...)
+}
+
+// NewMenuHeader is the Tray counterpart of the package level NewMenuHeader.
+func (t *Tray) NewMenuHeader(title string) *MenuItem {
+	return NewMenuHeader(title)
+}
+
+// NewSeparator is the Tray counterpart of the package level NewSeparator.
+func (t *Tray) NewSeparator() *MenuItem {
+	return NewSeparator()
+}
+
+// ResetMenu is the Tray counterpart of the package level ResetMenu.
+func (t *Tray) ResetMenu() {
+	ResetMenu()
+}
+
+// activate makes t the running Tray, unless another one is running.
+func (t *Tray) activate() bool {
+	muActiveTray.Lock()
+	defer muActiveTray.Unlock()
+	if activeTray != nil && activeTray != t {
+		return false
+	}
+	activeTray = t
+	return true
+}
+
+func (t *Tray) deactivate() {
+	muActiveTray.Lock()
+	defer muActiveTray.Unlock()
+	if activeTray == t {
+		activeTray = nil
+	}
+}
+
+func (t *Tray) isActive() bool {
+	muActiveTray.Lock()
+	defer muActiveTray.Unlock()
+	return activeTray == t
+}
@@ -0,0 +1,47 @@
+package systray
+
+import (
+	"errors"
+	"log"
+	"net/url"
+	"os/exec"
+)
+
+// ErrInvalidURL is returned when a URL menu item is given a URL which isn't
+// an absolute http or https URL.
+var ErrInvalidURL = errors.New("systray: URL must be an absolute http or https URL")
+
+// NewURLMenuItem adds a menu item which opens rawURL in the default browser
+// when clicked, e.g. for a "Visit website" menu item. It panics if rawURL isn't
+// an absolute http or https URL, see NewURLMenuItemE to handle the error.
+func NewURLMenuItem(title, tooltip, rawURL string) *MenuItem {
+	item, err := NewURLMenuItemE(title, tooltip, rawURL)
+	if err != nil {
+		panic(err)
+	}
+	return item
+}
+
+// NewURLMenuItemE is like NewURLMenuItem but returns ErrInvalidURL instead of
+// panicking, without adding any menu item.
+func NewURLMenuItemE(title, tooltip, rawURL string) (*MenuItem, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, ErrInvalidURL
+	}
+	return NewMenuItem(title, WithTooltip(tooltip), WithOnClickedFunc(func() {
+		if err := openURL(u.String()); err != nil {
+			log.Printf("systray: unable to open %v: %v", u, err)
+		}
+	})), nil
+}
+
+// startCommand starts cmd without waiting for it to finish, but still reaps
+// it once it does.
+func startCommand(cmd *exec.Cmd) error {
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	go cmd.Wait()
+	return nil
+}
@@ -0,0 +1,46 @@
+package systray
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+var (
+	menuValidationFunc func(item *MenuItem) bool
+	muMenuValidation   sync.RWMutex
+)
+
+// SetMenuValidationFunc sets the function macOS calls for each menu item of
+// a menu about to open, to tell whether the menu item is enabled, so that the
+// menu reflects the latest state without updating it beforehand. The result
+// is applied as Enable or Disable would, and section headers and separators
+// are left alone. A nil fn stops validating menu items. It's a no-op on other
+// platforms.
+func SetMenuValidationFunc(fn func(item *MenuItem) bool) {
+	muMenuValidation.Lock()
+	menuValidationFunc = fn
+	muMenuValidation.Unlock()
+}
+
+// validateMenuItem calls the function set by SetMenuValidationFunc for the
+// menu item with the given ID, reporting whether it's enabled, and whether
+// it was validated at all.
+func validateMenuItem(id uint32) (enabled, ok bool) {
+	muMenuValidation.RLock()
+	fn := menuValidationFunc
+	muMenuValidation.RUnlock()
+	if fn == nil {
+		return false, false
+	}
+	item, ok := GetMenuItemByID(id)
+	if !ok || item.isHeader || item.isSeparator {
+		return false, false
+	}
+	enabled = fn(item)
+	if enabled {
+		atomic.StoreInt32(&item.disabled, 0)
+	} else {
+		atomic.StoreInt32(&item.disabled, 1)
+	}
+	return enabled, true
+}
@@ -0,0 +1,29 @@
+package systray
+
+import (
+	"runtime/debug"
+)
+
+// version is the version of the library, injected at build time with
+// -ldflags "-X github.com/bingliu221/systray.version=v1.2.3".
+var version string
+
+// Version returns the version of the library injected at build time, e.g. for
+// error reports to tell it, or "devel" if none was injected.
+func Version() string {
+	if version == "" {
+		return "devel"
+	}
+	return version
+}
+
+// BuildInfo returns the build information embedded in the running binary,
+// which lists the module versions it was built with, or nil if the binary was
+// built without module support.
+func BuildInfo() *debug.BuildInfo {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return nil
+	}
+	return info
+}